@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/krasnov23/guest-house-golang/internal/driver"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envInt читает целое число из переменной окружения, если она не задана - возвращает def
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, v)
+	}
+
+	return n, nil
+}
+
+// envDuration читает длительность ("500ms", "30s", "5m") из переменной окружения, если она не задана - возвращает def
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %q", name, v)
+	}
+
+	return d, nil
+}
+
+// databaseOptions - настройки пула и подключения к БД: значения по умолчанию из driver, переопределяются
+// переменными окружения DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME и DB_CONNECT_TIMEOUT
+func databaseOptions() (driver.Options, error) {
+	opts := driver.DefaultOptions()
+
+	var err error
+	if opts.MaxOpenConns, err = envInt("DB_MAX_OPEN_CONNS", opts.MaxOpenConns); err != nil {
+		return opts, err
+	}
+	if opts.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", opts.MaxIdleConns); err != nil {
+		return opts, err
+	}
+	if opts.ConnMaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", opts.ConnMaxLifetime); err != nil {
+		return opts, err
+	}
+	if opts.ConnectTimeout, err = envDuration("DB_CONNECT_TIMEOUT", opts.ConnectTimeout); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
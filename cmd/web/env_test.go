@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/krasnov23/guest-house-golang/internal/driver"
+	"testing"
+	"time"
+)
+
+func TestDatabaseOptions(t *testing.T) {
+	opts, err := databaseOptions()
+	if err != nil || opts != driver.DefaultOptions() {
+		t.Errorf("got %+v, %v, want defaults", opts, err)
+	}
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "25")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "1m")
+
+	opts, err = databaseOptions()
+	if err != nil || opts.MaxOpenConns != 25 || opts.ConnMaxLifetime != time.Minute || opts.MaxIdleConns != driver.DefaultOptions().MaxIdleConns {
+		t.Errorf("got %+v, %v", opts, err)
+	}
+
+	for name, value := range map[string]string{"DB_MAX_IDLE_CONNS": "many", "DB_CONNECT_TIMEOUT": "-5s"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := databaseOptions(); err == nil {
+				t.Errorf("%s=%s should be rejected", name, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/krasnov23/guest-house-golang/internal/driver"
+	"github.com/krasnov23/guest-house-golang/internal/health"
+	"github.com/krasnov23/guest-house-golang/internal/render"
+	"time"
+)
+
+// readyTimeout - сколько ждать каждую проверку готовности
+const readyTimeout = 2 * time.Second
+
+// readinessChecks - от чего зависит обработка запросов: БД, почтовый сервер и шаблоны
+func readinessChecks(db *driver.DB) []health.Check {
+	return []health.Check{
+		{Name: "database", Run: func(ctx context.Context) error {
+			return db.Ping(ctx, readyTimeout)
+		}},
+		{Name: "smtp", Run: pingMailServer},
+		{Name: "templates", Run: func(ctx context.Context) error {
+			tc, err := render.CreateTemplateCache()
+			if err != nil {
+				return err
+			}
+			if len(tc) == 0 {
+				return errors.New("no templates found")
+			}
+			return nil
+		}},
+	}
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"github.com/krasnov23/guest-house-golang/internal/config"
 	"github.com/krasnov23/guest-house-golang/internal/driver"
 	"github.com/krasnov23/guest-house-golang/internal/handlers"
+	"github.com/krasnov23/guest-house-golang/internal/health"
 	"github.com/krasnov23/guest-house-golang/internal/helpers"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
+	"github.com/krasnov23/guest-house-golang/internal/metrics"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
 	"github.com/krasnov23/guest-house-golang/internal/render"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -18,21 +23,34 @@ import (
 
 const portNumber = ":8082"
 
+// databaseDSN - строка подключения к БД, общая для сервера и подкоманды migrate
+const databaseDSN = "host=localhost port=5432 dbname=app_db user=postgres password=postgres"
+
 var app config.AppConfig
 
 var session *scs.SessionManager
 
-var infoLog *log.Logger
-
-var errorLog *log.Logger
+// readyChecks - проверки для /readyz, заполняются после подключения к БД
+var readyChecks []health.Check
 
 // main is the main function
 func main() {
+	// web migrate up|down|status - миграции схемы БД тем же бинарником, без отдельных инструментов
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+
+		if err := runMigrate(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			slog.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	db, err := run()
 
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("cannot start application", "error", err)
+		os.Exit(1)
 	}
 
 	defer db.SQL.Close()
@@ -54,7 +72,8 @@ func main() {
 	}
 
 	err = srv.ListenAndServe()
-	log.Fatal(err)
+	app.Logger.Error("server stopped", "error", err)
+	os.Exit(1)
 }
 
 func run() (*driver.DB, error) {
@@ -71,14 +90,12 @@ func run() (*driver.DB, error) {
 	// изменяем данное свойство когда выходим в продакшн
 	app.InProduction = false
 
-	// Stdout означает что логи будут выводиться в консоли
-	// log.Ldate | log.Ltime означает: в лог будут добавлены дата (2009/01/23) и время (01:23:23).
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+	// логи в формате JSON в консоль; логгер по умолчанию тот же, чтобы записи вне запросов не терялись
+	app.Logger = logging.New(os.Stdout, slog.LevelInfo)
+	slog.SetDefault(app.Logger)
 
-	// будет отображать Дата + время + сообщение в консоли
-	errLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errLog
+	app.Metrics = metrics.New()
+	app.Metrics.MailQueue(func() int { return len(app.MailChan) })
 
 	session = scs.New()
 	// 24 часа срок жизни сессии
@@ -92,24 +109,52 @@ func run() (*driver.DB, error) {
 
 	app.Session = session
 
-	// Соединяемся с БД
-	log.Println("Connecting to database...")
-	db, err := driver.ConnectSQL("host=localhost port=5432 dbname=app_db user=postgres password=postgres")
+	dbOpts, err := databaseOptions()
+	if err != nil {
+		return nil, err
+	}
 
+	pingInterval, err := envDuration("DB_PING_INTERVAL", 10*time.Second)
 	if err != nil {
-		log.Fatal("cannot connect to database")
+		return nil, err
 	}
-	log.Println("Connecting to database successfully")
+
+	// Соединяемся с БД; при запуске вместе с docker compose Postgres может еще подниматься, поэтому ждем его
+	app.Logger.Info("connecting to database", "max_open_conns", dbOpts.MaxOpenConns, "connect_timeout", dbOpts.ConnectTimeout.String())
+	db, err := driver.ConnectSQL(context.Background(), databaseDSN, dbOpts)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+	app.Logger.Info("connected to database")
+	app.Metrics.DBStats(db.SQL.Stats)
+	app.Metrics.Registry.GaugeFunc("db_up", "Whether the last database ping succeeded.", func() float64 {
+		if db.Err() != nil {
+			return 0
+		}
+		return 1
+	})
+	readyChecks = readinessChecks(db)
+
+	// фоновая проверка: пока БД недоступна, /readyz и db_up показывают это, а когда вернется - снова готовы
+	go db.Monitor(context.Background(), pingInterval, readyTimeout)
 
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("cannot create template cache")
-		return nil, err
+		return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
 
 	// Конфигурационный файл
 	app.TemplateCache = tc
 	app.UseCache = false
+	app.SuggestionDays = 7
+
+	// до подключения реальной платежной системы используется локальная фейковая
+	app.Payments = payments.NewFakeProvider("fake-webhook-secret")
+	app.DepositPercent = 30
+	app.Currency = "USD"
+	app.BaseURL = "http://localhost" + portNumber
+	app.DBQueryTimeout = 3 * time.Second
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandler(repo)
@@ -119,7 +164,7 @@ func run() (*driver.DB, error) {
 
 	helpers.NewHelpers(&app)
 
-	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
+	app.Logger.Info("starting application", "port", portNumber)
 
 	return db, nil
 }
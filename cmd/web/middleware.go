@@ -2,16 +2,18 @@ package main
 
 import (
 	"github.com/justinas/nosurf"
+	"github.com/krasnov23/guest-house-golang/internal/access"
 	"github.com/krasnov23/guest-house-golang/internal/helpers"
-	"log"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
 	"net/http"
 )
 
-// Создание нашего собственного middleWare который выводит в консоль: по каждому запросу
-func WriteToConsole(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-	})
+// RequestLogger назначает запросу ID, передает логгер запроса через контекст и пишет в лог каждый запрос.
+// Стоит после SessionLoad, чтобы в лог попадал ID пользователя
+func RequestLogger(next http.Handler) http.Handler {
+	return logging.Middleware(app.Logger, func(r *http.Request) int {
+		return session.GetInt(r.Context(), "user_id")
+	})(next)
 }
 
 // Создание CSRF токена для защиты от POST запросов с посторонних сайтов
@@ -32,9 +34,12 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// уведомления платежной системы приходят без CSRF токена, их подлинность проверяется подписью
+	csrfHandler.ExemptPath("/payments/webhook")
+
 	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Логируем ошибку CSRF
-		log.Printf("CSRF token mismatch: form token=%s, cookie token=%s", r.FormValue("csrf_token"), nosurf.Token(r))
+		logging.FromContext(r.Context()).Warn("CSRF token mismatch", "reason", nosurf.Reason(r))
 		http.Error(w, "CSRF token mismatch", http.StatusBadRequest)
 	}))
 
@@ -64,9 +69,33 @@ func Auth(next http.Handler) http.Handler {
 		if !helpers.IsAuthenticated(r) {
 			session.Put(r.Context(), "error", "You need to authenticate")
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 
 }
+
+// AdminAccess пускает в админку по роли пользователя из сессии (см. access.Allowed).
+// Стоит после Auth; если роли в сессии нет (вход был до появления ролей), нужно войти заново
+func AdminAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := session.GetString(r.Context(), "user_role")
+
+		if role == "" {
+			session.Put(r.Context(), "error", "You need to authenticate")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		if !access.Allowed(role, r.Method, r.URL.Path) {
+			logging.FromContext(r.Context()).Warn("admin access denied", "role", role, "path", r.URL.Path)
+			session.Put(r.Context(), "error", "You do not have access to this page")
+			http.Redirect(w, r, access.Home(role), http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"github.com/alexedwards/scs/v2"
+	"github.com/krasnov23/guest-house-golang/internal/access"
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -36,3 +40,52 @@ func TestSessionLoad(t *testing.T) {
 	}
 
 }
+
+func TestAdminAccess(t *testing.T) {
+	if session == nil {
+		session = scs.New()
+	}
+
+	var tests = []struct {
+		name     string
+		role     string
+		method   string
+		path     string
+		location string
+	}{
+		{"admin", access.RoleAdmin, "GET", "/admin/reservations-all", ""},
+		{"housekeeping-board", housekeeping.Role, "POST", "/admin/housekeeping/3", ""},
+		{"housekeeping-reservations", housekeeping.Role, "GET", "/admin/reservations-all", "/admin/housekeeping"},
+		{"no-role", "", "GET", "/admin/dashboard", "/user/login"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.path, nil)
+
+		ctx, err := session.Load(req.Context(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.role != "" {
+			session.Put(ctx, "user_role", e.role)
+		}
+
+		called := false
+		h := AdminAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req.WithContext(ctx))
+
+		if e.location == "" {
+			if !called {
+				t.Errorf("failed %s: request was not passed through, got status %d", e.name, rr.Code)
+			}
+			continue
+		}
+
+		if called || rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.location {
+			t.Errorf("failed %s: got status %d, location %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/krasnov23/guest-house-golang/internal/driver"
+	"github.com/krasnov23/guest-house-golang/internal/migrate"
+	"github.com/krasnov23/guest-house-golang/migrations"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = "usage: web migrate up | down [steps] | status"
+
+// runMigrate выполняет подкоманду migrate: up применяет все новые миграции, down откатывает steps последних
+// (по умолчанию одну), status печатает, какие миграции применены
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	steps := 1
+	switch {
+	case args[0] == "down" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("steps must be a positive number, got %q", args[1])
+		}
+		steps = n
+	case args[0] != "up" && args[0] != "down" && args[0] != "status", len(args) > 1:
+		return errors.New(migrateUsage)
+	}
+
+	list, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	opts, err := databaseOptions()
+	if err != nil {
+		return err
+	}
+
+	db, err := driver.ConnectSQL(ctx, databaseDSN, opts)
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer db.SQL.Close()
+
+	m := migrate.New(db.SQL, list)
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			slog.Info("migration applied", "version", mig.Version, "name", mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			slog.Info("database schema is up to date")
+		}
+
+	case "down":
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			slog.Info("migration reverted", "version", mig.Version, "name", mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			slog.Info("no migrations to revert")
+		}
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(out, statuses)
+	}
+
+	return nil
+}
+
+func printMigrationStatus(out io.Writer, statuses []migrate.Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+
+	for _, s := range statuses {
+		applied := "pending"
+		if !s.AppliedAt.IsZero() {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	w.Flush()
+}
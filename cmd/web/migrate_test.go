@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/krasnov23/guest-house-golang/internal/migrate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunMigrateArgs(t *testing.T) {
+	// неверные аргументы отклоняются до подключения к БД
+	for _, args := range [][]string{nil, {"sideways"}, {"up", "now"}, {"down", "zero"}, {"down", "0"}, {"down", "1", "2"}} {
+		if err := runMigrate(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestPrintMigrationStatus(t *testing.T) {
+	var out bytes.Buffer
+	printMigrationStatus(&out, []migrate.Status{
+		{Migration: migrate.Migration{Version: 10, Name: "create_a"}, AppliedAt: time.Date(2025, 4, 9, 12, 0, 0, 0, time.UTC)},
+		{Migration: migrate.Migration{Version: 20, Name: "add_b"}},
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "2025-04-09 12:00:00") || !strings.HasSuffix(lines[2], "pending") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/krasnov23/guest-house-golang/internal/config"
 	"github.com/krasnov23/guest-house-golang/internal/handlers"
+	"github.com/krasnov23/guest-house-golang/internal/health"
 	"net/http"
 )
 
@@ -22,12 +23,21 @@ func patRoutes(app *config.AppConfig) http.Handler {
 // создаем мультплексер с помощью chi
 func routes(app *config.AppConfig) http.Handler {
 
+	// служебные маршруты без сессии и CSRF: их опрашивают оркестратор и Prometheus
+	root := chi.NewRouter()
+
+	root.Use(middleware.Recoverer)
+	root.Use(app.Metrics.Middleware)
+
+	root.Get("/healthz", health.Live)
+	root.Get("/readyz", health.Ready(readyTimeout, readyChecks...))
+	root.Handle("/metrics", app.Metrics.Registry)
+
 	mux := chi.NewRouter()
 
-	mux.Use(middleware.Recoverer)
-	mux.Use(WriteToConsole)
-	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(RequestLogger)
+	mux.Use(NoSurf)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
@@ -36,10 +46,15 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/availability-calendar", handlers.Repo.AvailabilityCalendar)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
+	mux.Get("/make-payment", handlers.Repo.Payment)
+	mux.Post("/make-payment", handlers.Repo.PostPayment)
+	mux.Post("/payments/webhook", handlers.Repo.PaymentWebhook)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
 
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
@@ -63,19 +78,59 @@ func routes(app *config.AppConfig) http.Handler {
 	// fileServer ищет css/style.css в ./static/ и отдаёт файл.
 
 	mux.Route("/admin", func(mux chi.Router) {
-		//mux.Use(Auth)
+		mux.Use(Auth)
+		mux.Use(AdminAccess)
 
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
 		mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
+		mux.Get("/reservations-timeline", handlers.Repo.AdminReservationsTimeline)
+		mux.Get("/reservations-timeline/data", handlers.Repo.AdminReservationsTimelineJSON)
+		mux.Post("/reservations-timeline", handlers.Repo.AdminPostReservationsTimeline)
+		mux.Get("/front-desk", handlers.Repo.AdminFrontDesk)
+		mux.Post("/front-desk/{id}/check-in", handlers.Repo.AdminPostCheckIn)
+		mux.Post("/front-desk/{id}/check-out", handlers.Repo.AdminPostCheckOut)
+		mux.Post("/front-desk/{id}/no-show", handlers.Repo.AdminPostNoShow)
+		mux.Get("/housekeeping", handlers.Repo.AdminHousekeeping)
+		mux.Post("/housekeeping/generate", handlers.Repo.AdminPostHousekeepingGenerate)
+		mux.Post("/housekeeping/{id}", handlers.Repo.AdminPostHousekeepingTask)
+		mux.Get("/maintenance", handlers.Repo.AdminMaintenance)
+		mux.Get("/maintenance/{id}", handlers.Repo.AdminMaintenanceTicket)
+		mux.Post("/maintenance/{id}", handlers.Repo.AdminPostMaintenanceTicket)
 		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Post("/cancel-reservation/{src}/{id}/do", handlers.Repo.AdminCancelReservation)
+		mux.Post("/refund-payment/{src}/{id}/do", handlers.Repo.AdminRefundPayment)
 
+		mux.Get("/reservations/new", handlers.Repo.AdminNewReservation)
+		mux.Post("/reservations/new", handlers.Repo.AdminPostNewReservation)
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
+		mux.Get("/reservations/{src}/{id}/invoice", handlers.Repo.AdminReservationInvoice)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+
+		mux.Get("/stay-rules", handlers.Repo.AdminStayRules)
+		mux.Post("/stay-rules", handlers.Repo.AdminPostStayRules)
+		mux.Post("/stay-rules/{id}/delete", handlers.Repo.AdminDeleteStayRule)
+
+		mux.Get("/taxes", handlers.Repo.AdminTaxRules)
+		mux.Post("/taxes", handlers.Repo.AdminPostTaxRules)
+		mux.Post("/taxes/{id}/delete", handlers.Repo.AdminDeleteTaxRule)
+
+		mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+		mux.Get("/promo-codes/{id}", handlers.Repo.AdminPromoCode)
+		mux.Post("/promo-codes/{id}", handlers.Repo.AdminPostPromoCode)
+		mux.Post("/promo-codes/{id}/delete", handlers.Repo.AdminDeletePromoCode)
+		mux.Get("/promo-codes/{id}/usage", handlers.Repo.AdminPromoCodeUsage)
+
+		mux.Get("/audit-log", handlers.Repo.AdminAuditLog)
+
+		mux.Get("/reports", handlers.Repo.AdminReports)
+		mux.Get("/reports/{report}/{format}", handlers.Repo.AdminReportExport)
 	})
 
-	return mux
+	root.Mount("/", mux)
+
+	return root
 }
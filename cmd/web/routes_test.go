@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/metrics"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestRoutes(t *testing.T) {
 	var app config.AppConfig
+	app.Metrics = metrics.New()
 
 	mux := routes(&app)
 
@@ -19,3 +23,28 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux type is %T", v))
 	}
 }
+
+func TestRoutes_Health(t *testing.T) {
+	var app config.AppConfig
+	app.Metrics = metrics.New()
+
+	mux := routes(&app)
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %d", path, rr.Code)
+		}
+
+		// служебные маршруты не должны заводить сессию
+		if rr.Header().Get("Set-Cookie") != "" {
+			t.Errorf("%s: got a session cookie", path)
+		}
+	}
+
+	if v := app.Metrics.Requests.Value("GET", "/healthz", "200"); v != 1 {
+		t.Errorf("got %v /healthz requests in metrics, want 1", v)
+	}
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/krasnov23/guest-house-golang/internal/models"
 	mail "github.com/xhit/go-simple-mail/v2"
-	"log"
+	"net"
+	"net/smtp"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// почтовый сервер (в разработке - mailhog из docker-compose)
+const (
+	mailHost = "localhost"
+	mailPort = 1025
+)
+
 func listenForMail() {
 
 	go func() {
@@ -22,16 +31,25 @@ func listenForMail() {
 }
 
 func sendMessage(m models.MailData) {
+	// письмо пишет в лог запроса, из которого отправлено
+	logger := m.Logger
+	if logger == nil {
+		logger = app.Logger
+	}
+	logger = logger.With("to", m.To, "subject", m.Subject)
+
 	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
+	server.Host = mailHost
+	server.Port = mailPort
 	server.KeepAlive = false
 	server.ConnectTimeout = 10 * time.Second
 	server.SendTimeout = 10 * time.Second
 
 	client, err := server.Connect()
 	if err != nil {
-		errorLog.Println(err)
+		logger.Error("cannot connect to mail server", "error", err)
+		app.Metrics.MailFailures.Inc("connect")
+		return
 	}
 
 	email := mail.NewMSG()
@@ -44,7 +62,7 @@ func sendMessage(m models.MailData) {
 		data, err := os.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
 
 		if err != nil {
-			app.ErrorLog.Println(err)
+			logger.Error("cannot read mail template", "template", m.Template, "error", err)
 		}
 
 		mailTemplate := string(data)
@@ -52,11 +70,38 @@ func sendMessage(m models.MailData) {
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
 
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.MimeType, Data: a.Data})
+	}
+
 	err = email.Send(client)
 
 	if err != nil {
-		log.Println(err)
+		logger.Error("cannot send email", "error", err)
+		app.Metrics.MailFailures.Inc("send")
 	} else {
-		log.Println("Email sent")
+		logger.Info("email sent")
+		app.Metrics.MailSent.Inc()
+	}
+}
+
+// pingMailServer проверяет, что почтовый сервер принимает соединения и отвечает по SMTP
+func pingMailServer(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(mailHost, strconv.Itoa(mailPort)))
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
 	}
+
+	c, err := smtp.NewClient(conn, mailHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return c.Quit()
 }
@@ -0,0 +1,39 @@
+package access
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
+)
+
+// RoleAdmin - роль администратора, ему доступна вся админка
+const RoleAdmin = "admin"
+
+// Allowed проверяет, можно ли пользователю с ролью role выполнить запрос method path в админке.
+// Горничным доступна только доска уборки: посмотреть задачи и поменять их состояние
+func Allowed(role, method, path string) bool {
+	switch role {
+	case RoleAdmin:
+		return true
+	case housekeeping.Role:
+		if method == http.MethodGet {
+			return path == "/admin/housekeeping"
+		}
+
+		id, ok := strings.CutPrefix(path, "/admin/housekeeping/")
+
+		return method == http.MethodPost && ok && id != "" && strings.Trim(id, "0123456789") == ""
+	default:
+		return false
+	}
+}
+
+// Home возвращает страницу админки, с которой начинает работу пользователь с ролью role
+func Home(role string) string {
+	if role == housekeeping.Role {
+		return "/admin/housekeeping"
+	}
+
+	return "/admin/dashboard"
+}
@@ -0,0 +1,44 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
+)
+
+func TestAllowed(t *testing.T) {
+	var tests = []struct {
+		name   string
+		role   string
+		method string
+		path   string
+		want   bool
+	}{
+		{"admin-dashboard", RoleAdmin, "GET", "/admin/dashboard", true},
+		{"admin-delete", RoleAdmin, "POST", "/admin/promo-codes/1/delete", true},
+		{"housekeeping-board", housekeeping.Role, "GET", "/admin/housekeeping", true},
+		{"housekeeping-task", housekeeping.Role, "POST", "/admin/housekeeping/12", true},
+		{"housekeeping-generate", housekeeping.Role, "POST", "/admin/housekeeping/generate", false},
+		{"housekeeping-dashboard", housekeeping.Role, "GET", "/admin/dashboard", false},
+		{"housekeeping-reservations", housekeeping.Role, "GET", "/admin/reservations-all", false},
+		{"housekeeping-task-get", housekeeping.Role, "GET", "/admin/housekeeping/12", false},
+		{"no-role", "", "GET", "/admin/housekeeping", false},
+		{"unknown-role", "guest", "GET", "/admin/dashboard", false},
+	}
+
+	for _, e := range tests {
+		if got := Allowed(e.role, e.method, e.path); got != e.want {
+			t.Errorf("failed %s: got %v, want %v", e.name, got, e.want)
+		}
+	}
+}
+
+func TestHome(t *testing.T) {
+	if h := Home(housekeeping.Role); h != "/admin/housekeeping" {
+		t.Errorf("housekeeping: got %s", h)
+	}
+
+	if h := Home(RoleAdmin); h != "/admin/dashboard" {
+		t.Errorf("admin: got %s", h)
+	}
+}
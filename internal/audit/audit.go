@@ -0,0 +1,400 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Сущности, изменения которых пишутся в журнал
+const (
+	EntityReservation  = "reservation"
+	EntityRoomBlock    = "room_block"
+	EntityWaitlist     = "waitlist_entry"
+	EntityHousekeeping = "housekeeping_task"
+	EntityMaintenance  = "maintenance_ticket"
+	EntityPayment      = "payment"
+	EntityStayRule     = "stay_rule"
+	EntityTaxRule      = "tax_rule"
+	EntityPromoCode    = "promo_code"
+)
+
+// Entities - все сущности, для фильтра на странице журнала
+var Entities = []string{EntityReservation, EntityRoomBlock, EntityWaitlist, EntityHousekeeping, EntityMaintenance,
+	EntityPayment, EntityStayRule, EntityTaxRule, EntityPromoCode}
+
+// Действия
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionMove     = "move"
+	ActionProcess  = "process"
+	ActionCancel   = "cancel"
+	ActionDelete   = "delete"
+	ActionCheckIn  = "check_in"
+	ActionCheckOut = "check_out"
+	ActionNoShow   = "no_show"
+	ActionRefund   = "refund"
+)
+
+// Actions - все действия, для фильтра на странице журнала
+var Actions = []string{ActionCreate, ActionUpdate, ActionMove, ActionProcess, ActionCancel, ActionDelete,
+	ActionCheckIn, ActionCheckOut, ActionNoShow, ActionRefund}
+
+// PerPage - записей на странице журнала
+const PerPage = 50
+
+// reservation - поля бронирования, которые сохраняются в журнале
+type reservation struct {
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	RoomID      int    `json:"room_id"`
+	Guests      int    `json:"guests"`
+	Processed   int    `json:"processed"`
+	Source      string `json:"source"`
+	Nationality string `json:"nationality"`
+	Cancelled   bool   `json:"cancelled"`
+	CheckedIn   string `json:"checked_in"`
+	CheckedOut  string `json:"checked_out"`
+	NoShow      bool   `json:"no_show"`
+	IDDocument  string `json:"id_document"`
+}
+
+// block - поля блокировки комнаты
+type block struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// waitlist - поля записи листа ожидания
+type waitlist struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	RoomID    int    `json:"room_id"`
+}
+
+// housekeeping - поля задачи уборки
+type housekeeping struct {
+	RoomID     int    `json:"room_id"`
+	TaskDate   string `json:"task_date"`
+	Kind       string `json:"kind"`
+	Status     string `json:"status"`
+	AssignedTo int    `json:"assigned_to"`
+}
+
+// maintenance - поля заявки на ремонт
+type maintenance struct {
+	RoomID             int    `json:"room_id"`
+	Description        string `json:"description"`
+	Priority           string `json:"priority"`
+	Status             string `json:"status"`
+	OutOfOrder         bool   `json:"out_of_order"`
+	StartDate          string `json:"start_date"`
+	ExpectedResolution string `json:"expected_resolution"`
+}
+
+// payment - поля платежа
+type payment struct {
+	ReservationID  int    `json:"reservation_id"`
+	Provider       string `json:"provider"`
+	ProviderRef    string `json:"provider_ref"`
+	Kind           string `json:"kind"`
+	Amount         int    `json:"amount"`
+	RefundedAmount int    `json:"refunded_amount"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+}
+
+// stayRule - поля правила проживания
+type stayRule struct {
+	RuleName       string `json:"rule_name"`
+	RoomID         int    `json:"room_id"`
+	SeasonStart    string `json:"season_start"`
+	SeasonEnd      string `json:"season_end"`
+	MinNights      int    `json:"min_nights"`
+	MaxNights      int    `json:"max_nights"`
+	ArrivalDays    int    `json:"arrival_days"`
+	DepartureDays  int    `json:"departure_days"`
+	MinLeadDays    int    `json:"min_lead_days"`
+	MaxAdvanceDays int    `json:"max_advance_days"`
+}
+
+// taxRule - поля налога или сбора
+type taxRule struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Calculation string `json:"calculation"`
+	Amount      int    `json:"amount"`
+	Per         string `json:"per"`
+	ValidFrom   string `json:"valid_from"`
+	ValidTo     string `json:"valid_to"`
+}
+
+// promoCode - поля промокода
+type promoCode struct {
+	Code         string `json:"code"`
+	Description  string `json:"description"`
+	Calculation  string `json:"calculation"`
+	Amount       int    `json:"amount"`
+	ValidFrom    string `json:"valid_from"`
+	ValidTo      string `json:"valid_to"`
+	StayFrom     string `json:"stay_from"`
+	StayTo       string `json:"stay_to"`
+	RoomID       int    `json:"room_id"`
+	MaxUses      int    `json:"max_uses"`
+	OncePerGuest bool   `json:"once_per_guest"`
+	Active       bool   `json:"active"`
+}
+
+// Reservation возвращает состояние бронирования для записи в журнал
+func Reservation(res models.Reservation) string {
+	return marshal(reservation{
+		FirstName:   res.FirstName,
+		LastName:    res.LastName,
+		Email:       res.Email,
+		Phone:       res.Phone,
+		StartDate:   res.StartDate.Format("2006-01-02"),
+		EndDate:     res.EndDate.Format("2006-01-02"),
+		RoomID:      res.RoomID,
+		Guests:      res.Guests,
+		Processed:   res.Processed,
+		Source:      res.Source,
+		Nationality: res.Nationality,
+		Cancelled:   !res.CancelledAt.IsZero(),
+		CheckedIn:   stamp(res.CheckedInAt),
+		CheckedOut:  stamp(res.CheckedOutAt),
+		NoShow:      !res.NoShowAt.IsZero(),
+		IDDocument:  strings.TrimSpace(res.IDDocumentType + " " + res.IDDocumentNumber),
+	})
+}
+
+// Block возвращает состояние блокировки комнаты для записи в журнал
+func Block(rr models.RoomRestriction) string {
+	return marshal(block{
+		RoomID:    rr.RoomID,
+		StartDate: rr.StartDate.Format("2006-01-02"),
+		EndDate:   rr.EndDate.Format("2006-01-02"),
+	})
+}
+
+// Waitlist возвращает состояние записи листа ожидания для записи в журнал
+func Waitlist(e models.WaitlistEntry) string {
+	return marshal(waitlist{
+		Name:      e.Name,
+		Email:     e.Email,
+		StartDate: e.StartDate.Format("2006-01-02"),
+		EndDate:   e.EndDate.Format("2006-01-02"),
+		RoomID:    e.RoomID,
+	})
+}
+
+// stamp форматирует время отметки, пустая строка - отметки нет
+func stamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02 15:04")
+}
+
+// Housekeeping возвращает состояние задачи уборки для записи в журнал
+func Housekeeping(t models.HousekeepingTask) string {
+	return marshal(housekeeping{
+		RoomID:     t.RoomID,
+		TaskDate:   t.TaskDate.Format("2006-01-02"),
+		Kind:       t.Kind,
+		Status:     t.Status,
+		AssignedTo: t.AssignedTo,
+	})
+}
+
+// Maintenance возвращает состояние заявки на ремонт для записи в журнал
+func Maintenance(t models.MaintenanceTicket) string {
+	expected := ""
+	if !t.ExpectedResolution.IsZero() {
+		expected = t.ExpectedResolution.Format("2006-01-02")
+	}
+
+	return marshal(maintenance{
+		RoomID:             t.RoomID,
+		Description:        t.Description,
+		Priority:           t.Priority,
+		Status:             t.Status,
+		OutOfOrder:         t.OutOfOrder,
+		StartDate:          t.StartDate.Format("2006-01-02"),
+		ExpectedResolution: expected,
+	})
+}
+
+// Payment возвращает состояние платежа для записи в журнал
+func Payment(p models.Payment) string {
+	return marshal(payment{
+		ReservationID:  p.ReservationID,
+		Provider:       p.Provider,
+		ProviderRef:    p.ProviderRef,
+		Kind:           p.Kind,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Currency:       p.Currency,
+		Status:         p.Status,
+	})
+}
+
+// StayRule возвращает состояние правила проживания для записи в журнал
+func StayRule(rule models.StayRule) string {
+	return marshal(stayRule{
+		RuleName:       rule.RuleName,
+		RoomID:         rule.RoomID,
+		SeasonStart:    date(rule.SeasonStart),
+		SeasonEnd:      date(rule.SeasonEnd),
+		MinNights:      rule.MinNights,
+		MaxNights:      rule.MaxNights,
+		ArrivalDays:    rule.ArrivalDays,
+		DepartureDays:  rule.DepartureDays,
+		MinLeadDays:    rule.MinLeadDays,
+		MaxAdvanceDays: rule.MaxAdvanceDays,
+	})
+}
+
+// TaxRule возвращает состояние налога или сбора для записи в журнал
+func TaxRule(rule models.TaxRule) string {
+	return marshal(taxRule{
+		Name:        rule.Name,
+		Kind:        rule.Kind,
+		Calculation: rule.Calculation,
+		Amount:      rule.Amount,
+		Per:         rule.Per,
+		ValidFrom:   date(rule.ValidFrom),
+		ValidTo:     date(rule.ValidTo),
+	})
+}
+
+// PromoCode возвращает состояние промокода для записи в журнал
+func PromoCode(p models.PromoCode) string {
+	return marshal(promoCode{
+		Code:         p.Code,
+		Description:  p.Description,
+		Calculation:  p.Calculation,
+		Amount:       p.Amount,
+		ValidFrom:    date(p.ValidFrom),
+		ValidTo:      date(p.ValidTo),
+		StayFrom:     date(p.StayFrom),
+		StayTo:       date(p.StayTo),
+		RoomID:       p.RoomID,
+		MaxUses:      p.MaxUses,
+		OncePerGuest: p.OncePerGuest,
+		Active:       p.Active,
+	})
+}
+
+// date форматирует необязательную дату, пустая строка - дата не задана
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02")
+}
+
+func marshal(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(out)
+}
+
+// IP возвращает адрес клиента без порта
+func IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// Change - изменение одного поля
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Changes сравнивает состояния до и после и возвращает изменившиеся поля, отсортированные по имени.
+// Если одного из состояний нет (создание или удаление), возвращаются все поля другого
+func Changes(before, after string) []Change {
+	b := fields(before)
+	a := fields(after)
+
+	var changes []Change
+
+	for k, v := range a {
+		if old, ok := b[k]; !ok || old != v {
+			changes = append(changes, Change{Field: k, Before: b[k], After: v})
+		}
+	}
+
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, Change{Field: k, Before: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+// Row - запись журнала с изменившимися полями, для страницы журнала
+type Row struct {
+	Entry   models.AuditEntry
+	Changes []Change
+}
+
+// Rows готовит записи журнала к показу
+func Rows(entries []models.AuditEntry) []Row {
+	rows := make([]Row, 0, len(entries))
+
+	for _, e := range entries {
+		rows = append(rows, Row{Entry: e, Changes: Changes(e.Before, e.After)})
+	}
+
+	return rows
+}
+
+// fields разбирает JSON-объект в поля со строковыми значениями
+func fields(s string) map[string]string {
+	result := make(map[string]string)
+
+	if s == "" {
+		return result
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return result
+	}
+
+	for k, v := range m {
+		result[k] = fmt.Sprint(v)
+	}
+
+	return result
+}
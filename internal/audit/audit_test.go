@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func TestChanges(t *testing.T) {
+	res := models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomID:    1,
+	}
+
+	before := Reservation(res)
+
+	res.RoomID = 2
+	res.EndDate = time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC)
+
+	changes := Changes(before, Reservation(res))
+
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+
+	if changes[0] != (Change{"end_date", "2050-01-03", "2050-01-04"}) || changes[1] != (Change{"room_id", "1", "2"}) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	// создание - все поля нового состояния
+	if created := Changes("", Block(models.RoomRestriction{RoomID: 1})); len(created) != 3 || created[0].Before != "" {
+		t.Errorf("unexpected changes %+v", created)
+	}
+
+	// удаление - все поля прежнего состояния
+	if deleted := Changes(before, ""); len(deleted) != len(fields(before)) || deleted[0].After != "" {
+		t.Errorf("unexpected changes %+v", deleted)
+	}
+}
+
+func TestIP(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	r.RemoteAddr = "10.0.0.1:5432"
+	if ip := IP(r); ip != "10.0.0.1" {
+		t.Errorf("got %s", ip)
+	}
+
+	r.RemoteAddr = "[::1]:5432"
+	if ip := IP(r); ip != "::1" {
+		t.Errorf("got %s", ip)
+	}
+}
@@ -0,0 +1,127 @@
+package availability
+
+import (
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+const layout = "2006-01-02"
+
+// Window - свободный период в конкретной комнате, который можно предложить гостю
+type Window struct {
+	RoomID    int
+	RoomName  string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// Nights возвращает количество ночей в предложенном периоде
+func (w Window) Nights() int {
+	return int(w.EndDate.Sub(w.StartDate).Hours() / 24)
+}
+
+// BusyNights собирает занятые ночи комнаты из ограничений (бронирований и блокировок).
+// Ночь d занята если start_date <= d < end_date, ключ мапы - дата в формате 2006-01-02
+func BusyNights(restrictions []models.RoomRestriction) map[string]bool {
+	busy := make(map[string]bool)
+
+	for _, rr := range restrictions {
+		for d := rr.StartDate; d.Before(rr.EndDate); d = d.AddDate(0, 0, 1) {
+			busy[d.Format(layout)] = true
+		}
+	}
+
+	return busy
+}
+
+// IsFree проверяет что все ночи с start по end (не включая end) свободны
+func IsFree(busy map[string]bool, start, end time.Time) bool {
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if busy[d.Format(layout)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NearestWindows ищет ближайший свободный период той же длины раньше и позже запрошенных дат,
+// сдвигая период не больше чем на radius дней. Периоды с заездом раньше earliest не предлагаются
+func NearestWindows(room models.Room, busy map[string]bool, start, end time.Time, radius int, earliest time.Time) []Window {
+	var windows []Window
+
+	nights := int(end.Sub(start).Hours() / 24)
+
+	// сначала ищем раньше запрошенных дат, затем позже
+	for _, direction := range []int{-1, 1} {
+		for offset := 1; offset <= radius; offset++ {
+			s := start.AddDate(0, 0, direction*offset)
+			e := s.AddDate(0, 0, nights)
+
+			if s.Before(earliest) {
+				break
+			}
+
+			if IsFree(busy, s, e) {
+				windows = append(windows, Window{
+					RoomID:    room.ID,
+					RoomName:  room.RoomName,
+					StartDate: s,
+					EndDate:   e,
+				})
+				break
+			}
+		}
+	}
+
+	return windows
+}
+
+// SplitStay пытается разбить проживание на несколько комнат: на каждую ночь выбирается свободная комната,
+// по возможности остаемся в той же комнате, иначе берем ту, что свободна дольше всех.
+// Если хотя бы на одну ночь нет свободных комнат - возвращается nil
+func SplitStay(rooms []models.Room, busy map[int]map[string]bool, start, end time.Time) []Window {
+	var segments []Window
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(layout)
+
+		// продолжаем проживание в текущей комнате, если она свободна
+		if len(segments) > 0 {
+			last := &segments[len(segments)-1]
+			if !busy[last.RoomID][key] {
+				last.EndDate = d.AddDate(0, 0, 1)
+				continue
+			}
+		}
+
+		best := -1
+		bestLength := 0
+
+		for i, room := range rooms {
+			length := 0
+			for x := d; x.Before(end) && !busy[room.ID][x.Format(layout)]; x = x.AddDate(0, 0, 1) {
+				length++
+			}
+
+			if length > bestLength {
+				best = i
+				bestLength = length
+			}
+		}
+
+		if best < 0 {
+			return nil
+		}
+
+		segments = append(segments, Window{
+			RoomID:    rooms[best].ID,
+			RoomName:  rooms[best].RoomName,
+			StartDate: d,
+			EndDate:   d.AddDate(0, 0, 1),
+		})
+	}
+
+	return segments
+}
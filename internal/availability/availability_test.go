@@ -0,0 +1,82 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBusyNights(t *testing.T) {
+	busy := BusyNights([]models.RoomRestriction{
+		{StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 3)},
+	})
+
+	if !busy["2050-01-01"] || !busy["2050-01-02"] {
+		t.Error("nights of the reservation should be busy")
+	}
+
+	// день выезда свободен для следующего заезда
+	if busy["2050-01-03"] {
+		t.Error("departure day should be free")
+	}
+}
+
+func TestNearestWindows(t *testing.T) {
+	room := models.Room{ID: 1, RoomName: "General's Quarters"}
+	busy := BusyNights([]models.RoomRestriction{
+		{StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 5)},
+	})
+
+	windows := NearestWindows(room, busy, date(2050, 1, 2), date(2050, 1, 4), 7, date(2049, 12, 1))
+
+	if len(windows) != 2 {
+		t.Fatalf("got %d windows, want 2", len(windows))
+	}
+
+	if !windows[0].StartDate.Equal(date(2049, 12, 30)) || !windows[0].EndDate.Equal(date(2050, 1, 1)) {
+		t.Errorf("unexpected earlier window %v - %v", windows[0].StartDate, windows[0].EndDate)
+	}
+
+	if !windows[1].StartDate.Equal(date(2050, 1, 5)) || windows[1].Nights() != 2 {
+		t.Errorf("unexpected later window %v - %v", windows[1].StartDate, windows[1].EndDate)
+	}
+
+	// окна раньше earliest не предлагаются, окна дальше radius тоже
+	windows = NearestWindows(room, busy, date(2050, 1, 2), date(2050, 1, 4), 2, date(2050, 1, 1))
+	if len(windows) != 0 {
+		t.Errorf("got %d windows, want 0", len(windows))
+	}
+}
+
+func TestSplitStay(t *testing.T) {
+	rooms := []models.Room{{ID: 1, RoomName: "A"}, {ID: 2, RoomName: "B"}}
+	busy := map[int]map[string]bool{
+		1: BusyNights([]models.RoomRestriction{{StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 3)}}),
+		2: BusyNights([]models.RoomRestriction{{StartDate: date(2050, 1, 3), EndDate: date(2050, 1, 8)}}),
+	}
+
+	segments := SplitStay(rooms, busy, date(2050, 1, 1), date(2050, 1, 5))
+
+	if len(segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(segments))
+	}
+
+	if segments[0].RoomID != 2 || !segments[0].EndDate.Equal(date(2050, 1, 3)) {
+		t.Errorf("unexpected first segment %+v", segments[0])
+	}
+
+	if segments[1].RoomID != 1 || !segments[1].StartDate.Equal(date(2050, 1, 3)) || !segments[1].EndDate.Equal(date(2050, 1, 5)) {
+		t.Errorf("unexpected second segment %+v", segments[1])
+	}
+
+	// в ночь на 2050-01-02 и 2050-01-03 обе комнаты заняты
+	busy[2]["2050-01-02"] = true
+	if SplitStay(rooms, busy, date(2050, 1, 1), date(2050, 1, 5)) != nil {
+		t.Error("split stay should not be possible")
+	}
+}
@@ -0,0 +1,111 @@
+package blocks
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Version возвращает отпечаток блокировок комнаты. Календарь отправляет его вместе с изменениями,
+// и если блокировки за это время поменялись, изменения не применяются. Блокировки заявок на ремонт
+// меняются вместе с заявкой и в отпечаток не входят
+func Version(restrictions []models.RoomRestriction) string {
+	var keys []string
+
+	for _, rr := range restrictions {
+		if rr.ReservationID > 0 || rr.MaintenanceTicketID > 0 {
+			continue
+		}
+
+		keys = append(keys, fmt.Sprintf("%d:%s:%s", rr.ID, rr.StartDate.Format("2006-01-02"), rr.EndDate.Format("2006-01-02")))
+	}
+
+	sort.Strings(keys)
+
+	h := sha1.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Days возвращает заблокированные в календаре дни комнаты в виде "2006-01-02" -> ID блокировки
+func Days(restrictions []models.RoomRestriction) map[string]int {
+	days := make(map[string]int)
+
+	for _, rr := range restrictions {
+		if rr.ReservationID > 0 || rr.MaintenanceTicketID > 0 {
+			continue
+		}
+
+		for d := rr.StartDate; d.Before(rr.EndDate); d = d.AddDate(0, 0, 1) {
+			days[d.Format("2006-01-02")] = rr.ID
+		}
+	}
+
+	return days
+}
+
+// Change - изменения блокировок одной комнаты, присланные из календаря
+type Change struct {
+	RoomID  int
+	Version string
+	// Shown - блокировки, которые видел администратор: день -> ID
+	Shown map[string]int
+	// Kept - дни из Shown, у которых флажок блокировки остался отмеченным
+	Kept map[string]bool
+	// Added - дни, которые заблокировали
+	Added []time.Time
+}
+
+// Plan сверяет изменения с текущими ограничениями комнаты и возвращает ID снимаемых блокировок,
+// новые блокировки и конфликты. Если есть конфликты, изменения комнаты применять нельзя
+func Plan(c Change, current []models.RoomRestriction) (remove []int, add []models.RoomRestriction, conflicts []string) {
+	if c.Version != Version(current) {
+		return nil, nil, []string{"blocks were changed by someone else"}
+	}
+
+	days := Days(current)
+
+	for day, id := range c.Shown {
+		if days[day] != id {
+			conflicts = append(conflicts, fmt.Sprintf("block on %s no longer exists", day))
+			continue
+		}
+
+		if !c.Kept[day] {
+			remove = append(remove, id)
+		}
+	}
+
+	for _, day := range c.Added {
+		for _, rr := range current {
+			if !rr.StartDate.After(day) && rr.EndDate.After(day) {
+				conflicts = append(conflicts, fmt.Sprintf("%s is already taken", day.Format("2006-01-02")))
+				break
+			}
+		}
+
+		add = append(add, models.RoomRestriction{
+			RoomID:        c.RoomID,
+			StartDate:     day,
+			EndDate:       day.AddDate(0, 0, 1),
+			RestrictionID: 2,
+		})
+	}
+
+	sort.Ints(remove)
+	sort.Strings(conflicts)
+
+	if len(conflicts) > 0 {
+		return nil, nil, conflicts
+	}
+
+	return remove, add, nil
+}
@@ -0,0 +1,85 @@
+package blocks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var current = []models.RoomRestriction{
+	{ID: 1, RoomID: 1, ReservationID: 7, RestrictionID: 1, StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 4)},
+	{ID: 2, RoomID: 1, RestrictionID: 2, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 11)},
+	{ID: 3, RoomID: 1, RestrictionID: 2, StartDate: date(2050, 1, 12), EndDate: date(2050, 1, 13)},
+}
+
+func TestVersion(t *testing.T) {
+	v := Version(current)
+
+	// бронирования и порядок не влияют на версию
+	reordered := []models.RoomRestriction{current[2], current[1]}
+	if Version(reordered) != v {
+		t.Error("version depends on order or reservations")
+	}
+
+	if Version(current[:2]) == v {
+		t.Error("version did not change after a block was removed")
+	}
+
+	// блокировка заявки на ремонт меняется вместе с заявкой
+	withTicket := append([]models.RoomRestriction{{ID: 4, RoomID: 1, RestrictionID: 2, MaintenanceTicketID: 1,
+		StartDate: date(2050, 1, 20), EndDate: date(2050, 1, 25)}}, current...)
+	if Version(withTicket) != v {
+		t.Error("version depends on maintenance blocks")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	shown := map[string]int{"2050-01-10": 2, "2050-01-12": 3}
+
+	remove, add, conflicts := Plan(Change{
+		RoomID:  1,
+		Version: Version(current),
+		Shown:   shown,
+		Kept:    map[string]bool{"2050-01-12": true},
+		Added:   []time.Time{date(2050, 1, 20)},
+	}, current)
+
+	if len(conflicts) > 0 || len(remove) != 1 || remove[0] != 2 || len(add) != 1 || !add[0].StartDate.Equal(date(2050, 1, 20)) {
+		t.Errorf("unexpected plan %v %v %v", remove, add, conflicts)
+	}
+
+	// устаревшая версия - ничего не применяется
+	_, _, conflicts = Plan(Change{RoomID: 1, Version: "old", Shown: shown}, current)
+	if len(conflicts) != 1 {
+		t.Errorf("expected version conflict, got %v", conflicts)
+	}
+
+	// блокировка на занятый бронированием день
+	remove, add, conflicts = Plan(Change{
+		RoomID:  1,
+		Version: Version(current),
+		Shown:   shown,
+		Kept:    map[string]bool{"2050-01-10": true, "2050-01-12": true},
+		Added:   []time.Time{date(2050, 1, 2)},
+	}, current)
+
+	if len(conflicts) != 1 || conflicts[0] != "2050-01-02 is already taken" || remove != nil || add != nil {
+		t.Errorf("unexpected plan %v %v %v", remove, add, conflicts)
+	}
+
+	// ID блокировки не совпадает с текущим
+	_, _, conflicts = Plan(Change{
+		RoomID:  1,
+		Version: Version(current),
+		Shown:   map[string]int{"2050-01-10": 5},
+	}, current)
+
+	if len(conflicts) != 1 {
+		t.Errorf("expected conflict, got %v", conflicts)
+	}
+}
@@ -2,18 +2,33 @@ package config
 
 import (
 	"github.com/alexedwards/scs/v2"
+	"github.com/krasnov23/guest-house-golang/internal/metrics"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
 	"html/template"
-	"log"
+	"log/slog"
+	"time"
 )
 
 // AppConfig holds the application config
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	// Logger - логгер приложения (JSON), в обработчиках используется логгер запроса из контекста
+	Logger *slog.Logger
+	// Metrics - метрики для /metrics в формате Prometheus
+	Metrics      *metrics.App
+	InProduction bool
+	Session      *scs.SessionManager
+	MailChan     chan models.MailData
+	// SuggestionDays - на сколько дней раньше/позже искать свободные даты, если на запрошенные мест нет
+	SuggestionDays int
+	// Payments - платежная система, DepositPercent - размер депозита в процентах от стоимости проживания
+	Payments       payments.Provider
+	DepositPercent int
+	Currency       string
+	// BaseURL - адрес сайта для ссылок в письмах
+	BaseURL string
+	// DBQueryTimeout - сколько ждать ответа на один запрос к БД
+	DBQueryTimeout time.Duration
 }
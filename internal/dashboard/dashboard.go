@@ -0,0 +1,91 @@
+package dashboard
+
+import (
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Day - движение гостей за день: заезды, выезды и гости, которые остаются на ночь
+type Day struct {
+	Arrivals   []models.Reservation
+	Departures []models.Reservation
+	InHouse    []models.Reservation
+}
+
+// Occupancy - загрузка за период: сколько комнато-ночей было доступно и сколько из них забронировано
+type Occupancy struct {
+	Start      time.Time
+	End        time.Time
+	RoomNights int
+	Booked     int
+}
+
+// Percent возвращает загрузку в процентах, округленную вниз
+func (o Occupancy) Percent() int {
+	if o.RoomNights == 0 {
+		return 0
+	}
+
+	return o.Booked * 100 / o.RoomNights
+}
+
+// Pace - темп бронирований: что было забронировано на период к сегодняшнему дню
+// и на тот же период прошлого года к той же дате прошлого года
+type Pace struct {
+	Start                time.Time
+	End                  time.Time
+	Reservations         int
+	Nights               int
+	LastYearReservations int
+	LastYearNights       int
+}
+
+// Change возвращает изменение количества забронированных ночей к прошлому году в процентах.
+// Если в прошлом году бронирований не было, сравнивать не с чем и возвращается 0
+func (p Pace) Change() int {
+	if p.LastYearNights == 0 {
+		return 0
+	}
+
+	return (p.Nights - p.LastYearNights) * 100 / p.LastYearNights
+}
+
+// SplitDay разбирает бронирования, которые захватывают день day (start_date <= day <= end_date),
+// на заезды, выезды и проживающих
+func SplitDay(day time.Time, reservations []models.Reservation) Day {
+	var d Day
+
+	day = Truncate(day)
+
+	for _, r := range reservations {
+		start, end := Truncate(r.StartDate), Truncate(r.EndDate)
+
+		switch {
+		case start.Equal(day):
+			d.Arrivals = append(d.Arrivals, r)
+		case end.Equal(day):
+			d.Departures = append(d.Departures, r)
+		case start.Before(day) && end.After(day):
+			d.InHouse = append(d.InHouse, r)
+		}
+	}
+
+	return d
+}
+
+// Month возвращает первый день месяца, в который попадает t, и первый день следующего месяца
+func Month(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Nights возвращает количество ночей с start по end (не включая end)
+func Nights(start, end time.Time) int {
+	return int(Truncate(end).Sub(Truncate(start)).Hours() / 24)
+}
+
+// Truncate отбрасывает время, оставляя дату в UTC, как даты хранятся в базе
+func Truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,75 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSplitDay(t *testing.T) {
+	day := date(2050, 1, 10)
+
+	d := SplitDay(day.Add(15*time.Hour), []models.Reservation{
+		{ID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 12)},
+		{ID: 2, StartDate: date(2050, 1, 7), EndDate: date(2050, 1, 10)},
+		{ID: 3, StartDate: date(2050, 1, 9), EndDate: date(2050, 1, 11)},
+		// не захватывает день
+		{ID: 4, StartDate: date(2050, 1, 11), EndDate: date(2050, 1, 12)},
+	})
+
+	if len(d.Arrivals) != 1 || d.Arrivals[0].ID != 1 {
+		t.Errorf("unexpected arrivals %+v", d.Arrivals)
+	}
+
+	if len(d.Departures) != 1 || d.Departures[0].ID != 2 {
+		t.Errorf("unexpected departures %+v", d.Departures)
+	}
+
+	if len(d.InHouse) != 1 || d.InHouse[0].ID != 3 {
+		t.Errorf("unexpected in house %+v", d.InHouse)
+	}
+}
+
+func TestMonth(t *testing.T) {
+	start, end := Month(time.Date(2050, 12, 15, 10, 0, 0, 0, time.UTC))
+
+	if !start.Equal(date(2050, 12, 1)) || !end.Equal(date(2051, 1, 1)) {
+		t.Errorf("got %s - %s", start, end)
+	}
+
+	if n := Nights(start, end); n != 31 {
+		t.Errorf("got %d nights, want 31", n)
+	}
+}
+
+func TestOccupancy_Percent(t *testing.T) {
+	if p := (Occupancy{RoomNights: 60, Booked: 15}).Percent(); p != 25 {
+		t.Errorf("got %d%%, want 25%%", p)
+	}
+
+	if p := (Occupancy{}).Percent(); p != 0 {
+		t.Errorf("got %d%% without rooms", p)
+	}
+}
+
+func TestPace_Change(t *testing.T) {
+	var tests = []struct {
+		nights, lastYear, want int
+	}{
+		{10, 8, 25},
+		{6, 8, -25},
+		{5, 0, 0},
+	}
+
+	for _, e := range tests {
+		p := Pace{Nights: e.nights, LastYearNights: e.lastYear}
+		if c := p.Change(); c != e.want {
+			t.Errorf("Change(%d, %d) = %d, want %d", e.nights, e.lastYear, c, e.want)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
+	"sync"
 	"time"
 
 	_ "github.com/jackc/pgconn"
@@ -13,57 +17,163 @@ import (
 
 type DB struct {
 	SQL *sql.DB
+
+	// err - результат последней проверки соединения, nil - БД доступна
+	mu  sync.Mutex
+	err error
 }
 
-var dbConn = &DB{}
+// Options - настройки пула соединений и подключения при старте
+type Options struct {
+	MaxOpenConns    int           // Максимум открытых соединений
+	MaxIdleConns    int           // Сколько соединений держать в режиме ожидания
+	ConnMaxLifetime time.Duration // Макс. время жизни соединения
+
+	// ConnectTimeout - сколько пытаться подключиться при старте (например, пока поднимается контейнер с Postgres)
+	ConnectTimeout time.Duration
+	// RetryInterval - пауза после первой неудачной попытки, дальше она удваивается, но не больше MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
 
-const maxOpenDbConn = 10              // Максимум открытых соединений
-const maxIdleDbConn = 5               // Сколько соединений держать в режиме ожидания
-const maxDbLifetime = 5 * time.Minute // Макс. время жизни соединения
+// DefaultOptions - настройки, если в конфигурации ничего не задано
+func DefaultOptions() Options {
+	return Options{
+		MaxOpenConns:     10,
+		MaxIdleConns:     5,
+		ConnMaxLifetime:  5 * time.Minute,
+		ConnectTimeout:   30 * time.Second,
+		RetryInterval:    500 * time.Millisecond,
+		MaxRetryInterval: 5 * time.Second,
+	}
+}
 
-func ConnectSQL(dsn string) (*DB, error) {
+// ConnectSQL создает пул соединений и ждет, пока БД начнет отвечать: повторяет попытки с растущей паузой,
+// пока не истечет opts.ConnectTimeout
+func ConnectSQL(ctx context.Context, dsn string, opts Options) (*DB, error) {
 	d, err := NewDataBase(dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	d.SetMaxOpenConns(maxOpenDbConn)    // сколько максимум одновременных соединений с БД может держать пул.
-	d.SetMaxIdleConns(maxIdleDbConn)    // сколько "простаивающих" соединений можно держать, чтобы не открывать новые каждый раз. (Например 10 человек зашло к нам , 5 соединений будет закрыто и еще 5 может находится в режиме ожидания не пересоздаваясь)
-	d.SetConnMaxLifetime(maxDbLifetime) // максимальное время жизни соединения (например, чтобы драйвер их время от времени пересоздавал и чистил висяки).
+	d.SetMaxOpenConns(opts.MaxOpenConns)       // сколько максимум одновременных соединений с БД может держать пул.
+	d.SetMaxIdleConns(opts.MaxIdleConns)       // сколько "простаивающих" соединений можно держать, чтобы не открывать новые каждый раз. (Например 10 человек зашло к нам , 5 соединений будет закрыто и еще 5 может находится в режиме ожидания не пересоздаваясь)
+	d.SetConnMaxLifetime(opts.ConnMaxLifetime) // максимальное время жизни соединения (например, чтобы драйвер их время от времени пересоздавал и чистил висяки).
 
-	// пробрасываем наше соединение в свойство SQL типа DB
-	dbConn.SQL = d
+	ctx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancel()
 
-	err = testDB(d)
+	err = retry(ctx, opts, func(ctx context.Context) error {
+		return testDB(ctx, d)
+	})
 	if err != nil {
+		d.Close()
 		return nil, err
 	}
 
-	return dbConn, nil
+	return &DB{SQL: d}, nil
+}
+
+// retry вызывает f, пока она не вернет nil или не истечет ctx; пауза между попытками удваивается
+func retry(ctx context.Context, opts Options, f func(ctx context.Context) error) error {
+	wait := opts.RetryInterval
+
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil {
+			return nil
+		}
+
+		logging.FromContext(ctx).Warn("database is not ready", "attempt", attempt, "retry_in", wait.String(), "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("database is not ready after %d attempts: %w", attempt, err)
+		case <-timer.C:
+		}
+
+		wait *= 2
+		if wait > opts.MaxRetryInterval {
+			wait = opts.MaxRetryInterval
+		}
+	}
 }
 
 // testDB tries to ping the database
-func testDB(d *sql.DB) error {
-	err := d.Ping()
+func testDB(ctx context.Context, d *sql.DB) error {
+	err := d.PingContext(ctx)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Ping проверяет, что БД отвечает, как testDB, но не дольше timeout, и запоминает результат
+func (db *DB) Ping(ctx context.Context, timeout time.Duration) error {
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := testDB(pingCtx, db.SQL)
+
+	// проверку отменил вызывающий (ушел клиент, остановка приложения) - о самой БД это ничего не говорит
+	if ctx.Err() != nil {
+		return err
+	}
+	db.setErr(ctx, err)
+
+	return err
+}
+
+// Err возвращает ошибку последней проверки соединения или nil, если БД доступна
+func (db *DB) Err() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.err
+}
+
+// setErr запоминает результат проверки и пишет в лог, когда БД пропала или вернулась
+func (db *DB) setErr(ctx context.Context, err error) {
+	db.mu.Lock()
+	wasDown := db.err != nil
+	db.err = err
+	db.mu.Unlock()
+
+	switch {
+	case err != nil && !wasDown:
+		logging.FromContext(ctx).Error("database is unavailable", "error", err)
+	case err == nil && wasDown:
+		logging.FromContext(ctx).Info("database connection restored")
+	}
+}
+
+// Monitor пингует БД каждые interval, пока не отменен ctx: при ошибке БД помечается недоступной,
+// при первом успешном ответе - снова доступной. Запускается в отдельной горутине
+func (db *DB) Monitor(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = db.Ping(ctx, timeout)
+		}
+	}
+}
+
 func NewDataBase(dsn string) (*sql.DB, error) {
 
 	//Создаётся пул соединений к базе данных (через драйвер pgx) с использованием DSN (строка подключения).
-	//⚠ sql.Open не открывает сразу соединение — оно лишь подготавливает пул.
+	//⚠ sql.Open не открывает сразу соединение — оно лишь подготавливает пул, поэтому
+	// доступность БД проверяет ConnectSQL (с повторами).
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	// Тут уже реально выполняется подключение к базе (через PING). Если неудачно (неверный DSN, база недоступна и т.д.) → ошибка.
-	if err = db.Ping(); err != nil {
-		return nil, err
-	}
-
 	return db, nil
 }
@@ -0,0 +1,125 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeConnector - "БД", которую можно выключать и включать
+type fakeConnector struct {
+	down atomic.Bool
+}
+
+type fakeConn struct{}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return fakeConn{}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver { return nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func TestRetry(t *testing.T) {
+	opts := Options{RetryInterval: time.Millisecond, MaxRetryInterval: 4 * time.Millisecond}
+
+	calls := 0
+	err := retry(context.Background(), opts, func(ctx context.Context) error {
+		calls++
+		if calls < 4 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+
+	if err != nil || calls != 4 {
+		t.Errorf("got %v after %d calls, want success after 4", err, calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	down := errors.New("connection refused")
+	err = retry(ctx, opts, func(ctx context.Context) error { return down })
+
+	if !errors.Is(err, down) {
+		t.Errorf("got %v, want the last connect error", err)
+	}
+}
+
+func TestDB_Ping(t *testing.T) {
+	c := &fakeConnector{}
+	db := &DB{SQL: sql.OpenDB(c)}
+	defer db.SQL.Close()
+
+	if err := db.Ping(context.Background(), time.Second); err != nil || db.Err() != nil {
+		t.Fatalf("got %v, want a healthy database", err)
+	}
+
+	c.down.Store(true)
+	// закрываем простаивающие соединения, иначе пинг пройдет по уже открытому
+	db.SQL.SetMaxIdleConns(0)
+
+	if err := db.Ping(context.Background(), time.Second); err == nil || db.Err() == nil {
+		t.Error("database should be marked unavailable")
+	}
+
+	// отмененная вызывающим проверка не меняет состояние
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.down.Store(false)
+	_ = db.Ping(ctx, time.Second)
+	if db.Err() == nil {
+		t.Error("cancelled ping should not change the state")
+	}
+
+	if err := db.Ping(context.Background(), time.Second); err != nil || db.Err() != nil {
+		t.Errorf("got %v, database should recover", err)
+	}
+}
+
+func TestDB_Monitor(t *testing.T) {
+	c := &fakeConnector{}
+	c.down.Store(true)
+
+	db := &DB{SQL: sql.OpenDB(c)}
+	defer db.SQL.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		db.Monitor(ctx, time.Millisecond, time.Second)
+		close(done)
+	}()
+
+	waitFor := func(healthy bool) {
+		deadline := time.Now().Add(time.Second)
+		for (db.Err() == nil) != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("database healthy=%v, want %v", db.Err() == nil, healthy)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor(false)
+	c.down.Store(false)
+	waitFor(true)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("monitor did not stop")
+	}
+}
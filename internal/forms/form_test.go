@@ -119,3 +119,38 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("Errors is exist")
 	}
 }
+
+func TestForm_IsInt(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("good", "12")
+	postedData.Add("bad", "abc")
+	postedData.Add("negative", "-1")
+	form := New(postedData)
+
+	form.IsInt("good", "empty")
+	if !form.Valid() {
+		t.Error("got an error for a valid number or an empty field")
+	}
+
+	form.IsInt("bad", "negative")
+	if form.Errors.Get("bad") == "" || form.Errors.Get("negative") == "" {
+		t.Error("expected errors for invalid numbers")
+	}
+}
+
+func TestForm_IsDate(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("good", "2050-01-01")
+	postedData.Add("bad", "01.01.2050")
+	form := New(postedData)
+
+	form.IsDate("good", "empty")
+	if !form.Valid() {
+		t.Error("got an error for a valid date or an empty field")
+	}
+
+	form.IsDate("bad")
+	if form.Errors.Get("bad") == "" {
+		t.Error("expected error for invalid date")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/asaskevich/govalidator"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Пользовательская структура формы, встраивает объектurl.Values
@@ -58,6 +60,34 @@ func (f *Form) IsEmail(field string) {
 	}
 }
 
+// IsInt проверяет что непустое поле является целым неотрицательным числом
+func (f *Form) IsInt(fields ...string) {
+	for _, field := range fields {
+		x := f.Get(field)
+		if x == "" {
+			continue
+		}
+
+		if n, err := strconv.Atoi(x); err != nil || n < 0 {
+			f.Errors.Add(field, "This field must be a whole number, 0 or more.")
+		}
+	}
+}
+
+// IsDate проверяет что непустое поле является датой в формате 2006-01-02
+func (f *Form) IsDate(fields ...string) {
+	for _, field := range fields {
+		x := f.Get(field)
+		if x == "" {
+			continue
+		}
+
+		if _, err := time.Parse("2006-01-02", x); err != nil {
+			f.Errors.Add(field, "This field must be a date in format YYYY-MM-DD.")
+		}
+	}
+}
+
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
 }
@@ -0,0 +1,135 @@
+package frontdesk
+
+import (
+	"errors"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Состояния бронирования на стойке регистрации
+const (
+	StatusExpected   = "expected"
+	StatusInHouse    = "in_house"
+	StatusCheckedOut = "checked_out"
+	StatusNoShow     = "no_show"
+	StatusCancelled  = "cancelled"
+)
+
+// NoShowCutoff - время в день заезда, после которого не приехавшего гостя можно отметить как no-show
+const NoShowCutoff = 18 * time.Hour
+
+var (
+	ErrNotExpected      = errors.New("the guest has already checked in or the reservation is closed")
+	ErrNotArrivalDay    = errors.New("check-in is only possible during the stay")
+	ErrNotInHouse       = errors.New("the guest is not checked in")
+	ErrBeforeCutoff     = errors.New("a no-show can be marked only after the cutoff on the arrival day")
+	ErrInvalidDeparture = errors.New("departure must be after arrival")
+)
+
+// Status возвращает состояние бронирования по отметкам заезда, выезда, no-show и отмены
+func Status(res models.Reservation) string {
+	switch {
+	case !res.CancelledAt.IsZero():
+		return StatusCancelled
+	case !res.NoShowAt.IsZero():
+		return StatusNoShow
+	case !res.CheckedOutAt.IsZero():
+		return StatusCheckedOut
+	case !res.CheckedInAt.IsZero():
+		return StatusInHouse
+	}
+
+	return StatusExpected
+}
+
+// CanCheckIn проверяет, что гостя можно заселить сейчас: он еще не заезжал и срок бронирования идет
+func CanCheckIn(res models.Reservation, now time.Time) error {
+	if Status(res) != StatusExpected {
+		return ErrNotExpected
+	}
+
+	today := Day(now)
+	if today.Before(Day(res.StartDate)) || !today.Before(Day(res.EndDate)) {
+		return ErrNotArrivalDay
+	}
+
+	return nil
+}
+
+// CanCheckOut проверяет, что гость проживает
+func CanCheckOut(res models.Reservation) error {
+	if Status(res) != StatusInHouse {
+		return ErrNotInHouse
+	}
+
+	return nil
+}
+
+// CanMarkNoShow проверяет, что гость не заезжал и время заезда прошло: после NoShowCutoff в день заезда или позже
+func CanMarkNoShow(res models.Reservation, now time.Time) error {
+	if Status(res) != StatusExpected {
+		return ErrNotExpected
+	}
+
+	start := Day(res.StartDate)
+	cutoff := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, now.Location()).Add(NoShowCutoff)
+
+	if now.Before(cutoff) {
+		return ErrBeforeCutoff
+	}
+
+	return nil
+}
+
+// Departure возвращает новую дату выезда: requested, если ее указали, иначе сегодняшний день.
+// Раньше выезда - ранний выезд, позже - поздний; дата должна быть позже даты заезда
+func Departure(res models.Reservation, now, requested time.Time) (time.Time, error) {
+	end := Day(now)
+	if !requested.IsZero() {
+		end = Day(requested)
+	}
+
+	if !end.After(Day(res.StartDate)) {
+		return end, ErrInvalidDeparture
+	}
+
+	return end, nil
+}
+
+// Day отбрасывает время, оставляя дату в UTC, как даты хранятся в базе
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Row - бронирование на странице стойки регистрации и доступные по нему действия
+type Row struct {
+	Reservation models.Reservation
+	Status      string
+	CanCheckIn  bool
+	CanCheckOut bool
+	CanNoShow   bool
+}
+
+// Section - раздел страницы стойки регистрации: заезды, выезды или проживающие
+type Section struct {
+	Title string
+	Rows  []Row
+}
+
+// Rows готовит бронирования к показу на стойке регистрации
+func Rows(reservations []models.Reservation, now time.Time) []Row {
+	rows := make([]Row, 0, len(reservations))
+
+	for _, res := range reservations {
+		rows = append(rows, Row{
+			Reservation: res,
+			Status:      Status(res),
+			CanCheckIn:  CanCheckIn(res, now) == nil,
+			CanCheckOut: CanCheckOut(res) == nil,
+			CanNoShow:   CanMarkNoShow(res, now) == nil,
+		})
+	}
+
+	return rows
+}
@@ -0,0 +1,107 @@
+package frontdesk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var res = models.Reservation{ID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 13)}
+
+func TestStatus(t *testing.T) {
+	r := res
+	if Status(r) != StatusExpected {
+		t.Errorf("got %s", Status(r))
+	}
+
+	r.CheckedInAt = date(2050, 1, 10)
+	if Status(r) != StatusInHouse {
+		t.Errorf("got %s", Status(r))
+	}
+
+	r.CheckedOutAt = date(2050, 1, 12)
+	if Status(r) != StatusCheckedOut {
+		t.Errorf("got %s", Status(r))
+	}
+
+	r.CancelledAt = date(2050, 1, 12)
+	if Status(r) != StatusCancelled {
+		t.Errorf("got %s", Status(r))
+	}
+}
+
+func TestCanCheckIn(t *testing.T) {
+	if err := CanCheckIn(res, date(2050, 1, 10).Add(14*time.Hour)); err != nil {
+		t.Error(err)
+	}
+
+	// опоздавший на день гость все еще может заехать
+	if err := CanCheckIn(res, date(2050, 1, 11)); err != nil {
+		t.Error(err)
+	}
+
+	if err := CanCheckIn(res, date(2050, 1, 9)); err != ErrNotArrivalDay {
+		t.Errorf("got %v", err)
+	}
+
+	if err := CanCheckIn(res, date(2050, 1, 13)); err != ErrNotArrivalDay {
+		t.Errorf("got %v", err)
+	}
+
+	r := res
+	r.CheckedInAt = date(2050, 1, 10)
+	if err := CanCheckIn(r, date(2050, 1, 10)); err != ErrNotExpected {
+		t.Errorf("got %v", err)
+	}
+
+	if err := CanCheckOut(r); err != nil {
+		t.Error(err)
+	}
+
+	if err := CanCheckOut(res); err != ErrNotInHouse {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCanMarkNoShow(t *testing.T) {
+	if err := CanMarkNoShow(res, date(2050, 1, 10).Add(17*time.Hour)); err != ErrBeforeCutoff {
+		t.Errorf("got %v", err)
+	}
+
+	if err := CanMarkNoShow(res, date(2050, 1, 10).Add(NoShowCutoff)); err != nil {
+		t.Error(err)
+	}
+
+	if err := CanMarkNoShow(res, date(2050, 1, 11)); err != nil {
+		t.Error(err)
+	}
+
+	r := res
+	r.CheckedInAt = date(2050, 1, 10)
+	if err := CanMarkNoShow(r, date(2050, 1, 11)); err != ErrNotExpected {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDeparture(t *testing.T) {
+	// ранний выезд - сегодня
+	end, err := Departure(res, date(2050, 1, 11).Add(10*time.Hour), time.Time{})
+	if err != nil || !end.Equal(date(2050, 1, 11)) {
+		t.Errorf("got %s %v", end, err)
+	}
+
+	// поздний выезд - указанная дата
+	end, err = Departure(res, date(2050, 1, 13), date(2050, 1, 14))
+	if err != nil || !end.Equal(date(2050, 1, 14)) {
+		t.Errorf("got %s %v", end, err)
+	}
+
+	if _, err = Departure(res, date(2050, 1, 10), time.Time{}); err != ErrInvalidDeparture {
+		t.Errorf("got %v", err)
+	}
+}
@@ -1,19 +1,40 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi"
+	"github.com/krasnov23/guest-house-golang/internal/audit"
+	"github.com/krasnov23/guest-house-golang/internal/availability"
+	"github.com/krasnov23/guest-house-golang/internal/blocks"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/dashboard"
 	"github.com/krasnov23/guest-house-golang/internal/driver"
 	"github.com/krasnov23/guest-house-golang/internal/forms"
+	"github.com/krasnov23/guest-house-golang/internal/frontdesk"
 	"github.com/krasnov23/guest-house-golang/internal/helpers"
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
+	"github.com/krasnov23/guest-house-golang/internal/invoice"
+	"github.com/krasnov23/guest-house-golang/internal/listing"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
+	"github.com/krasnov23/guest-house-golang/internal/maintenance"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
+	"github.com/krasnov23/guest-house-golang/internal/pricing"
+	"github.com/krasnov23/guest-house-golang/internal/promo"
 	"github.com/krasnov23/guest-house-golang/internal/render"
+	"github.com/krasnov23/guest-house-golang/internal/reports"
 	"github.com/krasnov23/guest-house-golang/internal/repository"
 	"github.com/krasnov23/guest-house-golang/internal/repository/dbrepo"
-	"log"
+	"github.com/krasnov23/guest-house-golang/internal/stayrules"
+	"github.com/krasnov23/guest-house-golang/internal/timeline"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -47,14 +68,14 @@ func NewHandler(r *Repository) {
 
 // Home is the handler for the home page
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	m.DB.AllUsers()
+	m.DB.AllUsers(r.Context())
 	// Кладем Ip вновь зашедшего пользователя в сессию
 	/*remoteIP := r.RemoteAddr
 	m.App.Session.Put(r.Context(), "remote_ip", remoteIP)*/
 
 	err := render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
 	if err != nil {
-		log.Fatal(err)
+		logging.FromContext(r.Context()).Error("cannot render home page", "error", err)
 	}
 
 }
@@ -104,7 +125,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot find Room")
@@ -112,10 +133,18 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res.Room.RoomName = room.RoomName
+	res.Room = room
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
+	// предварительный расчет стоимости (сборы за гостя считаются на одного гостя)
+	quote, err := m.quote(r.Context(), res, nil)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot calculate price")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	// Получение id сессии из куки
 	/*cookie, err := r.Cookie("session")
 	if err != nil {
@@ -133,6 +162,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["quote"] = quote
 
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		// с помощью свойства ниже даем доступ к форме которая у нас есть в шаблоне
@@ -151,7 +181,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 
 	if err != nil {
-		//helpers.ServerError(w, err)
+		//helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "cannot parse data")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
@@ -183,7 +213,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot find Room")
@@ -200,6 +230,14 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		StartDate: startDate,
 		EndDate:   endDate,
 		Room:      room,
+		Guests:    1,
+		Source:    "website",
+		// гражданство необязательно, нужно только для отчетов
+		Nationality: strings.TrimSpace(r.Form.Get("nationality")),
+	}
+
+	if g, err := strconv.Atoi(r.Form.Get("guests")); err == nil && g > 0 {
+		reservation.Guests = g
 	}
 
 	stringMap := make(map[string]string)
@@ -212,12 +250,36 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
+	form.IsInt("guests")
+
+	// проверка дат по правилам проживания, ошибки выводятся под датами заезда и выезда
+	violations, err := m.checkStayRules(r.Context(), roomID, startDate, endDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot check stay rules")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	for _, v := range violations {
+		form.Errors.Add(v.Field, v.Message)
+	}
+
+	// промокод необязателен, если он не подходит - ошибка выводится под полем кода
+	code, err := m.checkPromoCode(r.Context(), form, reservation)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot check promo code")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if code != nil {
+		reservation.PromoCodeID = code.ID
+	}
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 
-		fmt.Println(data)
 		//http.Error(w, "my own error message", http.StatusSeeOther)
 		m.App.Session.Put(r.Context(), "error", "invalid data of fields")
 
@@ -229,13 +291,79 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	quote, err := m.quote(r.Context(), reservation, code)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot calculate price")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	reservation, err = m.createReservation(r.Context(), reservation, quote, true)
+	if errors.Is(err, promo.ErrUsageLimit) || errors.Is(err, promo.ErrAlreadyUsed) {
+		// пока гость заполнял форму, последнее использование кода забрало другое бронирование
+		reservation.PromoCodeID = 0
+		form.Errors.Add("promo_code", promoMessage(err))
+
+		data := make(map[string]interface{})
+		data["reservation"] = reservation
+
+		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		// пока гость заполнял форму, комнату на эти даты успели забронировать
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room is no longer available for the selected dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cant insert reservation to DB")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
+	m.audit(r, models.AuditEntry{Actor: reservation.Email, Action: audit.ActionCreate, Entity: audit.EntityReservation,
+		EntityID: reservation.ID, After: audit.Reservation(reservation)})
+
+	// сохранение данных бронирования (reservation) в сессии пользователя.
+	// В браузере мы не можем увидеть напрямую данные сессии так как сессии хранятся на сервере, но
+	// мы может получить их из cookie по session_id
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	//render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{})
+
+	// перед итоговой страницей гость вносит депозит или предоплату
+	http.Redirect(w, r, "/make-payment", http.StatusSeeOther)
+
+}
+
+// createReservation сохраняет бронирование вместе с расчетом стоимости и занятостью комнаты одной транзакцией.
+// Им пользуются и форма на сайте, и форма администратора; sendEmail - отправлять ли гостю подтверждение
+func (m *Repository) createReservation(ctx context.Context, res models.Reservation, quote pricing.Quote, sendEmail bool) (models.Reservation, error) {
+	id, err := m.DB.CreateReservation(ctx, res, quote.Items)
+	if err != nil {
+		return res, err
+	}
+
+	res.ID = id
+	res.Charges = quote.Items
+	m.App.Metrics.ReservationsCreated.Inc(res.Source)
+
+	if sendEmail {
+		m.sendConfirmation(ctx, res)
+	}
+
+	return res, nil
+}
+
+// sendConfirmation отправляет гостю письмо с подтверждением бронирования. Счет в нем не прикладывается:
+// он выставляется после оплаты или выезда (см. sendInvoice)
+func (m *Repository) sendConfirmation(ctx context.Context, reservation models.Reservation) {
 	hmtlMessage := fmt.Sprintf(`
 		<strong> Reservation Confirmation </strong><br>
 		Dear %s:, <br>
@@ -244,732 +372,3549 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		reservation.StartDate.Format("2006-01-02"),
 		reservation.EndDate.Format("2006-01-02"))
 
-	// отправка уведомления гостю
 	msg := models.MailData{
 		To:       reservation.Email,
 		From:     "admin@gmail.com",
 		Subject:  "Reservation confirmation",
 		Content:  hmtlMessage,
 		Template: "basic.html",
+		Logger:   logging.FromContext(ctx),
 	}
 
 	m.App.MailChan <- msg
+}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+// sendInvoice выставляет счет по бронированию (если он еще не выставлен) и отправляет его гостю.
+// Номера счетов идут подряд без пропусков, поэтому счет выставляется только после оплаты или выезда
+func (m *Repository) sendInvoice(ctx context.Context, res models.Reservation) {
+	issued, err := m.DB.IssueInvoice(ctx, res.ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot issue invoice", "reservation_id", res.ID, "error", err)
+		return
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
-
+	document, err := m.invoiceDocument(ctx, res, issued)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cant insert room restrictions to DB")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		logging.FromContext(ctx).Error("cannot build invoice", "reservation_id", res.ID, "error", err)
 		return
 	}
 
-	// сохранение данных бронирования (reservation) в сессии пользователя.
-	// В браузере мы не можем увидеть напрямую данные сессии так как сессии хранятся на сервере, но
-	// мы может получить их из cookie по session_id
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-	//render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{})
-
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	if res.Email == "" {
+		return
+	}
 
+	m.App.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "admin@gmail.com",
+		Subject:  fmt.Sprintf("Invoice %s", issued.InvoiceNumber),
+		Content:  fmt.Sprintf("Dear %s,<br>please find attached the invoice for your stay.", res.FirstName),
+		Template: "basic.html",
+		Logger:   logging.FromContext(ctx),
+		Attachments: []models.MailAttachment{{
+			Name:     invoice.FileName(issued.InvoiceNumber),
+			MimeType: "application/pdf",
+			Data:     document,
+		}},
+	}
 }
 
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
-}
+// invoiceDocument возвращает PDF выставленного счета. Документ собирается один раз и хранится вместе со счетом,
+// поэтому счет с тем же номером и позже совпадает с отправленным гостю, даже если менялись строки расчета или платежи
+func (m *Repository) invoiceDocument(ctx context.Context, res models.Reservation, issued models.Invoice) ([]byte, error) {
+	if len(issued.Document) > 0 {
+		return issued.Document, nil
+	}
 
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
-}
+	inv, err := m.buildInvoice(ctx, res, issued)
+	if err != nil {
+		return nil, err
+	}
 
-func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	return m.DB.SaveInvoiceDocument(ctx, issued.ID, inv.PDF())
 }
 
-func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+// stayTotal - полная стоимость проживания по строкам расчета, сохраненным в бронировании
+func stayTotal(res models.Reservation) int {
+	return pricing.Summarize(res.Charges).Total
 }
 
-func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
+// quote считает стоимость проживания с действующими налогами и сборами и скидкой по промокоду (code может быть nil)
+func (m *Repository) quote(ctx context.Context, res models.Reservation, code *models.PromoCode) (pricing.Quote, error) {
+	rules, err := m.DB.AllTaxRules(ctx)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
 
-	// Получаем из сессии значение по ключу reservation и приводим его к типу models.Reservation
-	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	return pricing.Calculate(pricing.Stay{
+		Room:      res.Room,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		Guests:    res.Guests,
+		Promo:     code,
+	}, rules), nil
+}
 
-	if !ok {
-		m.App.ErrorLog.Println("cant get error from session")
-		//log.Println("cannot get item from session")
-		m.App.Session.Put(r.Context(), "error", "cannot get reservation from session")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+// checkPromoCode проверяет введенный в форму промокод. Если код не подходит, ошибка добавляется в форму и возвращается nil
+func (m *Repository) checkPromoCode(ctx context.Context, form *forms.Form, res models.Reservation) (*models.PromoCode, error) {
+	raw := promo.Normalize(form.Get("promo_code"))
+	if raw == "" {
+		return nil, nil
 	}
 
-	m.App.Session.Remove(r.Context(), "reservation")
-	data := make(map[string]interface{})
-	data["reservation"] = reservation
+	code, err := m.DB.GetPromoCodeByCode(ctx, raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("promo_code", "This promo code does not exist.")
+		return nil, nil
+	}
 
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
+	if err != nil {
+		return nil, err
+	}
 
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
+	total, guest, err := m.DB.CountPromoCodeUses(ctx, code.ID, res.Email)
+	if err != nil {
+		return nil, err
+	}
 
-	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
-	})
+	err = promo.Check(code, res.RoomID, res.StartDate, res.EndDate, time.Now(), promo.Usage{Total: total, Guest: guest})
+	if err != nil {
+		form.Errors.Add("promo_code", promoMessage(err))
+		return nil, nil
+	}
 
+	return &code, nil
 }
 
-// Данный метод отправки формы не будет работать если в нем не будет передаваться csrf токен,
-// т.к в настройках нашего сервера задан csrf токен который должен в них отправляться
-func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
+// promoMessages - тексты под полем промокода для ошибок пакета promo
+var promoMessages = map[error]string{
+	promo.ErrInactive:     "This promo code is not active.",
+	promo.ErrExpired:      "This promo code has expired.",
+	promo.ErrNotStarted:   "This promo code is not valid yet.",
+	promo.ErrStayDates:    "This promo code is not valid for the selected dates.",
+	promo.ErrRoom:         "This promo code is not valid for the selected room.",
+	promo.ErrUsageLimit:   "This promo code has already been fully redeemed.",
+	promo.ErrAlreadyUsed:  "You have already used this promo code.",
+	promo.ErrInvalidValue: "This promo code has no discount.",
+}
 
-	layout := "2006-01-02"
+// promoMessage возвращает текст ошибки промокода для гостя
+func promoMessage(err error) string {
+	for e, msg := range promoMessages {
+		if errors.Is(err, e) {
+			return msg
+		}
+	}
 
-	startDate, err := time.Parse(layout, start)
+	return "This promo code cannot be applied."
+}
 
+// buildInvoice собирает выставленный счет по бронированию с уже внесенными платежами
+func (m *Repository) buildInvoice(ctx context.Context, res models.Reservation, inv models.Invoice) (*invoice.Invoice, error) {
+	paid, err := m.DB.GetPaymentsByReservationID(ctx, res.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return nil, err
 	}
 
-	endDate, err := time.Parse(layout, end)
-
+	res.Charges, err = m.DB.GetReservationCharges(ctx, res.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return nil, err
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	return invoice.Build(inv, res, paid, m.App.Currency), nil
+}
 
-	if err != nil {
-		helpers.ServerError(w, err)
+// Payment показывает страницу оплаты депозита или полной стоимости только что созданного бронирования
+func (m *Repository) Payment(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "cannot get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	for _, i := range rooms {
-		m.App.InfoLog.Println("ROOM:", i.ID, i.RoomName)
+	// если цена комнаты не задана, оплачивать нечего
+	if stayTotal(res) == 0 {
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return
 	}
 
-	//Если нет свободных комнат на указанные даты
-	if len(rooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No rooms available")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	paid, err := m.isPaid(r.Context(), res.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	data := make(map[string]interface{})
+	if paid {
+		m.App.Session.Put(r.Context(), "flash", "This reservation has already been paid")
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return
+	}
 
-	data["rooms"] = rooms
+	m.renderPayment(w, r, res, forms.New(nil))
+}
 
-	res := models.Reservation{
-		StartDate: startDate,
-		EndDate:   endDate,
+// isPaid сообщает, что по бронированию уже есть заблокированный или списанный платеж
+func (m *Repository) isPaid(ctx context.Context, reservationID int) (bool, error) {
+	paid, err := m.DB.GetPaymentsByReservationID(ctx, reservationID)
+	if err != nil {
+		return false, err
 	}
 
-	// При данном методе генерируется реальная сессия в go
-	m.App.Session.Put(r.Context(), "reservation", res)
-
-	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
+	for _, p := range paid {
+		if p.Status == payments.StatusAuthorized || p.Status == payments.StatusCaptured {
+			return true, nil
+		}
+	}
 
+	return false, nil
 }
 
-type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
-}
+func (m *Repository) renderPayment(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	total := stayTotal(res)
 
-func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["quote"] = pricing.Summarize(res.Charges)
 
-	err := r.ParseForm()
+	intMap := make(map[string]int)
+	intMap["total"] = total
+	intMap["deposit"] = payments.DepositAmount(total, m.App.DepositPercent)
+	intMap["deposit_percent"] = m.App.DepositPercent
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+	stringMap["currency"] = m.App.Currency
+
+	render.Template(w, r, "make-payment.page.tmpl", &models.TemplateData{
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
 
+// PostPayment блокирует сумму на карте гостя и сразу списывает ее, сохраняя платеж в таблицу payments.
+// Данные карты приходят токеном от виджета провайдера в браузере
+func (m *Repository) PostPayment(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-		resp := jsonResponse{
-			OK:      false,
-			Message: "Internal server error",
-		}
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "cannot get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
+	// бронирование остается в сессии и после оплаты, поэтому повторная отправка формы (кнопка "назад",
+	// обновление страницы) не должна списать деньги второй раз
+	paid, err := m.isPaid(r.Context(), res.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+	if paid {
+		m.App.Session.Put(r.Context(), "flash", "This reservation has already been paid")
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 		return
+	}
 
-		/*if err != nil {
-			helpers.ServerError(w, err)
-			log.Println(err)
-		}*/
+	form := forms.New(r.PostForm)
+	form.Required("payment_token")
+
+	if !form.Valid() {
+		m.renderPayment(w, r, res, form)
+		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+	kind := payments.KindDeposit
+	amount := payments.DepositAmount(stayTotal(res), m.App.DepositPercent)
 
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
-	endDate, err := time.Parse(layout, ed)
+	if r.Form.Get("kind") == payments.KindFull {
+		kind = payments.KindFull
+		amount = stayTotal(res)
+	}
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	result, err := m.App.Payments.Authorize(r.Context(), payments.AuthorizeRequest{
+		Amount:        amount,
+		Currency:      m.App.Currency,
+		Description:   fmt.Sprintf("Reservation #%d", res.ID),
+		ReservationID: res.ID,
+		Token:         r.Form.Get("payment_token"),
+	})
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(roomID, startDate, endDate)
+	payment := models.Payment{
+		ReservationID: res.ID,
+		Provider:      m.App.Payments.Name(),
+		ProviderRef:   result.Reference,
+		Kind:          kind,
+		Amount:        amount,
+		Currency:      m.App.Currency,
+		Status:        result.Status,
+	}
 
 	if err != nil {
-
-		resp := jsonResponse{
-			OK:      false,
-			Message: "Error connecting to DB",
+		// неудачная попытка тоже сохраняется, чтобы администратор ее видел
+		payment.Status = payments.StatusFailed
+		_, dbErr := m.DB.InsertPayment(r.Context(), payment)
+		if dbErr != nil {
+			helpers.ServerError(w, r, dbErr)
+			return
 		}
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
+		if errors.Is(err, payments.ErrDeclined) {
+			form.Errors.Add("payment_token", "The payment was declined, please use another card.")
+		} else {
+			form.Errors.Add("payment_token", "The payment could not be processed, please try again.")
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+		m.renderPayment(w, r, res, form)
 		return
-
 	}
 
-	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomID),
+	payment.ID, err = m.DB.InsertPayment(r.Context(), payment)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	out, err := json.MarshalIndent(resp, "", "     ")
-
+	result, err = m.App.Payments.Capture(r.Context(), payment.ProviderRef, amount)
 	if err != nil {
-		helpers.ServerError(w, err)
-		log.Println(err)
-	}
+		// блокировку снимаем до повторной попытки, иначе у гостя останутся заблокированы две суммы.
+		// Если снять не удалось, платеж все равно помечается неудачным: блокировку отпустит банк по истечении срока
+		payment.Status = payments.StatusFailed
+		if voided, voidErr := m.App.Payments.Void(r.Context(), payment.ProviderRef); voidErr == nil {
+			payment.Status = voided.Status
+		} else {
+			logging.FromContext(r.Context()).Error("cannot void payment", "payment_id", payment.ID, "error", voidErr)
+		}
 
-	log.Println(string(out))
+		if dbErr := m.DB.UpdatePayment(r.Context(), payment); dbErr != nil {
+			helpers.ServerError(w, r, dbErr)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
+		m.App.Session.Put(r.Context(), "error", "the payment could not be captured")
+		http.Redirect(w, r, "/make-payment", http.StatusSeeOther)
+		return
+	}
 
-	_, err = w.Write(out)
+	payment.Status = result.Status
+	err = m.DB.UpdatePayment(r.Context(), payment)
 	if err != nil {
+		helpers.ServerError(w, r, err)
 		return
 	}
-}
 
-func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
+	m.sendInvoice(r.Context(), res)
 
-	// Получения id комнаты из реквеста
-	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	m.App.Session.Put(r.Context(), "flash", "Payment received")
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
 
+// PaymentWebhook принимает уведомления платежной системы об изменении статуса платежа.
+// Запрос подписывается провайдером, поэтому маршрут исключен из проверки CSRF
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
-		log.Println(err)
-		m.App.Session.Put(r.Context(), "error", "missing url parameter")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-
+	event, err := m.App.Payments.VerifyWebhook(body, r.Header.Get("X-Payment-Signature"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	payment, err := m.DB.GetPaymentByProviderRef(r.Context(), m.App.Payments.Name(), event.Reference)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	payment.Status = event.Status
+
+	// для возвратов провайдер присылает общую возвращенную сумму
+	if event.Status == payments.StatusRefunded {
+		payment.RefundedAmount = event.Amount
+	}
+
+	err = m.DB.UpdatePayment(r.Context(), payment)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
+}
+
+func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+}
+
+func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+}
+
+func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+}
+
+func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
+
+	// Получаем из сессии значение по ключу reservation и приводим его к типу models.Reservation
+	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+
 	if !ok {
-		log.Println(err)
-		m.App.Session.Put(r.Context(), "error", "problem getting reservation from session")
+		logging.FromContext(r.Context()).Error("cannot get reservation from session")
+		m.App.Session.Put(r.Context(), "error", "cannot get reservation from session")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	res.RoomID = roomID
+	m.App.Session.Remove(r.Context(), "reservation")
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
+	data["quote"] = pricing.Summarize(reservation.Charges)
 
-	m.App.Session.Put(r.Context(), "reservation", res)
+	// внесенные гостем платежи
+	payments, err := m.DB.GetPaymentsByReservationID(r.Context(), reservation.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	data["payments"] = payments
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
-}
+	sd := reservation.StartDate.Format("2006-01-02")
+	ed := reservation.EndDate.Format("2006-01-02")
 
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = sd
+	stringMap["end_date"] = ed
 
-	// id,s(start),e (end)
-	ID, err := strconv.Atoi(r.URL.Query().Get("id"))
-	startDate := r.URL.Query().Get("s")
-	endDate := r.URL.Query().Get("e")
+	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
 
+}
+
+// Данный метод отправки формы не будет работать если в нем не будет передаваться csrf токен,
+// т.к в настройках нашего сервера задан csrf токен который должен в них отправляться
+func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	var res models.Reservation
+	start := r.Form.Get("start")
+	end := r.Form.Get("end")
 
 	layout := "2006-01-02"
 
-	sd, err := time.Parse(layout, startDate)
+	startDate, err := time.Parse(layout, start)
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	ed, err := time.Parse(layout, endDate)
+	endDate, err := time.Parse(layout, end)
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Metrics.AvailabilitySearches.Inc("all_rooms")
+
+	// базовые правила (выезд после заезда, заезд не в прошлом) проверяем до поиска
+	if violations := stayrules.Check(nil, startDate, endDate, time.Now()); len(violations) > 0 {
+		m.App.Session.Put(r.Context(), "error", violations[0].Message)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(ID)
+	freeRooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate)
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	res.Room.RoomName = room.RoomName
-	res.RoomID = ID
-	res.StartDate = sd
-	res.EndDate = ed
+	// правила всех комнат загружаются одним запросом, а не отдельно для каждой свободной комнаты
+	rules, err := m.DB.AllStayRules(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// из свободных комнат оставляем только те, правила проживания которых допускают выбранные даты
+	var rooms []models.Room
+	var ruleViolation string
+
+	for _, i := range freeRooms {
+		violations := stayViolations(rules, i.ID, startDate, endDate)
+
+		if len(violations) > 0 {
+			ruleViolation = violations[0].Message
+			continue
+		}
+
+		rooms = append(rooms, i)
+	}
+
+	//Если нет свободных комнат на указанные даты
+	if len(rooms) == 0 {
+		m.renderSuggestions(w, r, startDate, endDate, ruleViolation, forms.New(nil))
+		return
+	}
+
+	data := make(map[string]interface{})
+
+	data["rooms"] = rooms
 
+	res := models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	// При данном методе генерируется реальная сессия в go
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 
 }
 
-// ShowLogin -
-func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+// renderSuggestions показывает страницу "нет свободных комнат": ближайшие свободные даты, проживание в нескольких
+// комнатах и форму записи в лист ожидания
+func (m *Repository) renderSuggestions(w http.ResponseWriter, r *http.Request, start, end time.Time, ruleViolation string, form *forms.Form) {
+	windows, split, err := m.suggestAlternatives(r.Context(), start, end)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-	// В шаблоне login.page.tmpl есть конструкции типа {{with .Form.Errors.Get "email"}}, которые требуют, чтобы .Form был не nil.
-	// Если Form не передан, шаблон может либо:
-	// Не отображать поля (если есть {{if .Form}} или {{with .Form}}),
-	// Вызвать панику (если .Form — nil, но код пытается вызвать .Errors.Get).
-	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
-		Form: forms.New(nil),
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["windows"] = windows
+	data["split"] = split
+	data["rooms"] = rooms
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = start.Format("2006-01-02")
+	stringMap["end_date"] = end.Format("2006-01-02")
+	stringMap["rule_violation"] = ruleViolation
+
+	render.Template(w, r, "search-suggestions.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
 	})
 }
 
-// https://go.dev/play/p/uKMMCzJWGsW - генерация пароля
-func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
-	//
-	_ = m.App.Session.RenewToken(r.Context())
-
+// PostWaitlist записывает гостя в лист ожидания на даты, на которые не нашлось свободных комнат
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
-
 	form := forms.New(r.PostForm)
-	form.Required("email", "password")
+	form.Required("email", "start_date", "end_date")
 	form.IsEmail("email")
+	form.IsDate("start_date", "end_date")
+	form.IsInt("room_id")
+
+	layout := "2006-01-02"
+	startDate, _ := time.Parse(layout, form.Get("start_date"))
+	endDate, _ := time.Parse(layout, form.Get("end_date"))
+
+	if form.Valid() && !endDate.After(startDate) {
+		form.Errors.Add("end_date", "Departure must be after arrival")
+	}
 
 	if !form.Valid() {
-		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
-			Form: form,
-		})
+		if startDate.IsZero() || endDate.IsZero() {
+			m.App.Session.Put(r.Context(), "error", "Invalid dates")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		m.renderSuggestions(w, r, startDate, endDate, "", form)
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	roomID, _ := strconv.Atoi(form.Get("room_id"))
+
+	entry := models.WaitlistEntry{
+		Name:      strings.TrimSpace(form.Get("name")),
+		Email:     strings.TrimSpace(form.Get("email")),
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    roomID,
+	}
 
+	err = m.DB.InsertWaitlistEntry(r.Context(), entry)
 	if err != nil {
-		log.Println(err)
-		m.App.Session.Put(r.Context(), "error", "invalid login credentials")
-		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	m.audit(r, models.AuditEntry{Actor: entry.Email, Action: audit.ActionCreate, Entity: audit.EntityWaitlist,
+		After: audit.Waitlist(entry)})
+
+	m.App.Session.Put(r.Context(), "flash", "We will email you as soon as a room becomes available for your dates")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// notifyWaitlist вызывается, когда у комнаты roomID освобождаются даты start-end (удаление бронирования
+// или снятие блокировки). Гостям из листа ожидания, чьи даты теперь полностью свободны, отправляется письмо
+// со ссылкой на бронирование. Возвращает количество отправленных писем
+func (m *Repository) notifyWaitlist(ctx context.Context, roomID int, start, end time.Time) (int, error) {
+	entries, err := m.DB.GetPendingWaitlistEntries(ctx, roomID, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+
+	for _, e := range entries {
+		// освободиться могли не все ночи, которые нужны гостю
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(ctx, roomID, e.StartDate, e.EndDate)
+		if err != nil {
+			return sent, err
+		}
+
+		if !available {
+			continue
+		}
 
+		violations, err := m.checkStayRules(ctx, roomID, e.StartDate, e.EndDate)
+		if err != nil {
+			return sent, err
+		}
+
+		if len(violations) > 0 {
+			continue
+		}
+
+		room, err := m.DB.GetRoomByID(ctx, roomID)
+		if err != nil {
+			return sent, err
+		}
+
+		link := fmt.Sprintf("%s/book-room?id=%d&s=%s&e=%s", m.App.BaseURL, roomID,
+			e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"))
+
+		htmlMessage := fmt.Sprintf(`
+			<strong>Good news!</strong><br>
+			Dear %s, <br>
+			%s is now available from %s to %s. <br>
+			<a href="%s">Book it now</a> before someone else does.
+		`, e.Name, room.RoomName, e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"), link)
+
+		m.App.MailChan <- models.MailData{
+			To:       e.Email,
+			From:     "admin@gmail.com",
+			Subject:  "Your dates are available",
+			Content:  htmlMessage,
+			Template: "basic.html",
+			Logger:   logging.FromContext(ctx),
+		}
+
+		err = m.DB.MarkWaitlistNotified(ctx, e.ID)
+		if err != nil {
+			return sent, err
+		}
+
+		sent++
+	}
+
+	return sent, nil
 }
 
-func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	// Полностью удаляет данные сессии из хранилища (например, Redis, базы данных или файла).
-	// Внутри, скорее всего, происходит удаление ключа сессии (например, session:<session_id>).
-	_ = m.App.Session.Destroy(r.Context())
+type jsonResponse struct {
+	OK        bool   `json:"ok"`
+	Message   string `json:"message"`
+	RoomID    string `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
 
-	// Генерирует новый идентификатор сессии (session ID), чтобы избежать атак типа session fixation.
-	// Старая сессия уже уничтожена, но браузеру выдается новый session_id (через cookie).
-	_ = m.App.Session.RenewToken(r.Context())
+// audit пишет изменение в журнал: администратор берется из сессии, для гостя в e.Actor передается его email.
+// Ошибка записи журнала не отменяет само изменение, она только логируется
+func (m *Repository) audit(r *http.Request, e models.AuditEntry) {
+	e.IP = audit.IP(r)
+	e.UserID = m.App.Session.GetInt(r.Context(), "user_id")
 
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	if e.UserID > 0 {
+		e.Actor = "admin"
+	}
+
+	if err := m.DB.InsertAuditEntry(r.Context(), e); err != nil {
+		logging.FromContext(r.Context()).Error("cannot write audit entry", "entity", e.Entity, "entity_id", e.EntityID, "error", err)
+	}
+}
+
+// writeJSON отправляет ответ в формате JSON с указанным статусом
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "     ")
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
 }
 
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+
+	if err != nil {
+
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Internal server error",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+
+		/*if err != nil {
+			helpers.ServerError(w, r, err)
+			log.Println(err)
+		}*/
+	}
+
+	sd := r.Form.Get("start")
+	ed := r.Form.Get("end")
+
+	layout := "2006-01-02"
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		writeJSONError(w, "Invalid arrival date")
+		return
+	}
+
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		writeJSONError(w, "Invalid departure date")
+		return
+	}
+
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	m.App.Metrics.AvailabilitySearches.Inc("room")
+
+	violations, err := m.checkStayRules(r.Context(), roomID, startDate, endDate)
+	if err != nil {
+		writeJSONError(w, "Error connecting to DB")
+		return
+	}
+
+	// даты не проходят по правилам проживания - бронирование невозможно, сообщаем причину
+	if len(violations) > 0 {
+		var messages []string
+		for _, v := range violations {
+			messages = append(messages, v.Message)
+		}
+
+		writeJSONError(w, strings.Join(messages, " "))
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), roomID, startDate, endDate)
+
+	if err != nil {
+
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Error connecting to DB",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+
+	}
+
+	resp := jsonResponse{
+		OK:        available,
+		Message:   "",
+		StartDate: sd,
+		EndDate:   ed,
+		RoomID:    strconv.Itoa(roomID),
+	}
+
+	out, err := json.MarshalIndent(resp, "", "     ")
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(out)
+	if err != nil {
+		return
+	}
+}
+
+type calendarDay struct {
+	Date      string   `json:"date"`
+	Available bool     `json:"available"`
+	Price     *float64 `json:"price,omitempty"`
+}
+
+type calendarResponse struct {
+	OK      bool          `json:"ok"`
+	Message string        `json:"message"`
+	RoomID  int           `json:"room_id"`
+	Start   string        `json:"start"`
+	End     string        `json:"end"`
+	Days    []calendarDay `json:"days"`
+}
+
+// максимальный период, который можно запросить у календаря доступности
+const maxCalendarDays = 366
+
+// AvailabilityCalendar возвращает доступность комнаты по дням для виджета бронирования.
+// Период задается параметром month=2006-01 или парами start/end (end не включается), по умолчанию - текущий месяц
+func (m *Repository) AvailabilityCalendar(w http.ResponseWriter, r *http.Request) {
+	layout := "2006-01-02"
+
+	writeError := func(status int, message string) {
+		out, _ := json.MarshalIndent(calendarResponse{OK: false, Message: message}, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(out)
+	}
+
+	roomID, err := strconv.Atoi(r.URL.Query().Get("room_id"))
+	if err != nil {
+		writeError(http.StatusBadRequest, "invalid room_id")
+		return
+	}
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if month := r.URL.Query().Get("month"); month != "" {
+		start, err = time.Parse("2006-01", month)
+		if err != nil {
+			writeError(http.StatusBadRequest, "invalid month")
+			return
+		}
+	}
+
+	end := start.AddDate(0, 1, 0)
+
+	if sd := r.URL.Query().Get("start"); sd != "" {
+		start, err = time.Parse(layout, sd)
+		if err != nil {
+			writeError(http.StatusBadRequest, "invalid start date")
+			return
+		}
+
+		end, err = time.Parse(layout, r.URL.Query().Get("end"))
+		if err != nil {
+			writeError(http.StatusBadRequest, "invalid end date")
+			return
+		}
+	}
+
+	if !end.After(start) || end.Sub(start).Hours()/24 > maxCalendarDays {
+		writeError(http.StatusBadRequest, fmt.Sprintf("the range must be from 1 to %d days", maxCalendarDays))
+		return
+	}
+
+	m.App.Metrics.AvailabilitySearches.Inc("calendar")
+
+	days, err := m.DB.GetAvailabilityCalendar(r.Context(), roomID, start, end)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(http.StatusNotFound, "room not found")
+		return
+	}
+
+	if err != nil {
+		writeError(http.StatusInternalServerError, "Error connecting to DB")
+		return
+	}
+
+	resp := calendarResponse{
+		OK:     true,
+		RoomID: roomID,
+		Start:  start.Format(layout),
+		End:    end.Format(layout),
+		Days:   []calendarDay{},
+	}
+
+	for _, d := range days {
+		day := calendarDay{
+			Date:      d.Date.Format(layout),
+			Available: d.Available,
+		}
+
+		// цена отдается только если она задана для комнаты
+		if d.Price > 0 {
+			price := float64(d.Price) / 100
+			day.Price = &price
+		}
+
+		resp.Days = append(resp.Days, day)
+	}
+
+	out, err := json.MarshalIndent(resp, "", "     ")
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// writeJSONError отправляет ответ в формате jsonResponse с ok = false и текстом ошибки
+func writeJSONError(w http.ResponseWriter, message string) {
+	resp := jsonResponse{
+		OK:      false,
+		Message: message,
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// suggestAlternatives ищет для каждой комнаты ближайшие свободные периоды той же длины в пределах
+// App.SuggestionDays дней и вариант проживания с переездом между комнатами.
+// Варианты, не проходящие по правилам проживания, отбрасываются
+func (m *Repository) suggestAlternatives(ctx context.Context, start, end time.Time) ([]availability.Window, []availability.Window, error) {
+	radius := m.App.SuggestionDays
+	if radius <= 0 {
+		radius = 7
+	}
+
+	rooms, err := m.DB.AllRooms(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	from := start.AddDate(0, 0, -radius)
+	to := end.AddDate(0, 0, radius)
+
+	rules, err := m.DB.AllStayRules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var windows []availability.Window
+	busy := make(map[int]map[string]bool)
+
+	for _, room := range rooms {
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(ctx, room.ID, from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		busy[room.ID] = availability.BusyNights(restrictions)
+
+		for _, window := range availability.NearestWindows(room, busy[room.ID], start, end, radius, today) {
+			if len(stayViolations(rules, window.RoomID, window.StartDate, window.EndDate)) == 0 {
+				windows = append(windows, window)
+			}
+		}
+	}
+
+	split := availability.SplitStay(rooms, busy, start, end)
+
+	// если хотя бы одна часть разбитого проживания нарушает правила, вариант не предлагаем
+	for _, segment := range split {
+		if len(stayViolations(rules, segment.RoomID, segment.StartDate, segment.EndDate)) > 0 {
+			split = nil
+			break
+		}
+	}
+
+	// разбивка на одну комнату означает что комната свободна, но не прошла по правилам - такой вариант не нужен
+	if len(split) < 2 {
+		split = nil
+	}
+
+	return windows, split, nil
+}
+
+// checkStayRules возвращает нарушения правил проживания для комнаты на выбранные даты
+func (m *Repository) checkStayRules(ctx context.Context, roomID int, start, end time.Time) ([]stayrules.Violation, error) {
+	rules, err := m.DB.GetStayRulesForRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return stayViolations(rules, roomID, start, end), nil
+}
+
+// stayViolations проверяет даты по правилам, уже загруженным из БД: в rules могут быть правила и других комнат
+func stayViolations(rules []models.StayRule, roomID int, start, end time.Time) []stayrules.Violation {
+	return stayrules.Check(stayrules.Applicable(rules, roomID, start), start, end, time.Now())
+}
+
+func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
+
+	// Получения id комнаты из реквеста
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("cannot parse room id", "error", err)
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+
+	if !ok {
+		logging.FromContext(r.Context()).Error("cannot get reservation from session")
+		m.App.Session.Put(r.Context(), "error", "problem getting reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res.RoomID = roomID
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+
+	// id,s(start),e (end)
+	ID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	startDate := r.URL.Query().Get("s")
+	endDate := r.URL.Query().Get("e")
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	var res models.Reservation
+
+	layout := "2006-01-02"
+
+	sd, err := time.Parse(layout, startDate)
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	ed, err := time.Parse(layout, endDate)
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), ID)
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	res.Room.RoomName = room.RoomName
+	res.RoomID = ID
+	res.StartDate = sd
+	res.EndDate = ed
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+
+}
+
+// ShowLogin -
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+
+	// В шаблоне login.page.tmpl есть конструкции типа {{with .Form.Errors.Get "email"}}, которые требуют, чтобы .Form был не nil.
+	// Если Form не передан, шаблон может либо:
+	// Не отображать поля (если есть {{if .Form}} или {{with .Form}}),
+	// Вызвать панику (если .Form — nil, но код пытается вызвать .Errors.Get).
+	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// https://go.dev/play/p/uKMMCzJWGsW - генерация пароля
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+	//
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("cannot parse login form", "error", err)
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	id, role, err := m.DB.Authenticate(r.Context(), email, password)
+
+	if err != nil {
+		logging.FromContext(r.Context()).Info("login failed", "email", email, "error", err)
+		m.App.Session.Put(r.Context(), "error", "invalid login credentials")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", id)
+	// по роли middleware решает, какие страницы админки доступны пользователю
+	m.App.Session.Put(r.Context(), "user_role", role)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+
+}
+
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	// Полностью удаляет данные сессии из хранилища (например, Redis, базы данных или файла).
+	// Внутри, скорее всего, происходит удаление ключа сессии (например, session:<session_id>).
+	_ = m.App.Session.Destroy(r.Context())
+
+	// Генерирует новый идентификатор сессии (session ID), чтобы избежать атак типа session fixation.
+	// Старая сессия уже уничтожена, но браузеру выдается новый session_id (через cookie).
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// AdminDashboard показывает движение гостей за сегодня, необработанные бронирования, загрузку на этот
+// и следующий месяц и темп бронирований по сравнению с прошлым годом
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	today := dashboard.Truncate(now)
+
+	onDate, err := m.DB.GetReservationsOnDate(r.Context(), today)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	newReservations, err := m.DB.CountNewReservations(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// загрузка на текущий и следующий месяц
+	var occupancy []dashboard.Occupancy
+
+	_, nextMonth := dashboard.Month(today)
+
+	for _, month := range []time.Time{today, nextMonth} {
+		start, end := dashboard.Month(month)
+
+		_, booked, err := m.DB.CountBookedNights(r.Context(), start, end, time.Time{})
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		occupancy = append(occupancy, dashboard.Occupancy{
+			Start:      start,
+			End:        end,
+			RoomNights: len(rooms) * dashboard.Nights(start, end),
+			Booked:     booked,
+		})
+	}
+
+	// темп бронирований на те же два месяца: сколько забронировано к сегодняшнему дню и к этой же дате год назад
+	pace := dashboard.Pace{Start: occupancy[0].Start, End: occupancy[1].End}
+
+	pace.Reservations, pace.Nights, err = m.DB.CountBookedNights(r.Context(), pace.Start, pace.End, now)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	pace.LastYearReservations, pace.LastYearNights, err = m.DB.CountBookedNights(r.Context(),
+		pace.Start.AddDate(-1, 0, 0), pace.End.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["day"] = dashboard.SplitDay(today, onDate)
+	data["occupancy"] = occupancy
+	data["pace"] = pace
+
+	intMap := make(map[string]int)
+	intMap["new_reservations"] = newReservations
+
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservationList(w, r, "new", "admin-new-reservations.page.tmpl")
+}
+
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservationList(w, r, "all", "admin-all-reservations.page.tmpl")
+}
+
+// renderReservationList показывает страницу списка бронирований. Фильтры, сортировка и номер страницы
+// хранятся в query-параметрах, чтобы ссылкой на список можно было поделиться
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, src, tmpl string) {
+	filter := listing.Parse(r.URL.Query())
+
+	var reservations []models.Reservation
+	var total int
+	var err error
+
+	if src == "new" {
+		filter.Status = ""
+		reservations, total, err = m.DB.AllNewReservations(r.Context(), filter)
+	} else {
+		reservations, total, err = m.DB.AllReservations(r.Context(), filter)
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["rooms"] = rooms
+	data["list"] = listing.List{
+		Path:   fmt.Sprintf("/admin/reservations-%s", src),
+		Filter: filter,
+		Total:  total,
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	render.Template(w, r, tmpl, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// reservationSources - откуда может прийти бронирование, оформленное администратором
+var reservationSources = []string{"phone", "walk-in", "email", "ota"}
+
+// AdminNewReservation показывает форму бронирования для звонков и гостей без записи
+func (m *Repository) AdminNewReservation(w http.ResponseWriter, r *http.Request) {
+	res := models.Reservation{Guests: 1, Source: "phone"}
+
+	form := forms.New(url.Values{})
+	form.Set("send_email", "1")
+
+	m.renderAdminNewReservation(w, r, res, form)
+}
+
+func (m *Repository) renderAdminNewReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+	data["sources"] = reservationSources
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = form.Get("start_date")
+	stringMap["end_date"] = form.Get("end_date")
+
+	render.Template(w, r, "admin-reservation-new.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
+
+// AdminPostNewReservation сохраняет бронирование, оформленное администратором.
+// Используется тот же транзакционный путь, что и для бронирований с сайта, поэтому занятые даты не пройдут
+func (m *Repository) AdminPostNewReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "start_date", "end_date", "room_id")
+	form.IsInt("room_id", "guests")
+	form.IsDate("start_date", "end_date")
+
+	sendEmail := form.Get("send_email") != ""
+
+	// без email гостю просто не отправляется подтверждение
+	if sendEmail {
+		form.Required("email")
+	}
+
+	if form.Get("email") != "" {
+		form.IsEmail("email")
+	}
+
+	res := models.Reservation{
+		FirstName:   strings.TrimSpace(form.Get("first_name")),
+		LastName:    strings.TrimSpace(form.Get("last_name")),
+		Email:       strings.TrimSpace(form.Get("email")),
+		Phone:       strings.TrimSpace(form.Get("phone")),
+		Nationality: strings.TrimSpace(form.Get("nationality")),
+		Source:      reservationSources[0],
+		Guests:      1,
+	}
+
+	for _, src := range reservationSources {
+		if form.Get("source") == src {
+			res.Source = src
+		}
+	}
+
+	// ошибки уже проверены формой, пустые значения остаются нулями
+	res.RoomID, _ = strconv.Atoi(form.Get("room_id"))
+	res.StartDate, _ = time.Parse("2006-01-02", form.Get("start_date"))
+	res.EndDate, _ = time.Parse("2006-01-02", form.Get("end_date"))
+
+	if g, err := strconv.Atoi(form.Get("guests")); err == nil && g > 0 {
+		res.Guests = g
+	}
+
+	if !form.Valid() {
+		m.renderAdminNewReservation(w, r, res, form)
+		return
+	}
+
+	res.Room, err = m.DB.GetRoomByID(r.Context(), res.RoomID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// правила проживания администратор может нарушать, проверяются только сами даты
+	for _, v := range stayrules.Check(nil, res.StartDate, res.EndDate, time.Now()) {
+		form.Errors.Add(v.Field, v.Message)
+	}
+
+	if form.Valid() {
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), res.RoomID, res.StartDate, res.EndDate)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		if !available {
+			form.Errors.Add("start_date", "This room is not available for the selected dates.")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminNewReservation(w, r, res, form)
+		return
+	}
+
+	quote, err := m.quote(r.Context(), res, nil)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	res, err = m.createReservation(r.Context(), res, quote, sendEmail)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		form.Errors.Add("start_date", "This room is not available for the selected dates.")
+		m.renderAdminNewReservation(w, r, res, form)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.audit(r, models.AuditEntry{Actor: res.Email, Action: audit.ActionCreate, Entity: audit.EntityReservation,
+		EntityID: res.ID, After: audit.Reservation(res)})
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation created")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/all/%d/show", res.ID), http.StatusSeeOther)
+}
+
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+
+	// делит роут по которому идет запрос по /
+	exploded := strings.Split(r.RequestURI, "/")
+
+	// берем ту часть где id и приводим к числу
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := exploded[3]
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	stringMap["year"] = year
+	stringMap["month"] = month
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.renderShowReservation(w, r, res, stringMap, forms.New(nil))
+}
+
+// renderShowReservation показывает страницу бронирования в админке, в том числе с ошибками формы после сохранения
+func (m *Repository) renderShowReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, stringMap map[string]string, form *forms.Form) {
+	payments, err := m.DB.GetPaymentsByReservationID(r.Context(), res.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	charges, err := m.DB.GetReservationCharges(r.Context(), res.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// после ошибки в форме показываются введенные даты и комната, а не сохраненные
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+	stringMap["room_id"] = strconv.Itoa(res.RoomID)
+
+	for _, field := range []string{"start_date", "end_date", "room_id"} {
+		if form.Get(field) != "" {
+			stringMap[field] = form.Get(field)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["payments"] = payments
+	data["quote"] = pricing.Summarize(charges)
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminReservationInvoice отдает счет по бронированию в PDF
+func (m *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// счет только скачивается: выставляется он при оплате или выезде, а не при просмотре
+	issued, err := m.DB.GetInvoice(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "The invoice is issued after payment or check-out")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d/show", chi.URLParam(r, "src"), id), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	document, err := m.invoiceDocument(r.Context(), res, issued)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, invoice.FileName(issued.InvoiceNumber)))
+	_, _ = w.Write(document)
+}
+
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// делит роут по которому идет запрос по /
+	exploded := strings.Split(r.RequestURI, "/")
+
+	// берем ту часть где id и приводим к числу
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := exploded[3]
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	before := audit.Reservation(res)
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	month := r.Form.Get("month")
+	year := r.Form.Get("year")
+
+	stringMap["year"] = year
+	stringMap["month"] = month
+
+	// старые значения нужны, чтобы понять, изменилось ли проживание, и освободить прежние даты для листа ожидания
+	moved := res
+	form := forms.New(r.PostForm)
+
+	// поля дат и комнаты могут отсутствовать (например, в старых формах) - тогда проживание не меняется
+	if form.Get("start_date") != "" || form.Get("end_date") != "" || form.Get("room_id") != "" {
+		form.Required("start_date", "end_date", "room_id")
+		form.IsDate("start_date", "end_date")
+		form.IsInt("room_id")
+
+		moved.StartDate, _ = time.Parse("2006-01-02", form.Get("start_date"))
+		moved.EndDate, _ = time.Parse("2006-01-02", form.Get("end_date"))
+		moved.RoomID, _ = strconv.Atoi(form.Get("room_id"))
+
+		// updated_at - версия бронирования на момент открытия страницы: перенос не перезапишет чужие изменения,
+		// сделанные после этого. При повторном показе формы версия остается той, что была у администратора
+		updatedAt, err := time.Parse(time.RFC3339Nano, form.Get("updated_at"))
+		if err != nil {
+			form.Errors.Add("start_date", "Invalid version of the reservation. Reload the page and try again.")
+		} else {
+			moved.UpdatedAt = updatedAt
+			res.UpdatedAt = updatedAt
+		}
+	}
+
+	changed := form.Valid() && (!moved.StartDate.Equal(res.StartDate) || !moved.EndDate.Equal(res.EndDate) || moved.RoomID != res.RoomID)
+
+	if changed {
+		refusal, err := m.moveRefusal(r.Context(), res)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		if refusal != "" {
+			form.Errors.Add("start_date", refusal)
+		}
+
+		// заезд в прошлом допустим, если дата заезда не менялась (гость уже живет и продлевает проживание)
+		for _, v := range stayrules.Check(nil, moved.StartDate, moved.EndDate, time.Now()) {
+			if v.Field == "start_date" && moved.StartDate.Equal(res.StartDate) {
+				continue
+			}
+			form.Errors.Add(v.Field, v.Message)
+		}
+	}
+
+	if !form.Valid() {
+		m.renderShowReservation(w, r, res, stringMap, form)
+		return
+	}
+
+	// перенос идет первым: он сверяет updated_at, который изменится после сохранения контактов
+	if changed {
+		err = m.moveReservation(r.Context(), res, moved, form.Get("notify_guest") != "")
+		if errors.Is(err, repository.ErrRoomNotAvailable) || errors.Is(err, repository.ErrReservationChanged) {
+			form.Errors.Add("start_date", moveErrorMessage(err))
+			m.renderShowReservation(w, r, res, stringMap, form)
+			return
+		}
+
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	err = m.DB.UpdateReservation(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	entry := models.AuditEntry{Action: audit.ActionUpdate, Entity: audit.EntityReservation, EntityID: res.ID,
+		Before: before, After: audit.Reservation(res)}
+
+	if changed {
+		entry.Action = audit.ActionMove
+		entry.After = audit.Reservation(moved)
+	}
+
+	if entry.Before != entry.After {
+		m.audit(r, entry)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "changes saved")
+
+	// Если изменение было произведенно со страницы бронирований то после отправки формы будем перенаправленны на страницу бронирования
+	// Если изменения были прозведенны со страницы календаря то мы будем после отправки формы также редирекнуты на календарь (т.к при календаре отправляется)
+	// два скрытых поля y, m
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+
+}
+
+// moveRefusal возвращает причину, по которой проживание бронирования нельзя менять, или "", если можно.
+// Гостя, который не приехал или уже выехал, переносить некуда, а выставленный счет фиксирует ночи и суммы
+func (m *Repository) moveRefusal(ctx context.Context, res models.Reservation) (string, error) {
+	switch {
+	case !res.CancelledAt.IsZero():
+		return "A cancelled reservation cannot be moved.", nil
+	case !res.NoShowAt.IsZero():
+		return "A reservation marked as no-show cannot be moved.", nil
+	case !res.CheckedOutAt.IsZero():
+		return "A reservation that has checked out cannot be moved.", nil
+	}
+
+	_, err := m.DB.GetInvoice(ctx, res.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return "The invoice for this reservation has been issued, its stay cannot be changed.", nil
+}
+
+// moveReservation переносит бронирование res на даты и в комнату из moved: стоимость пересчитывается
+// по текущим налогам и сохраненному промокоду, прежние даты предлагаются листу ожидания
+func (m *Repository) moveReservation(ctx context.Context, res, moved models.Reservation, notify bool) error {
+	room, err := m.DB.GetRoomByID(ctx, moved.RoomID)
+	if err != nil {
+		return err
+	}
+
+	moved.Room = room
+
+	var code *models.PromoCode
+	if moved.PromoCodeID > 0 {
+		c, err := m.DB.GetPromoCodeByID(ctx, moved.PromoCodeID)
+		if err != nil {
+			return err
+		}
+		code = &c
+	}
+
+	quote, err := m.quote(ctx, moved, code)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.UpdateReservationStay(ctx, moved, quote.Items)
+	if err != nil {
+		return err
+	}
+
+	// освободившиеся ночи могут быть нужны гостям из листа ожидания
+	if _, err := m.notifyWaitlist(ctx, res.RoomID, res.StartDate, res.EndDate); err != nil {
+		logging.FromContext(ctx).Error("cannot notify waitlist", "room_id", res.RoomID, "error", err)
+	}
+
+	if notify && moved.Email != "" {
+		hmtlMessage := fmt.Sprintf(`
+		<strong> Reservation Changed </strong><br>
+		Dear %s:, <br>
+		Your reservation has been changed. New dates: %s to %s, room: %s.
+	`, moved.FirstName,
+			moved.StartDate.Format("2006-01-02"),
+			moved.EndDate.Format("2006-01-02"),
+			room.RoomName)
+
+		m.App.MailChan <- models.MailData{
+			To:       moved.Email,
+			From:     "admin@gmail.com",
+			Subject:  "Reservation changed",
+			Content:  hmtlMessage,
+			Template: "basic.html",
+			Logger:   logging.FromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// AdminAuditLog показывает журнал изменений с фильтрами по сущности (например, одному бронированию),
+// администратору и действию
+func (m *Repository) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := models.AuditFilter{
+		Entity:  q.Get("entity"),
+		Action:  q.Get("action"),
+		PerPage: audit.PerPage,
+	}
+
+	filter.EntityID, _ = strconv.Atoi(q.Get("entity_id"))
+	filter.UserID, _ = strconv.Atoi(q.Get("user"))
+	filter.Page, _ = strconv.Atoi(q.Get("page"))
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	entries, total, err := m.DB.GetAuditEntries(r.Context(), filter)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// ссылки на соседние страницы сохраняют фильтры
+	pageURL := func(page int) string {
+		v := url.Values{}
+		for _, key := range []string{"entity", "entity_id", "user", "action"} {
+			if q.Get(key) != "" {
+				v.Set(key, q.Get(key))
+			}
+		}
+		v.Set("page", strconv.Itoa(page))
+		return "/admin/audit-log?" + v.Encode()
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["entity"] = filter.Entity
+	stringMap["entity_id"] = q.Get("entity_id")
+	stringMap["user"] = q.Get("user")
+	stringMap["action"] = filter.Action
+
+	if filter.Page > 1 {
+		stringMap["prev_url"] = pageURL(filter.Page - 1)
+	}
+
+	if filter.Page*filter.PerPage < total {
+		stringMap["next_url"] = pageURL(filter.Page + 1)
+	}
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+	intMap["page"] = filter.Page
+
+	data := make(map[string]interface{})
+	data["rows"] = audit.Rows(entries)
+	data["actions"] = audit.Actions
+	data["entities"] = audit.Entities
+
+	render.Template(w, r, "admin-audit-log.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+}
+
+// moveErrorMessage - текст для администратора, если перенести бронирование не удалось
+func moveErrorMessage(err error) string {
+	if errors.Is(err, repository.ErrReservationChanged) {
+		return "This reservation has been changed by someone else. Reload the page and try again."
+	}
+
+	return "This room is not available for the selected dates."
+}
+
+// AdminReservationsTimeline показывает календарь-шкалу: комнаты по строкам, дни по столбцам.
+// Сами данные страница загружает из AdminReservationsTimelineJSON
+func (m *Repository) AdminReservationsTimeline(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+	if view != timeline.ViewWeek && view != timeline.ViewCustom {
+		view = timeline.ViewMonth
+	}
+
+	start, end, err := timeline.Range(view, r.URL.Query().Get("start"), r.URL.Query().Get("end"), time.Now())
+	if err != nil {
+		view = timeline.ViewMonth
+		start, end, _ = timeline.Range(view, "", "", time.Now())
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["view"] = view
+	stringMap["start"] = start.Format("2006-01-02")
+	stringMap["end"] = end.AddDate(0, 0, -1).Format("2006-01-02")
+
+	render.Template(w, r, "admin-reservations-timeline.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+	})
+}
+
+// AdminReservationsTimelineJSON отдает бронирования и блокировки всех комнат за неделю, месяц или произвольный период
+func (m *Repository) AdminReservationsTimelineJSON(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+
+	start, end, err := timeline.Range(view, r.URL.Query().Get("start"), r.URL.Query().Get("end"), time.Now())
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, jsonResponse{Message: fmt.Sprintf("Invalid date range (at most %d days)", timeline.MaxDays)})
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	restrictions, err := m.DB.GetCalendarRestrictions(r.Context(), start, end)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, timeline.Build(view, rooms, restrictions, start, end))
+}
+
+// AdminPostReservationsTimeline переносит бронирование, перетащенное на календаре: в другую комнату, на другие даты
+// или с другой длительностью. updated_at из календаря защищает от перезаписи чужих изменений
+func (m *Repository) AdminPostReservationsTimeline(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, jsonResponse{Message: "Cannot parse form"})
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("reservation_id", "room_id", "start_date", "end_date", "updated_at")
+	form.IsInt("reservation_id", "room_id")
+	form.IsDate("start_date", "end_date")
+
+	updatedAt, err := time.Parse(time.RFC3339Nano, form.Get("updated_at"))
+	if err != nil {
+		form.Errors.Add("updated_at", "Invalid version of the reservation.")
+	}
+
+	if !form.Valid() {
+		writeJSON(w, r, http.StatusBadRequest, jsonResponse{Message: "Invalid data"})
+		return
+	}
+
+	id, _ := strconv.Atoi(form.Get("reservation_id"))
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		writeJSON(w, r, http.StatusNotFound, jsonResponse{Message: "Reservation not found"})
+		return
+	}
+
+	moved := res
+	moved.RoomID, _ = strconv.Atoi(form.Get("room_id"))
+	moved.StartDate, _ = time.Parse("2006-01-02", form.Get("start_date"))
+	moved.EndDate, _ = time.Parse("2006-01-02", form.Get("end_date"))
+	moved.UpdatedAt = updatedAt
+
+	resp := jsonResponse{
+		RoomID:    strconv.Itoa(moved.RoomID),
+		StartDate: form.Get("start_date"),
+		EndDate:   form.Get("end_date"),
+	}
+
+	refusal, err := m.moveRefusal(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if refusal != "" {
+		resp.Message = refusal
+		writeJSON(w, r, http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	// как и на странице бронирования: заезд в прошлом допустим, только если его не переносили
+	for _, v := range stayrules.Check(nil, moved.StartDate, moved.EndDate, time.Now()) {
+		if v.Field == "start_date" && moved.StartDate.Equal(res.StartDate) {
+			continue
+		}
+
+		resp.Message = v.Message
+		writeJSON(w, r, http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	err = m.moveReservation(r.Context(), res, moved, form.Get("notify_guest") != "")
+	if errors.Is(err, repository.ErrRoomNotAvailable) || errors.Is(err, repository.ErrReservationChanged) {
+		resp.Message = moveErrorMessage(err)
+		writeJSON(w, r, http.StatusConflict, resp)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.audit(r, models.AuditEntry{Action: audit.ActionMove, Entity: audit.EntityReservation, EntityID: res.ID,
+		Before: audit.Reservation(res), After: audit.Reservation(moved)})
+
+	resp.OK = true
+	resp.Message = "Reservation moved"
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+
+	// Получение текущего времени
+	now := time.Now()
+
+	// Получение кверипараметра если такой будет передан
+	if r.URL.Query().Get("y") != "" {
+		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	nextMonth := next.Format("01")
+	nextMonthYear := next.Format("2006")
+
+	lastMonth := last.Format("01")
+	lastMonthYear := last.Format("2006")
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = nextMonth
+	stringMap["next_month_year"] = nextMonthYear
+	stringMap["last_month"] = lastMonth
+	stringMap["last_month_year"] = lastMonthYear
+
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	// Получение первого и последнего месяца в году
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	// чистая или грязная комната - по последней задаче уборки на сегодня
+	latest, err := m.DB.GetLatestHousekeepingTasks(r.Context(), frontdesk.Day(time.Now()))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	for roomID, status := range housekeeping.RoomStatus(rooms, latest) {
+		stringMap[fmt.Sprintf("room_status_%d", roomID)] = status
+	}
+
+	for _, x := range rooms {
+
+		//
+		//
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+
+		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-02")] = 0
+			blockMap[d.Format("2006-01-02")] = 0
+		}
+
+		// Возвращаем массив всех ограничений по данной комнате с первого по последний день текущего месяца
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
+
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		for _, y := range restrictions {
+			// Если у даты есть резервейшонID то есть на данные даты комната кем-то заброненна добавляем его в reservationMap.
+			if y.ReservationID > 0 {
+				// на каждую бронь например с 15-19 бронь к каждым суткам добавляется reservationID одна из записей мапы ниже
+				// reservationMap[y.StartDate.Format("2006-01-02")] = y.ReservationID
+				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
+					reservationMap[d.Format("2006-01-02")] = y.ReservationID
+				}
+			} else if y.MaintenanceTicketID == 0 {
+				// Если у даты есть блокировка но reservationID 0 значит на данные числа номер закрыт админом, добавляем его в blockMap
+				blockMap[y.StartDate.Format("2006-01-02")] = y.ID
+			}
+		}
+
+		// Добавляем эти две мапы с текущим айди комнаты в нашу мапу data
+		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		// дни, закрытые заявками на ремонт, ведут на заявку вместо флажка блокировки
+		data[fmt.Sprintf("ticket_map_%d", x.ID)] = maintenance.Days(restrictions)
+
+		// версия блокировок уходит в форму: если их изменят в другой вкладке, сохранение сообщит о конфликте
+		stringMap[fmt.Sprintf("block_version_%d", x.ID)] = blocks.Version(restrictions)
+	}
+
+	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		IntMap:    intMap,
+	})
+}
+
+func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	/*log.Println("=== Форма данных (r.PostForm) ===")
+	for key, values := range r.PostForm {
+		log.Printf("%s: %v\n", key, values)
+	}
+	log.Println("================================")*/
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+
+	rooms, err := m.DB.AllRooms(r.Context())
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	firstOfMonth := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	redirect := fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month)
+
+	var add, removed []models.RoomRestriction
+	var remove []int
+	var conflicts []string
+
+	// отпечатки блокировок, которые видел администратор, сверяются еще раз при сохранении
+	versions := make(map[int]string)
+
+	// освобожденные снятием блокировок дни по комнатам, по ним оповещается лист ожидания
+	freed := make(map[int][]time.Time)
+
+	for _, x := range rooms {
+		// комнаты, которых не было на странице, не меняются
+		if !form.Has(fmt.Sprintf("version_%d", x.ID)) {
+			continue
+		}
+
+		change := blocks.Change{
+			RoomID:  x.ID,
+			Version: form.Get(fmt.Sprintf("version_%d", x.ID)),
+			Shown:   make(map[string]int),
+			Kept:    make(map[string]bool),
+		}
+
+		// block_{комната}_{дата} = ID - блокировки, которые были показаны; remove_block_{комната}_{дата} - флажок остался отмечен;
+		// add_block_{комната}_{дата} - новая блокировка
+		for name := range r.PostForm {
+			var prefix string
+			for _, p := range []string{"block_", "remove_block_", "add_block_"} {
+				if strings.HasPrefix(name, fmt.Sprintf("%s%d_", p, x.ID)) {
+					prefix = p
+				}
+			}
+
+			if prefix == "" {
+				continue
+			}
+
+			day, err := time.Parse("2006-01-02", strings.TrimPrefix(name, fmt.Sprintf("%s%d_", prefix, x.ID)))
+			if err != nil {
+				continue
+			}
+
+			key := day.Format("2006-01-02")
+
+			switch prefix {
+			case "block_":
+				id, err := strconv.Atoi(form.Get(name))
+				if err != nil {
+					continue
+				}
+				change.Shown[key] = id
+			case "remove_block_":
+				change.Kept[key] = true
+			case "add_block_":
+				change.Added = append(change.Added, day)
+			}
+		}
+
+		current, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		versions[x.ID] = change.Version
+
+		roomRemove, roomAdd, roomConflicts := blocks.Plan(change, current)
+		for _, msg := range roomConflicts {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s", x.RoomName, msg))
+		}
+
+		for day := range change.Shown {
+			if !change.Kept[day] {
+				t, _ := time.Parse("2006-01-02", day)
+				freed[x.ID] = append(freed[x.ID], t)
+			}
+		}
+
+		// снятые блокировки целиком нужны для журнала изменений
+		for _, rr := range current {
+			for _, id := range roomRemove {
+				if rr.ID == id {
+					removed = append(removed, rr)
+				}
+			}
+		}
+
+		remove = append(remove, roomRemove...)
+		add = append(add, roomAdd...)
+	}
+
+	// при любом конфликте не применяется ничего, чтобы не сохранить изменения поверх чужих
+	if len(conflicts) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Nothing was saved, reload the calendar and try again. "+strings.Join(conflicts, "; "))
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateRoomBlocks(r.Context(), versions, firstOfMonth, lastOfMonth, add, remove)
+	if errors.Is(err, repository.ErrBlocksChanged) {
+		// между проверкой и сохранением блокировки успел поменять другой администратор
+		m.App.Session.Put(r.Context(), "error", "Nothing was saved, reload the calendar and try again. Blocks were changed by someone else")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Nothing was saved: some of the days have just been booked. Reload the calendar and try again.")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	for _, rr := range removed {
+		m.audit(r, models.AuditEntry{Action: audit.ActionDelete, Entity: audit.EntityRoomBlock, EntityID: rr.ID,
+			Before: audit.Block(rr)})
+	}
+
+	for _, rr := range add {
+		m.audit(r, models.AuditEntry{Action: audit.ActionCreate, Entity: audit.EntityRoomBlock, After: audit.Block(rr)})
+	}
+
+	for roomID, days := range freed {
+		from, to := days[0], days[0].AddDate(0, 0, 1)
+		for _, d := range days {
+			if d.Before(from) {
+				from = d
+			}
+			if !d.Before(to) {
+				to = d.AddDate(0, 0, 1)
+			}
+		}
+
+		if _, err := m.notifyWaitlist(r.Context(), roomID, from, to); err != nil {
+			logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", roomID, "error", err)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	res, resErr := m.DB.GetReservationByID(r.Context(), id)
+
+	err := m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("cannot mark reservation processed", "reservation_id", id, "error", err)
+	} else if resErr == nil {
+		before := audit.Reservation(res)
+		res.Processed = 1
+		m.audit(r, models.AuditEntry{Action: audit.ActionProcess, Entity: audit.EntityReservation, EntityID: id,
+			Before: before, After: audit.Reservation(res)})
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "reservation mark as processed")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+
+}
+
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	// даты бронирования нужны после удаления, чтобы оповестить лист ожидания
+	res, resErr := m.DB.GetReservationByID(r.Context(), id)
+
+	err := m.DB.DeleteReservation(r.Context(), id)
+	if errors.Is(err, repository.ErrReservationReferenced) {
+		m.App.Session.Put(r.Context(), "error", "This reservation has payments or an invoice and cannot be deleted, cancel it instead")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d/show", src, id), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if resErr == nil {
+		m.audit(r, models.AuditEntry{Action: audit.ActionDelete, Entity: audit.EntityReservation, EntityID: id,
+			Before: audit.Reservation(res)})
+	}
+
+	if resErr == nil && res.RoomID > 0 {
+		if _, err := m.notifyWaitlist(r.Context(), res.RoomID, res.StartDate, res.EndDate); err != nil {
+			logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", res.RoomID, "error", err)
+		}
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+
+}
+
+// AdminCancelReservation отменяет бронирование: оно остается в базе для отчетов, а даты комнаты освобождаются
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	err = m.DB.CancelReservation(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	before := audit.Reservation(res)
+	res.CancelledAt = time.Now()
+	m.audit(r, models.AuditEntry{Action: audit.ActionCancel, Entity: audit.EntityReservation, EntityID: id,
+		Before: before, After: audit.Reservation(res)})
+
+	if _, err := m.notifyWaitlist(r.Context(), res.RoomID, res.StartDate, res.EndDate); err != nil {
+		logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", res.RoomID, "error", err)
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation cancelled")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// AdminFrontDesk показывает заезды, выезды и проживающих гостей на день (?date=, по умолчанию сегодня)
+func (m *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	day := frontdesk.Day(now)
+
+	if d := r.URL.Query().Get("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid date")
+			http.Redirect(w, r, "/admin/front-desk", http.StatusSeeOther)
+			return
+		}
+		day = parsed
+	}
+
+	onDate, err := m.DB.GetReservationsOnDate(r.Context(), day)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	split := dashboard.SplitDay(day, onDate)
+
+	data := make(map[string]interface{})
+	data["sections"] = []frontdesk.Section{
+		{Title: "Arrivals", Rows: frontdesk.Rows(split.Arrivals, now)},
+		{Title: "Departures", Rows: frontdesk.Rows(split.Departures, now)},
+		{Title: "In house", Rows: frontdesk.Rows(split.InHouse, now)},
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = day.Format("2006-01-02")
+	stringMap["today"] = frontdesk.Day(now).Format("2006-01-02")
+	stringMap["cutoff"] = fmt.Sprintf("%02d:00", int(frontdesk.NoShowCutoff.Hours()))
+
+	render.Template(w, r, "admin-front-desk.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// frontDeskRedirect возвращает на стойку регистрации с сообщением; если ok == false, сообщение показывается как ошибка
+func (m *Repository) frontDeskRedirect(w http.ResponseWriter, r *http.Request, message string, ok bool) {
+	key := "flash"
+	if !ok {
+		key = "error"
+	}
+
+	m.App.Session.Put(r.Context(), key, message)
+	http.Redirect(w, r, "/admin/front-desk", http.StatusSeeOther)
+}
+
+// AdminPostCheckIn заселяет гостя: записывает фактическое время заезда и предъявленный документ
+func (m *Repository) AdminPostCheckIn(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("id_document_type", "id_document_number")
+	if !form.Valid() {
+		m.frontDeskRedirect(w, r, "ID document type and number are required", false)
+		return
+	}
+
+	now := time.Now()
+
+	if err := frontdesk.CanCheckIn(res, now); err != nil {
+		m.frontDeskRedirect(w, r, err.Error(), false)
+		return
+	}
+
+	docType := strings.TrimSpace(r.Form.Get("id_document_type"))
+	docNumber := strings.TrimSpace(r.Form.Get("id_document_number"))
+
+	err = m.DB.CheckInReservation(r.Context(), id, now, docType, docNumber)
+	if errors.Is(err, repository.ErrReservationChanged) {
+		m.frontDeskRedirect(w, r, "The reservation has just been changed by someone else, reload the page and try again", false)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	before := audit.Reservation(res)
+	res.CheckedInAt = now
+	res.Processed = 1
+	res.IDDocumentType = docType
+	res.IDDocumentNumber = docNumber
+	m.audit(r, models.AuditEntry{Action: audit.ActionCheckIn, Entity: audit.EntityReservation, EntityID: id,
+		Before: before, After: audit.Reservation(res)})
+
+	m.frontDeskRedirect(w, r, fmt.Sprintf("%s %s checked in", res.FirstName, res.LastName), true)
+}
+
+// AdminPostCheckOut выселяет гостя. Дата выезда (departure_date) по умолчанию сегодня: если она раньше даты выезда
+// бронирования, освободившиеся ночи отдаются листу ожидания, если позже - комната продлевается, если свободна.
+// Начисления при раннем и позднем выезде не пересчитываются, это делается вручную на странице бронирования
+func (m *Repository) AdminPostCheckOut(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := frontdesk.CanCheckOut(res); err != nil {
+		m.frontDeskRedirect(w, r, err.Error(), false)
+		return
+	}
+
+	var requested time.Time
+	if d := r.Form.Get("departure_date"); d != "" {
+		requested, err = time.Parse("2006-01-02", d)
+		if err != nil {
+			m.frontDeskRedirect(w, r, "Invalid departure date", false)
+			return
+		}
+	}
+
+	now := time.Now()
+
+	end, err := frontdesk.Departure(res, now, requested)
+	if err != nil {
+		m.frontDeskRedirect(w, r, err.Error(), false)
+		return
+	}
+
+	err = m.DB.CheckOutReservation(r.Context(), id, now, end)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.frontDeskRedirect(w, r, "The room is booked after the current stay, the departure cannot be extended", false)
+		return
+	}
+	if errors.Is(err, repository.ErrReservationChanged) {
+		m.frontDeskRedirect(w, r, "The reservation has just been moved to another room, reload the page and try again", false)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	before := audit.Reservation(res)
+	oldEnd := res.EndDate
+	res.CheckedOutAt = now
+	res.EndDate = end
+	m.audit(r, models.AuditEntry{Action: audit.ActionCheckOut, Entity: audit.EntityReservation, EntityID: id,
+		Before: before, After: audit.Reservation(res)})
+
+	if end.Before(oldEnd) {
+		if _, err := m.notifyWaitlist(r.Context(), res.RoomID, end, oldEnd); err != nil {
+			logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", res.RoomID, "error", err)
+		}
+	}
+
+	m.sendInvoice(r.Context(), res)
+
+	// после выезда комната сразу попадает на доску уборки
+	_, err = m.DB.InsertHousekeepingTasks(r.Context(), []models.HousekeepingTask{{RoomID: res.RoomID, ReservationID: id,
+		TaskDate: frontdesk.Day(now), Kind: housekeeping.KindDeparture, Status: housekeeping.StatusDirty}})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("cannot create departure task", "room_id", res.RoomID, "error", err)
+	}
+
+	m.frontDeskRedirect(w, r, fmt.Sprintf("%s %s checked out", res.FirstName, res.LastName), true)
+}
+
+// AdminPostNoShow отмечает, что гость не приехал, и освобождает комнату на весь срок бронирования
+func (m *Repository) AdminPostNoShow(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	if err := frontdesk.CanMarkNoShow(res, now); err != nil {
+		m.frontDeskRedirect(w, r, err.Error(), false)
+		return
+	}
+
+	err = m.DB.MarkNoShow(r.Context(), id, now)
+	if errors.Is(err, repository.ErrReservationChanged) {
+		m.frontDeskRedirect(w, r, "The reservation has just been changed by someone else, reload the page and try again", false)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	before := audit.Reservation(res)
+	res.NoShowAt = now
+	m.audit(r, models.AuditEntry{Action: audit.ActionNoShow, Entity: audit.EntityReservation, EntityID: id,
+		Before: before, After: audit.Reservation(res)})
+
+	if _, err := m.notifyWaitlist(r.Context(), res.RoomID, res.StartDate, res.EndDate); err != nil {
+		logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", res.RoomID, "error", err)
+	}
+
+	m.frontDeskRedirect(w, r, fmt.Sprintf("%s %s marked as no-show", res.FirstName, res.LastName), true)
+}
+
+// AdminHousekeeping показывает доску уборки на день (?date=, по умолчанию сегодня) и горничных, которым ее можно поручить
+func (m *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+	day := frontdesk.Day(time.Now())
+
+	if d := r.URL.Query().Get("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid date")
+			http.Redirect(w, r, "/admin/housekeeping", http.StatusSeeOther)
+			return
+		}
+		day = parsed
+	}
+
+	tasks, err := m.DB.GetHousekeepingTasks(r.Context(), day)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	staff, err := m.DB.GetUsersByRole(r.Context(), housekeeping.Role)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["board"] = housekeeping.Board(tasks)
+	data["staff"] = staff
+	data["statuses"] = housekeeping.Statuses
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = day.Format("2006-01-02")
+
+	render.Template(w, r, "admin-housekeeping.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostHousekeepingGenerate создает задачи уборки на день по выездам и проживающим гостям.
+// Повторный запуск не трогает уже созданные задачи
+func (m *Repository) AdminPostHousekeepingGenerate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	day, err := time.Parse("2006-01-02", r.Form.Get("date"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid date")
+		http.Redirect(w, r, "/admin/housekeeping", http.StatusSeeOther)
+		return
+	}
+
+	onDate, err := m.DB.GetReservationsOnDate(r.Context(), day)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	created, err := m.DB.InsertHousekeepingTasks(r.Context(), housekeeping.Generate(day, onDate))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%d cleaning tasks created", created))
+	http.Redirect(w, r, "/admin/housekeeping?date="+day.Format("2006-01-02"), http.StatusSeeOther)
+}
+
+// AdminPostHousekeepingTask меняет состояние задачи уборки и назначенную горничную
+func (m *Repository) AdminPostHousekeepingTask(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	task, err := m.DB.GetHousekeepingTaskByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	redirect := "/admin/housekeeping?date=" + task.TaskDate.Format("2006-01-02")
+
+	status := r.Form.Get("status")
+	if err := housekeeping.CanMove(task.Status, status); err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	assignedTo, _ := strconv.Atoi(r.Form.Get("assigned_to"))
+
+	if assignedTo > 0 {
+		staff, err := m.DB.GetUsersByRole(r.Context(), housekeeping.Role)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		found := false
+		for _, u := range staff {
+			if u.ID == assignedTo {
+				found = true
+			}
+		}
+
+		if !found {
+			m.App.Session.Put(r.Context(), "error", "Tasks can only be assigned to housekeeping staff")
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+			return
+		}
+	}
+
+	before := audit.Housekeeping(task)
+	task.Status = status
+	task.AssignedTo = assignedTo
+
+	err = m.DB.UpdateHousekeepingTask(r.Context(), task)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.audit(r, models.AuditEntry{Action: audit.ActionUpdate, Entity: audit.EntityHousekeeping, EntityID: id,
+		Before: before, After: audit.Housekeeping(task)})
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s: task saved", task.Room.RoomName))
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// AdminMaintenance показывает заявки на ремонт: по умолчанию только незакрытые, ?show=all - все
+func (m *Repository) AdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	showAll := r.URL.Query().Get("show") == "all"
+
+	tickets, err := m.DB.GetMaintenanceTickets(r.Context(), !showAll)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["tickets"] = tickets
+
+	stringMap := make(map[string]string)
+	if showAll {
+		stringMap["show"] = "all"
+	}
+
+	render.Template(w, r, "admin-maintenance.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminMaintenanceTicket показывает форму новой ({id} = new) или существующей заявки.
+// Из календаря новая заявка открывается с ?room_id= и ?date=
+func (m *Repository) AdminMaintenanceTicket(w http.ResponseWriter, r *http.Request) {
+	ticket := models.MaintenanceTicket{
+		Priority:  maintenance.PriorityNormal,
+		Status:    maintenance.StatusOpen,
+		StartDate: frontdesk.Day(time.Now()),
+	}
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		ticket, err = m.DB.GetMaintenanceTicketByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	} else {
+		ticket.RoomID, _ = strconv.Atoi(r.URL.Query().Get("room_id"))
+		if d, err := time.Parse("2006-01-02", r.URL.Query().Get("date")); err == nil {
+			ticket.StartDate = d
+		}
+	}
+
+	m.renderMaintenanceTicket(w, r, ticket, forms.New(nil))
+}
+
+func (m *Repository) renderMaintenanceTicket(w http.ResponseWriter, r *http.Request, ticket models.MaintenanceTicket, form *forms.Form) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["ticket"] = ticket
+	data["rooms"] = rooms
+	data["priorities"] = maintenance.Priorities
+	data["statuses"] = maintenance.Statuses
+
+	render.Template(w, r, "admin-maintenance-ticket.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostMaintenanceTicket создает или обновляет заявку. Открытая заявка "out of order" закрывает комнату
+// до ожидаемой даты ремонта, после закрытия заявки блокировка снимается и лист ожидания получает освободившиеся дни
+func (m *Repository) AdminPostMaintenanceTicket(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	var ticket, before models.MaintenanceTicket
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		before, err = m.DB.GetMaintenanceTicketByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		ticket = before
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "description", "start_date")
+	form.IsInt("room_id")
+	form.IsDate("start_date", "expected_resolution")
+
+	ticket.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	ticket.Description = strings.TrimSpace(r.Form.Get("description"))
+	ticket.Priority = r.Form.Get("priority")
+	ticket.Status = r.Form.Get("status")
+	ticket.OutOfOrder = r.Form.Get("out_of_order") != ""
+	ticket.StartDate, _ = time.Parse("2006-01-02", r.Form.Get("start_date"))
+	ticket.ExpectedResolution, _ = time.Parse("2006-01-02", r.Form.Get("expected_resolution"))
+
+	if err := maintenance.Validate(ticket); err != nil {
+		form.Errors.Add("expected_resolution", err.Error())
+	}
+
+	if !form.Valid() {
+		m.renderMaintenanceTicket(w, r, ticket, form)
+		return
+	}
+
+	switch {
+	case maintenance.IsOpen(ticket):
+		ticket.ClosedAt = time.Time{}
+	case ticket.ClosedAt.IsZero():
+		ticket.ClosedAt = time.Now()
+	}
+
+	var block *models.RoomRestriction
+	if rr, ok := maintenance.Block(ticket); ok {
+		block = &rr
+	}
+
+	id, err := m.DB.SaveMaintenanceTicket(r.Context(), ticket, block)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		form.Errors.Add("expected_resolution", "The room has bookings or blocks in this period, move them before closing the room.")
+		m.renderMaintenanceTicket(w, r, ticket, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	ticket.ID = id
+
+	if before.ID == 0 {
+		m.audit(r, models.AuditEntry{Action: audit.ActionCreate, Entity: audit.EntityMaintenance, EntityID: id,
+			After: audit.Maintenance(ticket)})
+	} else {
+		m.audit(r, models.AuditEntry{Action: audit.ActionUpdate, Entity: audit.EntityMaintenance, EntityID: id,
+			Before: audit.Maintenance(before), After: audit.Maintenance(ticket)})
+	}
+
+	// прежняя блокировка снята: освободившиеся дни отдаются листу ожидания
+	if old, ok := maintenance.Block(before); ok {
+		if _, err := m.notifyWaitlist(r.Context(), old.RoomID, old.StartDate, old.EndDate); err != nil {
+			logging.FromContext(r.Context()).Error("cannot notify waitlist", "room_id", old.RoomID, "error", err)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Maintenance ticket saved")
+	http.Redirect(w, r, "/admin/maintenance", http.StatusSeeOther)
+}
+
+// buildReport строит отчет по параметрам запроса: {report} из url, start и end (включительно) из query.
+// Без дат отчет строится за текущий месяц
+func (m *Repository) buildReport(r *http.Request, name string) (*reports.Report, error) {
+	layout := "2006-01-02"
+
+	start, end := dashboard.Month(time.Now())
+	end = end.AddDate(0, 0, -1)
+
+	if s := r.URL.Query().Get("start"); s != "" {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date %q", s)
+		}
+		start = t
+	}
+
+	if e := r.URL.Query().Get("end"); e != "" {
+		t, err := time.Parse(layout, e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end date %q", e)
+		}
+		end = t
+	}
+
+	if end.Before(start) {
+		return nil, errors.New("end date must not be before start date")
+	}
+
+	// конец периода в отчетах не включается
+	end = end.AddDate(0, 0, 1)
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := m.DB.GetReportReservations(r.Context(), start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return reports.Build(name, start, end, rooms, reservations)
+}
+
+// AdminReports показывает выбранный отчет с фильтром по датам и ссылками на выгрузку в CSV и XLSX
+func (m *Repository) AdminReports(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("report")
+	if name == "" {
+		name = reports.Available[0].Name
+	}
+
+	report, err := m.buildReport(r, name)
+	if errors.Is(err, reports.ErrUnknownReport) {
+		m.App.Session.Put(r.Context(), "error", "Unknown report")
+		http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/admin/reports?report="+url.QueryEscape(name), http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["report"] = report
+	data["kinds"] = reports.Available
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = report.Start.Format("2006-01-02")
+	stringMap["end"] = report.End.AddDate(0, 0, -1).Format("2006-01-02")
+
+	render.Template(w, r, "admin-reports.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminReportExport отдает отчет файлом: /admin/reports/{report}/csv или /admin/reports/{report}/xlsx
+func (m *Repository) AdminReportExport(w http.ResponseWriter, r *http.Request) {
+	report, err := m.buildReport(r, chi.URLParam(r, "report"))
+	if errors.Is(err, reports.ErrUnknownReport) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	format := chi.URLParam(r, "format")
+
+	switch format {
+	case "csv":
+		err = report.WriteCSV(&buf)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case "xlsx":
+		err = report.WriteXLSX(&buf)
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, report.FileName(format)))
+	_, _ = w.Write(buf.Bytes())
+}
+
+// AdminStayRules показывает список правил проживания и форму добавления нового правила
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := m.DB.AllStayRules(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-stay-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostStayRules создает новое правило проживания
+func (m *Repository) AdminPostStayRules(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("rule_name")
+	form.IsInt("room_id", "min_nights", "max_nights", "min_lead_days", "max_advance_days")
+	form.IsDate("season_start", "season_end")
+
+	if !form.Valid() {
+		rules, err := m.DB.AllStayRules(r.Context())
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		rooms, err := m.DB.AllRooms(r.Context())
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["rules"] = rules
+		data["rooms"] = rooms
+
+		render.Template(w, r, "admin-stay-rules.page.tmpl", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	rule := models.StayRule{
+		RuleName: r.Form.Get("rule_name"),
+	}
+
+	// ошибки уже проверены формой, пустые значения остаются нулями
+	rule.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	rule.MinNights, _ = strconv.Atoi(r.Form.Get("min_nights"))
+	rule.MaxNights, _ = strconv.Atoi(r.Form.Get("max_nights"))
+	rule.MinLeadDays, _ = strconv.Atoi(r.Form.Get("min_lead_days"))
+	rule.MaxAdvanceDays, _ = strconv.Atoi(r.Form.Get("max_advance_days"))
+	rule.SeasonStart, _ = time.Parse("2006-01-02", r.Form.Get("season_start"))
+	rule.SeasonEnd, _ = time.Parse("2006-01-02", r.Form.Get("season_end"))
+
+	// дни недели приходят чекбоксами arrival_days=0..6 и departure_days=0..6
+	for _, d := range r.Form["arrival_days"] {
+		day, err := strconv.Atoi(d)
+		if err == nil && day >= 0 && day <= 6 {
+			rule.ArrivalDays |= stayrules.DaysMask(time.Weekday(day))
+		}
+	}
+
+	for _, d := range r.Form["departure_days"] {
+		day, err := strconv.Atoi(d)
+		if err == nil && day >= 0 && day <= 6 {
+			rule.DepartureDays |= stayrules.DaysMask(time.Weekday(day))
+		}
+	}
+
+	id, err := m.DB.InsertStayRule(r.Context(), rule)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.audit(r, models.AuditEntry{Action: audit.ActionCreate, Entity: audit.EntityStayRule, EntityID: id,
+		After: audit.StayRule(rule)})
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule saved")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
 }
 
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+// AdminDeleteStayRule удаляет правило проживания
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-	reservations, err := m.DB.AllNewReservations()
+	rule, err := m.DB.GetStayRuleByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
+	err = m.DB.DeleteStayRule(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	m.audit(r, models.AuditEntry{Action: audit.ActionDelete, Entity: audit.EntityStayRule, EntityID: id,
+		Before: audit.StayRule(rule)})
 
-	render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
 }
 
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+// AdminTaxRules показывает налоги и сборы и форму добавления нового
+func (m *Repository) AdminTaxRules(w http.ResponseWriter, r *http.Request) {
+	m.renderTaxRules(w, r, forms.New(nil))
+}
 
-	reservations, err := m.DB.AllReservations()
+func (m *Repository) renderTaxRules(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rules, err := m.DB.AllTaxRules(r.Context())
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["rules"] = rules
 
-	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
+	render.Template(w, r, "admin-tax-rules.page.tmpl", &models.TemplateData{
 		Data: data,
+		Form: form,
 	})
 }
 
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-
-	// делит роут по которому идет запрос по /
-	exploded := strings.Split(r.RequestURI, "/")
-
-	// берем ту часть где id и приводим к числу
-	id, err := strconv.Atoi(exploded[4])
+// AdminPostTaxRules создает новый налог или сбор
+func (m *Repository) AdminPostTaxRules(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	src := exploded[3]
+	form := forms.New(r.PostForm)
+	form.Required("name", "amount")
+	form.IsDate("valid_from", "valid_to")
+
+	rule := models.TaxRule{
+		Name:        r.Form.Get("name"),
+		Kind:        pricing.KindTax,
+		Calculation: pricing.CalcFixed,
+		Per:         pricing.PerStay,
+	}
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
+	if r.Form.Get("kind") == pricing.KindFee {
+		rule.Kind = pricing.KindFee
+	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	if r.Form.Get("calculation") == pricing.CalcPercent {
+		rule.Calculation = pricing.CalcPercent
+	}
 
-	stringMap["year"] = year
-	stringMap["month"] = month
+	switch per := r.Form.Get("per"); per {
+	case pricing.PerNight, pricing.PerGuest, pricing.PerGuestNight:
+		rule.Per = per
+	}
 
-	res, err := m.DB.GetReservationByID(id)
+	if r.Form.Get("amount") != "" {
+		rule.Amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+		if err != nil {
+			form.Errors.Add("amount", "This field must be a number with at most two decimal places.")
+		}
+	}
 
-	if err != nil {
-		helpers.ServerError(w, err)
+	if !form.Valid() {
+		m.renderTaxRules(w, r, form)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservation"] = res
-
-	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		Form:      forms.New(nil),
-	})
-}
-
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	// ошибки уже проверены формой, пустые даты остаются нулевыми
+	rule.ValidFrom, _ = time.Parse("2006-01-02", r.Form.Get("valid_from"))
+	rule.ValidTo, _ = time.Parse("2006-01-02", r.Form.Get("valid_to"))
 
-	err := r.ParseForm()
+	id, err := m.DB.InsertTaxRule(r.Context(), rule)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	// делит роут по которому идет запрос по /
-	exploded := strings.Split(r.RequestURI, "/")
+	m.audit(r, models.AuditEntry{Action: audit.ActionCreate, Entity: audit.EntityTaxRule, EntityID: id,
+		After: audit.TaxRule(rule)})
 
-	// берем ту часть где id и приводим к числу
-	id, err := strconv.Atoi(exploded[4])
+	m.App.Session.Put(r.Context(), "flash", "Tax rule saved")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+// AdminDeleteTaxRule удаляет налог или сбор. Уже сделанные бронирования не пересчитываются
+func (m *Repository) AdminDeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	src := exploded[3]
-
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	res, err := m.DB.GetReservationByID(id)
+	rule, err := m.DB.GetTaxRuleByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
-
-	err = m.DB.UpdateReservation(res)
+	err = m.DB.DeleteTaxRule(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	month := r.Form.Get("month")
-	year := r.Form.Get("year")
+	m.audit(r, models.AuditEntry{Action: audit.ActionDelete, Entity: audit.EntityTaxRule, EntityID: id,
+		Before: audit.TaxRule(rule)})
 
-	m.App.Session.Put(r.Context(), "flash", "changes saved")
+	m.App.Session.Put(r.Context(), "flash", "Tax rule deleted")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
 
-	// Если изменение было произведенно со страницы бронирований то после отправки формы будем перенаправленны на страницу бронирования
-	// Если изменения были прозведенны со страницы календаря то мы будем после отправки формы также редирекнуты на календарь (т.к при календаре отправляется)
-	// два скрытых поля y, m
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+// AdminPromoCodes показывает список промокодов с количеством использований
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := m.DB.AllPromoCodes(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-}
+	data := make(map[string]interface{})
+	data["codes"] = codes
 
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
 
-	// Получение текущего времени
-	now := time.Now()
+// AdminPromoCode показывает форму нового ({id} = new) или существующего промокода
+func (m *Repository) AdminPromoCode(w http.ResponseWriter, r *http.Request) {
+	code := models.PromoCode{Calculation: pricing.CalcPercent, Active: true}
 
-	// Получение кверипараметра если такой будет передан
-	if r.URL.Query().Get("y") != "" {
-		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
-		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+		code, err = m.DB.GetPromoCodeByID(r.Context(), id)
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
+	}
 
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	m.renderPromoCode(w, r, code, forms.New(nil))
+}
+
+func (m *Repository) renderPromoCode(w http.ResponseWriter, r *http.Request, code models.PromoCode, form *forms.Form) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
 	data := make(map[string]interface{})
-	data["now"] = now
+	data["code"] = code
+	data["rooms"] = rooms
 
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
+	render.Template(w, r, "admin-promo-code.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
 
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
+// AdminPostPromoCode создает или обновляет промокод
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
+	var code models.PromoCode
 
-	stringMap := make(map[string]string)
-	stringMap["next_month"] = nextMonth
-	stringMap["next_month_year"] = nextMonthYear
-	stringMap["last_month"] = lastMonth
-	stringMap["last_month_year"] = lastMonthYear
+	if chi.URLParam(r, "id") != "new" {
+		code.ID, err = strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
 
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_month_year"] = now.Format("2006")
+	form := forms.New(r.PostForm)
+	form.Required("code", "amount")
+	form.IsInt("room_id", "max_uses")
+	form.IsDate("valid_from", "valid_to", "stay_from", "stay_to")
+
+	code.Code = promo.Normalize(r.Form.Get("code"))
+	code.Description = r.Form.Get("description")
+	code.Calculation = pricing.CalcFixed
+	code.OncePerGuest = r.Form.Get("once_per_guest") != ""
+	code.Active = r.Form.Get("active") != ""
+
+	if r.Form.Get("calculation") == pricing.CalcPercent {
+		code.Calculation = pricing.CalcPercent
+	}
 
-	// Получение первого и последнего месяца в году
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
+	if r.Form.Get("amount") != "" {
+		code.Amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+		if err != nil {
+			form.Errors.Add("amount", "This field must be a number with at most two decimal places.")
+		} else if code.Calculation == pricing.CalcPercent && code.Amount > 10000 {
+			form.Errors.Add("amount", "Percentage discount cannot be more than 100.")
+		}
+	}
 
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	// код должен быть уникальным
+	if code.Code != "" {
+		existing, err := m.DB.GetPromoCodeByCode(r.Context(), code.Code)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, r, err)
+			return
+		}
 
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+		if err == nil && existing.ID != code.ID {
+			form.Errors.Add("code", "This code already exists.")
+		}
+	}
 
-	rooms, err := m.DB.AllRooms()
+	// ошибки уже проверены формой, пустые значения остаются нулями
+	code.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	code.MaxUses, _ = strconv.Atoi(r.Form.Get("max_uses"))
+	code.ValidFrom, _ = time.Parse("2006-01-02", r.Form.Get("valid_from"))
+	code.ValidTo, _ = time.Parse("2006-01-02", r.Form.Get("valid_to"))
+	code.StayFrom, _ = time.Parse("2006-01-02", r.Form.Get("stay_from"))
+	code.StayTo, _ = time.Parse("2006-01-02", r.Form.Get("stay_to"))
 
-	if err != nil {
-		helpers.ServerError(w, err)
+	if !form.Valid() {
+		m.renderPromoCode(w, r, code, form)
 		return
 	}
 
-	data["rooms"] = rooms
-
-	for _, x := range rooms {
-
-		//
-		//
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
-
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-02")] = 0
-			blockMap[d.Format("2006-01-02")] = 0
-		}
-
-		// Возвращаем массив всех ограничений по данной комнате с первого по последний день текущего месяца
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
-
+	if code.ID == 0 {
+		code.ID, err = m.DB.InsertPromoCode(r.Context(), code)
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
-		for _, y := range restrictions {
-			// Если у даты есть резервейшонID то есть на данные даты комната кем-то заброненна добавляем его в reservationMap.
-			if y.ReservationID > 0 {
-				// на каждую бронь например с 15-19 бронь к каждым суткам добавляется reservationID одна из записей мапы ниже
-				// reservationMap[y.StartDate.Format("2006-01-02")] = y.ReservationID
-				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-02")] = y.ReservationID
-				}
-			} else {
-				// Если у даты есть блокировка но reservationID 0 значит на данные числа номер закрыт админом, добавляем его в blockMap
-				blockMap[y.StartDate.Format("2006-01-02")] = y.ID
-			}
+		m.audit(r, models.AuditEntry{Action: audit.ActionCreate, Entity: audit.EntityPromoCode, EntityID: code.ID,
+			After: audit.PromoCode(code)})
+	} else {
+		before, err := m.DB.GetPromoCodeByID(r.Context(), code.ID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
 		}
 
-		//
-		for key, value := range reservationMap {
-			if value != 0 {
-				fmt.Println(key, value)
-			}
+		err = m.DB.UpdatePromoCode(r.Context(), code)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
 		}
 
-		// Добавляем эти две мапы с текущим айди комнаты в нашу мапу data
-		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
-
-		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+		m.audit(r, models.AuditEntry{Action: audit.ActionUpdate, Entity: audit.EntityPromoCode, EntityID: code.ID,
+			Before: audit.PromoCode(before), After: audit.PromoCode(code)})
 	}
 
-	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		IntMap:    intMap,
-	})
+	m.App.Session.Put(r.Context(), "flash", "Promo code saved")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
 }
 
-func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// AdminDeletePromoCode удаляет промокод, у сделанных с ним бронирований остается сохраненная скидка
+func (m *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
+	code, err := m.DB.GetPromoCodeByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	/*log.Println("=== Форма данных (r.PostForm) ===")
-	for key, values := range r.PostForm {
-		log.Printf("%s: %v\n", key, values)
+	err = m.DB.DeletePromoCode(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
-	log.Println("================================")*/
 
-	year, _ := strconv.Atoi(r.Form.Get("y"))
-	month, _ := strconv.Atoi(r.Form.Get("m"))
+	m.audit(r, models.AuditEntry{Action: audit.ActionDelete, Entity: audit.EntityPromoCode, EntityID: id,
+		Before: audit.PromoCode(code)})
 
-	rooms, err := m.DB.AllRooms()
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
 
+// AdminPromoCodeUsage показывает отчет об использовании промокода: бронирования и суммы скидок
+func (m *Repository) AdminPromoCodeUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	form := forms.New(r.PostForm)
-
-	for _, x := range rooms {
-		// Получение заблокированных дат (тех дат у которых нет reservation_id).
-		// Проходимся по нашей мапе и если в нашей форме нету value то есть мы сняли его с заблокированных дат
-		// Если наш id в room_restrictions > 0, то мы должны удалить их c нашей базы
-		// Достаем мапу формата ['2025-03-03' : room_restriction_id] из сессии и преобразуем в нужный для нас формат
-		curMap := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
-
-		// name - дата , value - restrictionID
-		for name, value := range curMap {
-			if val, ok := curMap[name]; ok {
-				// следим только за теми элементами где val > 0, и их нету в форме которая к нам пришла
-				if val > 0 {
-					// Если в форме нету name равного римувблок с айди и неймом то удаляем его с бд
-					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
-						// удаляем room_restriction по его айди
-						err := m.DB.DeleteBlockById(value)
-
-						if err != nil {
-							log.Println(err)
-						}
-					}
-				}
-			}
-		}
+	code, err := m.DB.GetPromoCodeByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	// обработка новых блокировок, если name начинается с add_block_ то в базу вносятся новые блокировки
-	for name, _ := range r.PostForm {
-		if strings.HasPrefix(name, "add_block_") {
-			exploded := strings.Split(name, "_")
-			roomID, _ := strconv.Atoi(exploded[2])
-			t, _ := time.Parse("2006-01-2", exploded[3])
-			// вставляем блокировку по roomID и дате блокировки
-			err := m.DB.InsertBlockForRoom(roomID, t)
-
-			if err != nil {
-				log.Println(err)
-			}
-		}
+	uses, err := m.DB.GetPromoCodeUses(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	total := 0
+	for _, u := range uses {
+		total += u.Discount
+	}
 
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
-}
+	data := make(map[string]interface{})
+	data["code"] = code
+	data["uses"] = uses
 
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+	intMap := make(map[string]int)
+	intMap["total_discount"] = total
 
-	err := m.DB.UpdateProcessedForReservation(id, 1)
+	render.Template(w, r, "admin-promo-code-usage.page.tmpl", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
 
+// AdminRefundPayment возвращает гостю не возвращенную часть платежа
+func (m *Repository) AdminRefundPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		log.Println(err)
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
-
-	m.App.Session.Put(r.Context(), "flash", "reservation mark as processed")
+	src := chi.URLParam(r, "src")
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	payment, err := m.DB.GetPaymentByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-}
-
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+	redirectURL := fmt.Sprintf("/admin/reservations/%s/%d/show", src, payment.ReservationID)
 
-	_ = m.DB.DeleteReservation(id)
+	// вернуть можно только списанный платеж, от которого еще что-то осталось
+	if payment.Status != payments.StatusCaptured || payment.Amount-payment.RefundedAmount <= 0 {
+		m.App.Session.Put(r.Context(), "error", "This payment has nothing left to refund")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	result, err := m.App.Payments.Refund(r.Context(), payment.ProviderRef, payment.Amount-payment.RefundedAmount)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("cannot refund payment: %s", err))
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	before := audit.Payment(payment)
+	payment.Status = result.Status
+	payment.RefundedAmount += result.Amount
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	err = m.DB.UpdatePayment(r.Context(), payment)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	m.audit(r, models.AuditEntry{Action: audit.ActionRefund, Entity: audit.EntityPayment, EntityID: payment.ID,
+		Before: before, After: audit.Payment(payment)})
 
+	m.App.Session.Put(r.Context(), "flash", "Payment refunded")
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
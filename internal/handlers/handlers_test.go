@@ -6,15 +6,32 @@ import (
 	"fmt"
 	"github.com/go-chi/chi"
 	_ "github.com/justinas/nosurf"
+	"github.com/krasnov23/guest-house-golang/internal/access"
+	"github.com/krasnov23/guest-house-golang/internal/blocks"
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
+	"github.com/krasnov23/guest-house-golang/internal/pricing"
+	"github.com/krasnov23/guest-house-golang/internal/repository/dbrepo"
+	"github.com/krasnov23/guest-house-golang/internal/timeline"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
+// testDate - дата через days дней после фикстуры тестового репозитория, в формате полей формы
+func testDate(from time.Time, days int) string {
+	return from.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+// testBookedMonth - год и месяц с бронированиями тестового репозитория в параметрах календаря
+var testBookedMonth = fmt.Sprintf("y=%d&m=%02d", dbrepo.TestBookedDate.Year(), dbrepo.TestBookedDate.Month())
+
 type postData struct {
 	key   string
 	value string
@@ -29,6 +46,7 @@ var theTests = []struct {
 }{
 	{"home", "/", "GET", []postData{}, http.StatusOK},
 	{"about", "/about", "GET", []postData{}, http.StatusOK},
+	{"metrics", "/metrics", "GET", []postData{}, http.StatusOK},
 	{"gq", "/generals-quarters", "GET", []postData{}, http.StatusOK},
 	{"ms", "/majors-suite", "GET", []postData{}, http.StatusOK},
 	{"sa", "/search-availability", "GET", []postData{}, http.StatusOK},
@@ -39,6 +57,26 @@ var theTests = []struct {
 	{"new res", "/admin/reservations-new", "GET", []postData{}, http.StatusOK},
 	{"new res", "/admin/reservations-all", "GET", []postData{}, http.StatusOK},
 	{"show res", "/admin/reservations/new/1/show", "GET", []postData{}, http.StatusOK},
+	{"stay rules", "/admin/stay-rules", "GET", []postData{}, http.StatusOK},
+	{"taxes", "/admin/taxes", "GET", []postData{}, http.StatusOK},
+	{"promo codes", "/admin/promo-codes", "GET", []postData{}, http.StatusOK},
+	{"new promo code", "/admin/promo-codes/new", "GET", []postData{}, http.StatusOK},
+	{"edit promo code", "/admin/promo-codes/1", "GET", []postData{}, http.StatusOK},
+	{"promo code usage", "/admin/promo-codes/2/usage", "GET", []postData{}, http.StatusOK},
+	{"reports", "/admin/reports", "GET", []postData{}, http.StatusOK},
+	{"admin new reservation", "/admin/reservations/new", "GET", []postData{}, http.StatusOK},
+	{"reservations calendar", "/admin/reservations-calendar?" + testBookedMonth, "GET", []postData{}, http.StatusOK},
+	{"audit log", "/admin/audit-log?entity=reservation&entity_id=1&page=2", "GET", []postData{}, http.StatusOK},
+	{"front desk", "/admin/front-desk", "GET", []postData{}, http.StatusOK},
+	{"front desk date", "/admin/front-desk?date=2050-01-01", "GET", []postData{}, http.StatusOK},
+	{"housekeeping", "/admin/housekeeping?date=2050-01-10", "GET", []postData{}, http.StatusOK},
+	{"maintenance", "/admin/maintenance?show=all", "GET", []postData{}, http.StatusOK},
+	{"maintenance ticket", "/admin/maintenance/1", "GET", []postData{}, http.StatusOK},
+	{"new maintenance ticket", "/admin/maintenance/new?room_id=1&date=" + testDate(dbrepo.TestBookedDate, 4), "GET", []postData{}, http.StatusOK},
+	{"timeline", "/admin/reservations-timeline?view=week&start=" + testDate(dbrepo.TestBookedDate, 0), "GET", []postData{}, http.StatusOK},
+	{"timeline bad range", "/admin/reservations-timeline?view=custom&start=" + testDate(dbrepo.TestBookedDate, 9) + "&end=" + testDate(dbrepo.TestBookedDate, 0), "GET", []postData{}, http.StatusOK},
+	{"timeline data bad range", "/admin/reservations-timeline/data?view=custom&start=" + testDate(dbrepo.TestBookedDate, 9) + "&end=" + testDate(dbrepo.TestBookedDate, 0), "GET", []postData{}, http.StatusBadRequest},
+	{"report revenue", "/admin/reports?report=revenue&start=2050-01-01&end=2050-01-31", "GET", []postData{}, http.StatusOK},
 
 	//{"post-sa", "/search-availability", "POST", []postData{
 	//	{key: "start", value: "2020-01-01"},
@@ -152,6 +190,39 @@ func TestRepository_Reservation(t *testing.T) {
 
 }
 
+func TestRepository_Reservation_Quote(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	session.Put(ctx, "reservation", reservation)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	// 2 ночи по 120.00 + НДС 10% + уборка 20.00
+	for _, s := range []string{"240.00", "VAT", "24.00", "Cleaning fee", "284.00"} {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("expected %s in quote", s)
+		}
+	}
+}
+
 func TestRepository_Reservation_WithoutReservation(t *testing.T) {
 	// тест кейс где reservation не в сессии
 	req, _ := http.NewRequest("GET", "/make-reservation", nil)
@@ -219,7 +290,7 @@ func TestRepository_PostReservation(t *testing.T) {
 
 	reqBody := "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=1")
+		reqBody, "end_date=2050-01-02", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=1")
 
 	//postData := url.Values{}
 	//postData.Add("start_date", reqBody)
@@ -236,6 +307,8 @@ func TestRepository_PostReservation(t *testing.T) {
 
 	req = req.WithContext(ctx)
 
+	created := app.Metrics.ReservationsCreated.Value("website")
+
 	// Если заголовок не установлен:
 	// Go не сможет автоматически распарсить тело запроса
 	// Форма останется пустой (req.Form/req.PostForm)
@@ -252,6 +325,14 @@ func TestRepository_PostReservation(t *testing.T) {
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("got status code %d, want %d", rr.Code, http.StatusSeeOther)
 	}
+
+	// после создания бронирования гость переходит к оплате
+	if location, _ := rr.Result().Location(); location.String() != "/make-payment" {
+		t.Errorf("expected redirect to /make-payment, got %s", location.String())
+	}
+	if app.Metrics.ReservationsCreated.Value("website") != created+1 {
+		t.Error("reservations_created_total was not incremented")
+	}
 }
 
 func TestRepository_PostReservation_WithCantParseData(t *testing.T) {
@@ -287,7 +368,7 @@ func TestRepository_PostReservation_WithCantParseStartDate(t *testing.T) {
 
 	reqBody := "start_date=sssss"
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=1")
+		reqBody, "end_date=2050-01-02", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=1")
 
 	// Можем также сделать следующим образом
 	postedData := url.Values{}
@@ -362,7 +443,7 @@ func TestRepository_PostReservation_WithCantParseIncorrectRoomId(t *testing.T) {
 
 	reqBody := "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=dddd")
+		reqBody, "end_date=2050-01-02", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=dddd")
 
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -395,7 +476,7 @@ func TestRepository_PostReservation_WithCantParseIncorrectRoomId(t *testing.T) {
 func TestRepository_PostReservation_WithCantParseInvalidFormRequirements(t *testing.T) {
 	reqBody := "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "phone=123456789", "room_id=1")
+		reqBody, "end_date=2050-01-02", "first_name=John", "last_name=Doe", "phone=123456789", "room_id=1")
 
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -415,8 +496,9 @@ func TestRepository_PostReservation_WithCantParseInvalidFormRequirements(t *test
 
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler returned wrong response code for missing post body %d, want %d", rr.Code, http.StatusSeeOther)
+	// при невалидной форме страница бронирования отображается повторно с ошибками
+	if rr.Code != http.StatusOK {
+		t.Errorf("PostReservation handler returned wrong response code for missing post body %d, want %d", rr.Code, http.StatusOK)
 	}
 
 }
@@ -424,7 +506,7 @@ func TestRepository_PostReservation_WithCantParseInvalidFormRequirements(t *test
 func TestRepository_PostReservation_WithCantParseInvalidInsertReservation(t *testing.T) {
 	reqBody := "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=2")
+		reqBody, "end_date=2050-01-02", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=2")
 
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -453,10 +535,11 @@ func TestRepository_PostReservation_WithCantParseInvalidInsertReservation(t *tes
 	}
 }
 
-func TestRepository_PostReservation_WithCantParseInvalidInsertRoomRestriction(t *testing.T) {
-	reqBody := "start_date=2050-01-01"
+func TestRepository_PostReservation_RoomNoLongerAvailable(t *testing.T) {
+	// в тестовом репозитории комната 1 с TestBookedDate уже занята к моменту сохранения
+	reqBody := "start_date=" + testDate(dbrepo.TestBookedDate, 0)
 	reqBody = fmt.Sprintf("%s&%s&%s&%s&%s&%s&%s",
-		reqBody, "end_date=2050-01-01", "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=3")
+		reqBody, "end_date="+testDate(dbrepo.TestBookedDate, 1), "first_name=John", "last_name=Doe", "email=jd@jd.com", "phone=123456789", "room_id=1")
 
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -476,53 +559,140 @@ func TestRepository_PostReservation_WithCantParseInvalidInsertRoomRestriction(t
 
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler returned wrong response code for missing post body %d, want %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostReservation handler returned wrong response code %d, want %d", rr.Code, http.StatusSeeOther)
+	}
+
+	if rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("unexpected redirect to %s", rr.Header().Get("Location"))
 	}
 
-	if session.Get(ctx, "error") != "cant insert room restrictions to DB" {
-		t.Errorf("another error not `cant insert room restrictions to DB`")
+	if session.Get(ctx, "error") != "Sorry, this room is no longer available for the selected dates" {
+		t.Errorf("unexpected error %v", session.Get(ctx, "error"))
 	}
 }
 
-func TestRepository_AvailabilityJSON_RoomIsNotAvailable(t *testing.T) {
+var stayRulesTests = []struct {
+	name         string
+	startDate    string
+	endDate      string
+	expectedHTML string
+}{
+	{"zero-nights", "2050-01-01", "2050-01-01", "Departure date must be after arrival date."},
+	{"end-before-start", "2050-01-05", "2050-01-01", "Departure date must be after arrival date."},
+	{"in-the-past", "2000-01-01", "2000-01-03", "Arrival date cannot be in the past."},
+	{"seasonal-min-nights", testDate(dbrepo.TestMinStayDate, 0), testDate(dbrepo.TestMinStayDate, 1), fmt.Sprintf("Minimum stay is %d nights.", dbrepo.TestMinNights)},
+}
 
-	reqBody := "start_date=2050-01-01"
-	reqBody = fmt.Sprintf("%s&%s&%s", reqBody, "end_date=2050-01-01", "room_id=1")
+func TestRepository_PostReservation_StayRules(t *testing.T) {
+	for _, e := range stayRulesTests {
+		postedData := url.Values{}
+		postedData.Add("start_date", e.startDate)
+		postedData.Add("end_date", e.endDate)
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Doe")
+		postedData.Add("email", "jd@jd.com")
+		postedData.Add("room_id", "1")
 
-	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 
-	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 
-	if err != nil {
-		log.Println(err)
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		// бронирование не создается, форма показывается повторно с ошибкой по датам
+		if rr.Code != http.StatusOK {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, http.StatusOK)
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
 	}
+}
 
-	req = req.WithContext(ctx)
+var promoCodeTests = []struct {
+	name               string
+	code               string
+	email              string
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{"valid", " save10 ", "jd@jd.com", http.StatusSeeOther, ""},
+	{"unknown", "BOGUS", "jd@jd.com", http.StatusOK, "This promo code does not exist."},
+	{"limit", "USED", "jd@jd.com", http.StatusOK, "This promo code has already been fully redeemed."},
+	{"room", "ROOM2", "jd@jd.com", http.StatusOK, "This promo code is not valid for the selected room."},
+	{"once-per-guest", "SAVE10", "used@guest.com", http.StatusOK, "You have already used this promo code."},
+	{"last-use-taken", "LAST", "jd@jd.com", http.StatusOK, "This promo code has already been fully redeemed."},
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+func TestRepository_PostReservation_PromoCode(t *testing.T) {
+	for _, e := range promoCodeTests {
+		postedData := url.Values{}
+		postedData.Add("start_date", "2050-01-01")
+		postedData.Add("end_date", "2050-01-02")
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Doe")
+		postedData.Add("email", e.email)
+		postedData.Add("room_id", "1")
+		postedData.Add("promo_code", e.code)
 
-	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 
-	rr := httptest.NewRecorder()
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 
-	handler.ServeHTTP(rr, req)
+		if err != nil {
+			log.Println(err)
+		}
 
-	var j jsonResponse
+		req = req.WithContext(ctx)
 
-	// Ответ (rr.Body.String()) парсится в структуру jsonResponse.
-	// Если парсинг не удаётся, тест падает с ошибкой failed parse json.
-	err = json.Unmarshal([]byte(rr.Body.String()), &j)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	if err != nil {
-		t.Error("failed parse json")
-	}
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
 
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
+
+		// скидка сохраняется в бронировании строкой расчета
+		if e.expectedStatusCode == http.StatusSeeOther {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+
+			if res.PromoCodeID != 1 || pricing.Summarize(res.Charges).Discounts != -1200 {
+				t.Errorf("failed %s: promo code is not applied: %+v", e.name, res.Charges)
+			}
+		}
+	}
 }
 
-func TestRepository_ChooseRoom_MissingURLParameter(t *testing.T) {
-	// Создаем запрос с пустым ID
-	req, _ := http.NewRequest("GET", "/choose-room/", nil)
+func TestRepository_AvailabilityJSON_StayRules(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", testDate(dbrepo.TestMinStayDate, 0))
+	postedData.Add("end", testDate(dbrepo.TestMinStayDate, 1))
+	postedData.Add("room_id", "1")
+
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(postedData.Encode()))
 
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 
@@ -532,28 +702,36 @@ func TestRepository_ChooseRoom_MissingURLParameter(t *testing.T) {
 
 	req = req.WithContext(ctx)
 
-	// Устанавливаем ResponseRecorder
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
 	rr := httptest.NewRecorder()
 
-	// Вызываем обработчик
-	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+
 	handler.ServeHTTP(rr, req)
 
-	// Проверяем редирект
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	var j jsonResponse
+
+	err = json.Unmarshal([]byte(rr.Body.String()), &j)
+	if err != nil {
+		t.Fatal("failed parse json")
 	}
 
-	// Проверяем сообщение об ошибке в сессии
-	flash := Repo.App.Session.PopString(req.Context(), "error")
-	if flash != "missing url parameter" {
-		t.Errorf("Expected flash 'missing url parameter', got '%s'", flash)
+	if j.OK {
+		t.Error("room should not be available because of the minimum stay rule")
+	}
+
+	if j.Message != fmt.Sprintf("Minimum stay is %d nights.", dbrepo.TestMinNights) {
+		t.Errorf("unexpected message %q", j.Message)
 	}
 }
 
-func TestRepository_ChooseRoom_NoReservationInSession(t *testing.T) {
-	// Создаем запрос с корректным ID
-	req, _ := http.NewRequest("GET", "/choose-room/1", nil)
+func TestRepository_PostAvailability_InvalidDates(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", "2050-01-05")
+	postedData.Add("end", "2050-01-01")
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
 
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 
@@ -563,34 +741,29 @@ func TestRepository_ChooseRoom_NoReservationInSession(t *testing.T) {
 
 	req = req.WithContext(ctx)
 
-	ctx = addIdToChiContext(ctx, "1")
-	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	rr := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler := http.HandlerFunc(Repo.PostAvailability)
+
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("got status code %d, want %d", rr.Code, http.StatusSeeOther)
 	}
 
-	flash := Repo.App.Session.PopString(req.Context(), "error")
-
-	if flash != "problem getting reservation from session" {
-		t.Errorf("Expected flash 'problem getting reservation from session', got '%s'", flash)
+	if session.Get(ctx, "error") != "Departure date must be after arrival date." {
+		t.Errorf("unexpected error %v", session.Get(ctx, "error"))
 	}
 }
 
-func TestRepository_ChooseRoom_Success(t *testing.T) {
-	// Создаем тестовую резервацию
-	reservation := models.Reservation{
-		RoomID: 0,
-		// другие поля...
-	}
+func TestRepository_PostAvailability_Suggestions(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", testDate(dbrepo.TestBookedDate, 1))
+	postedData.Add("end", testDate(dbrepo.TestBookedDate, 3))
 
-	// Создаем запрос с ID комнаты
-	req, _ := http.NewRequest("GET", "/choose-room/1", nil)
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
 
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 
@@ -600,130 +773,1416 @@ func TestRepository_ChooseRoom_Success(t *testing.T) {
 
 	req = req.WithContext(ctx)
 
-	ctx = addIdToChiContext(ctx, "1")
-	req = req.WithContext(ctx)
-
-	// Кладем резервацию в сессию
-	Repo.App.Session.Put(ctx, "reservation", reservation)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	rr := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler := http.HandlerFunc(Repo.PostAvailability)
+
 	handler.ServeHTTP(rr, req)
 
-	// Проверяем редирект
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("Expected status %d, got %d", http.StatusSeeOther, rr.Code)
+	// тестовый репозиторий не находит свободных комнат, поэтому показывается страница с альтернативами
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status code %d, want %d", rr.Code, http.StatusOK)
 	}
 
-	// Проверяем, что резервация обновилась
-	updatedRes, ok := Repo.App.Session.Get(ctx, "reservation").(models.Reservation)
-	if !ok {
-		t.Error("Failed to get reservation from session")
+	html := rr.Body.String()
+
+	expected := []string{
+		// ближайшие свободные даты для комнаты 1 раньше и позже запрошенных
+		"/book-room?id=1&s=" + testDate(dbrepo.TestBookedDate, -2) + "&e=" + testDate(dbrepo.TestBookedDate, 0),
+		"/book-room?id=1&s=" + testDate(dbrepo.TestBookedDate, 2) + "&e=" + testDate(dbrepo.TestBookedDate, 4),
+		// проживание с переездом из комнаты 2 в комнату 1
+		"/book-room?id=2&s=" + testDate(dbrepo.TestBookedDate, 1) + "&e=" + testDate(dbrepo.TestBookedDate, 2),
+		"/book-room?id=1&s=" + testDate(dbrepo.TestBookedDate, 2) + "&e=" + testDate(dbrepo.TestBookedDate, 3),
 	}
 
-	if updatedRes.RoomID != 1 {
-		t.Errorf("Expected room ID 1, got %d", updatedRes.RoomID)
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Errorf("expected link %s in suggestions", e)
+		}
 	}
-}
 
-var loginTests = []struct {
-	name               string
-	email              string
-	expectedStatusCode int
-	expectedHTML       string
-	expectedLocation   string
-}{
-	{"valid-credentials",
-		"me@here.ca",
-		http.StatusSeeOther,
-		"",
-		"/",
-	},
-	{
-		"invalid-credentials",
-		"jack@nimble.com",
-		http.StatusSeeOther,
-		"",
-		"/user/login",
-	},
-	{
-		"invalid-data",
-		"j",
-		http.StatusOK,
-		`action="/user/login"`,
-		"",
-	},
+	if !strings.Contains(html, `action="/waitlist"`) {
+		t.Error("expected waitlist form in suggestions")
+	}
 }
 
-func TestLogin(t *testing.T) {
-	for _, e := range loginTests {
+func TestRepository_PostWaitlist(t *testing.T) {
+	var tests = []struct {
+		name     string
+		email    string
+		start    string
+		end      string
+		wantCode int
+		wantLoc  string
+	}{
+		{"valid", "jane@guest.com", testDate(dbrepo.TestBookedDate, 1), testDate(dbrepo.TestBookedDate, 3), http.StatusSeeOther, "/"},
+		{"invalid-email", "jane", testDate(dbrepo.TestBookedDate, 1), testDate(dbrepo.TestBookedDate, 3), http.StatusOK, ""},
+		{"end-before-start", "jane@guest.com", testDate(dbrepo.TestBookedDate, 3), testDate(dbrepo.TestBookedDate, 1), http.StatusOK, ""},
+		{"invalid-dates", "jane@guest.com", "invalid", testDate(dbrepo.TestBookedDate, 3), http.StatusSeeOther, "/search-availability"},
+		{"insert-error", "fail@guest.com", testDate(dbrepo.TestBookedDate, 1), testDate(dbrepo.TestBookedDate, 3), http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
 		postedData := url.Values{}
+		postedData.Add("name", "Jane")
 		postedData.Add("email", e.email)
-		postedData.Add("password", "password")
+		postedData.Add("start_date", e.start)
+		postedData.Add("end_date", e.end)
+		postedData.Add("room_id", "1")
 
-		// Метод .Encode() преобразует эту структуру в строку, закодированную по стандарту application/x-www-form-urlencoded
-		// strings.NewReader — это функция из пакета strings.
-		// Она принимает строку и возвращает объект типа *strings.Reader, который реализует интерфейс io.Reader.
-		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(postedData.Encode()))
 
 		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
-
 		if err != nil {
 			log.Println(err)
 		}
 
 		req = req.WithContext(ctx)
-
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 		rr := httptest.NewRecorder()
 
-		handler := http.HandlerFunc(Repo.PostShowLogin)
+		handler := http.HandlerFunc(Repo.PostWaitlist)
 
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != e.expectedStatusCode {
-			t.Errorf("Expected status %d, got %d", e.expectedStatusCode, rr.Code)
+		if rr.Code != e.wantCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.wantCode)
 		}
 
-		if e.expectedLocation != "" {
-			actualLocation, _ := rr.Result().Location()
-
-			if actualLocation.String() != e.expectedLocation {
-				t.Errorf("failed %s: Expected location %s, got %s", e.name, e.expectedLocation, actualLocation.String())
+		if e.wantLoc != "" {
+			if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.wantLoc {
+				t.Errorf("failed %s: unexpected redirect %v", e.name, loc)
 			}
 		}
+	}
+}
 
-		if e.expectedHTML != "" {
+func TestRepository_NotifyWaitlist(t *testing.T) {
+	date := func(m time.Month, d int) time.Time {
+		return dbrepo.TestFreeDate.AddDate(0, int(m)-1, d-1)
+	}
 
-			// Прочитаем тело ответа
-			html := rr.Body.String()
-			// Это подстрока, которую тест ищет в HTML, чтобы убедиться, что сервер вернул страницу с формой логина.
-			// в e.expectedHTML можем прокинуть любую инфу которая содержится в html странице в нашем случае (login.page.tmpl)
-			if !strings.Contains(html, e.expectedHTML) {
-				t.Errorf("failed %s: Expected HTML %s, got %s", e.name, e.expectedHTML, html)
-			}
+	var tests = []struct {
+		name   string
+		roomID int
+		start  time.Time
+		end    time.Time
+		want   int
+	}{
+		// заявка на комнату 1 и заявка на любую комнату
+		{"room-1", 1, date(1, 1), date(1, 5), 2},
+		// заявка на комнату 1 не подходит, на любую - подходит
+		{"room-2", 2, date(1, 3), date(1, 4), 1},
+		{"no-overlap", 1, date(2, 1), date(2, 5), 0},
+	}
+
+	for _, e := range tests {
+		sent, err := Repo.notifyWaitlist(context.Background(), e.roomID, e.start, e.end)
+		if err != nil {
+			t.Errorf("failed %s: %v", e.name, err)
 		}
 
+		if sent != e.want {
+			t.Errorf("failed %s: got %d emails, want %d", e.name, sent, e.want)
+		}
+	}
+
+	// в 2050 году комнаты в тестовом репозитории заняты, письма не отправляются
+	sent, _ := Repo.notifyWaitlist(context.Background(), 1, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC))
+	if sent != 0 {
+		t.Errorf("got %d emails for busy dates, want 0", sent)
 	}
 }
 
-func addIdToChiContext(parentCtx context.Context, id string) context.Context {
+func TestRepository_AvailabilityCalendar(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/availability-calendar?room_id=1&start="+testDate(dbrepo.TestBookedDate, 0)+"&end="+testDate(dbrepo.TestBookedDate, 4), nil)
 
-	// Создаёт пустой RouteContext — специальный объект Chi для хранения параметров маршрута (например, id из /users/{id}).
-	chiCtx := chi.NewRouteContext()
+	rr := httptest.NewRecorder()
 
-	// Вручную добавляет параметр id в контекст маршрута.
-	//Теперь chi.URLParam(r, "id") в обработчике сможет получить это значение.
-	chiCtx.URLParams.Add("id", id)
-	//fmt.Println(chi.RouteCtxKey)
+	handler := http.HandlerFunc(Repo.AvailabilityCalendar)
 
-	// chi.RouteCtxKey - это ключ, по которому Chi ищет свой контекст
-	// Зачем передавать chi.RouteCtxKey
-	// Chi ищет свой контекст по этому ключу.
-	// Когда вы вызываете chi.URLParam(r, "id"), фреймворк делает примерно следующее:
-	// func URLParam(r *http.Request, key string) string {
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status code %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var j calendarResponse
+
+	err := json.Unmarshal([]byte(rr.Body.String()), &j)
+	if err != nil {
+		t.Fatal("failed parse json")
+	}
+
+	if len(j.Days) != 4 {
+		t.Fatalf("got %d days, want 4", len(j.Days))
+	}
+
+	// в тестовом репозитории комната 1 занята первые две ночи с TestBookedDate
+	expected := []bool{false, false, true, true}
+	for i, day := range j.Days {
+		if day.Available != expected[i] {
+			t.Errorf("day %s: got available %v, want %v", day.Date, day.Available, expected[i])
+		}
+	}
+
+	if j.Days[0].Price == nil || *j.Days[0].Price != 120 {
+		t.Error("expected price 120 for room 1")
+	}
+}
+
+var calendarErrorTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"missing room", "/availability-calendar", http.StatusBadRequest},
+	{"invalid month", "/availability-calendar?room_id=1&month=2070-13", http.StatusBadRequest},
+	{"end before start", "/availability-calendar?room_id=1&start=" + testDate(dbrepo.TestBookedDate, 4) + "&end=" + testDate(dbrepo.TestBookedDate, 0), http.StatusBadRequest},
+	{"range too long", "/availability-calendar?room_id=1&start=" + testDate(dbrepo.TestBookedDate, 0) + "&end=" + testDate(dbrepo.TestBookedDate, 730), http.StatusBadRequest},
+	{"unknown room", "/availability-calendar?room_id=3&month=" + dbrepo.TestBookedDate.Format("2006-01"), http.StatusNotFound},
+}
+
+func TestRepository_AvailabilityCalendar_Errors(t *testing.T) {
+	for _, e := range calendarErrorTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AvailabilityCalendar)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// reservationForPayment - бронирование на 2 ночи в комнате с ценой 120.00 за ночь, платежей по нему еще нет
+var reservationForPayment = models.Reservation{
+	ID:        2,
+	FirstName: "John",
+	RoomID:    1,
+	StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+	Room: models.Room{
+		ID:       1,
+		RoomName: "General's Quarters",
+		Price:    12000,
+	},
+	Charges: []models.ReservationCharge{
+		{Kind: "room", Description: "Accommodation - General's Quarters", Quantity: 2, UnitAmount: 12000, Amount: 24000},
+	},
+}
+
+func TestRepository_Payment(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/make-payment", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	session.Put(ctx, "reservation", reservationForPayment)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Payment)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status code %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	// депозит 30% от 240.00
+	if !strings.Contains(rr.Body.String(), "72.00 USD") {
+		t.Error("expected deposit amount on the payment page")
+	}
+
+	// если платить не за что, страница оплаты пропускается
+	free := reservationForPayment
+	free.Room.Price = 0
+	free.Charges = nil
+	session.Put(ctx, "reservation", free)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if location, _ := rr.Result().Location(); rr.Code != http.StatusSeeOther || location.String() != "/reservation-summary" {
+		t.Errorf("expected redirect to summary, got %d", rr.Code)
+	}
+
+	// бронирование 1 в тестовом репозитории уже оплачено
+	paid := reservationForPayment
+	paid.ID = 1
+	session.Put(ctx, "reservation", paid)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if location, _ := rr.Result().Location(); rr.Code != http.StatusSeeOther || location.String() != "/reservation-summary" {
+		t.Errorf("expected redirect to summary for a paid reservation, got %d", rr.Code)
+	}
+}
+
+var paymentTests = []struct {
+	name               string
+	reservationID      int
+	token              string
+	expectedStatusCode int
+	expectedHTML       string
+	expectedLocation   string
+}{
+	{"approved", 2, payments.FakeTokenApproved, http.StatusSeeOther, "", "/reservation-summary"},
+	{"declined", 2, payments.FakeTokenDeclined, http.StatusOK, "The payment was declined", ""},
+	{"no-token", 2, "", http.StatusOK, "This field cannot be blank", ""},
+	{"capture-failed", 2, payments.FakeTokenCaptureFailed, http.StatusSeeOther, "", "/make-payment"},
+	// повторная отправка формы по уже оплаченному бронированию ничего не списывает
+	{"already-paid", 1, payments.FakeTokenApproved, http.StatusSeeOther, "", "/reservation-summary"},
+}
+
+func TestRepository_PostPayment(t *testing.T) {
+	for _, e := range paymentTests {
+		postedData := url.Values{}
+		postedData.Add("kind", "full")
+		postedData.Add("payment_token", e.token)
+
+		req, _ := http.NewRequest("POST", "/make-payment", strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		res := reservationForPayment
+		res.ID = e.reservationID
+		session.Put(ctx, "reservation", res)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostPayment)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLocation, _ := rr.Result().Location()
+
+			if actualLocation.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, got %s", e.name, e.expectedLocation, actualLocation.String())
+			}
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_PaymentWebhook(t *testing.T) {
+	provider := app.Payments.(*payments.FakeProvider)
+
+	payload, _ := json.Marshal(payments.Event{Type: "payment.refunded", Reference: "fake_1", Status: payments.StatusRefunded, Amount: 3600})
+
+	var webhookTests = []struct {
+		name               string
+		payload            []byte
+		signature          string
+		expectedStatusCode int
+	}{
+		{"valid", payload, provider.Sign(payload), http.StatusOK},
+		{"invalid-signature", payload, "abc", http.StatusBadRequest},
+		{"unknown-payment", []byte(`{"reference":"fake_2"}`), provider.Sign([]byte(`{"reference":"fake_2"}`)), http.StatusNotFound},
+	}
+
+	for _, e := range webhookTests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(string(e.payload)))
+		req.Header.Set("X-Payment-Signature", e.signature)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PaymentWebhook)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDashboard(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDashboard)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status code %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	html := rr.Body.String()
+
+	// тестовый репозиторий: заезд John Smith, выезд Jane Doe, проживает Jack Black,
+	// 10 забронированных ночей против 8 в прошлом году
+	expected := []string{"John Smith", "Jane Doe", "Jack Black", "+25% vs last year"}
+
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Errorf("expected %q on dashboard", e)
+		}
+	}
+}
+
+func TestRepository_AdminReportExport(t *testing.T) {
+	var tests = []struct {
+		name        string
+		url         string
+		wantCode    int
+		contentType string
+		body        string
+	}{
+		{"csv", "/admin/reports/revenue/csv?start=2050-01-01&end=2050-01-31", http.StatusOK,
+			"text/csv; charset=utf-8", "General's Quarters,1,3,360.00,120.00,11.61"},
+		{"xlsx", "/admin/reports/nationality/xlsx?start=2050-01-01&end=2050-01-31", http.StatusOK,
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "PK"},
+		{"unknown-report", "/admin/reports/nope/csv", http.StatusNotFound, "", ""},
+		{"unknown-format", "/admin/reports/revenue/pdf", http.StatusNotFound, "", ""},
+		{"invalid-dates", "/admin/reports/revenue/csv?start=2050-02-01&end=2050-01-01", http.StatusSeeOther, "", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+
+		rr := httptest.NewRecorder()
+
+		// параметры {report} и {format} разбирает роутер, сессию загружает его middleware
+		getRoutes().ServeHTTP(rr, req)
+
+		if rr.Code != e.wantCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.wantCode)
+			continue
+		}
+
+		if e.contentType != "" && rr.Header().Get("Content-Type") != e.contentType {
+			t.Errorf("failed %s: got content type %q", e.name, rr.Header().Get("Content-Type"))
+		}
+
+		if !strings.Contains(rr.Body.String(), e.body) {
+			t.Errorf("failed %s: expected %q in body", e.name, e.body)
+		}
+	}
+}
+
+func TestRepository_AdminCancelReservation(t *testing.T) {
+	var tests = []struct {
+		name     string
+		id       string
+		wantCode int
+	}{
+		{"valid", "1", http.StatusSeeOther},
+		{"cancel-error", "2", http.StatusInternalServerError},
+		{"not-found", "1001", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/cancel-reservation/all/"+e.id+"/do", nil)
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminCancelReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.wantCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.wantCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteReservation(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		wantLocation string
+	}{
+		{"valid", "3", "/admin/reservations-all"},
+		// у бронирования 1 есть платеж: вместо удаления - возврат на страницу бронирования с ошибкой
+		{"has-payments", "1", "/admin/reservations/all/1/show"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-reservation/all/"+e.id+"/do", nil)
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+		if err != nil {
+			log.Println(err)
+		}
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("src", "all")
+		chiCtx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		if location, _ := rr.Result().Location(); rr.Code != http.StatusSeeOther || location.String() != e.wantLocation {
+			t.Errorf("failed %s: got %d %v, want redirect to %s", e.name, rr.Code, location, e.wantLocation)
+		}
+	}
+}
+
+func TestRepository_AdminReservationLists(t *testing.T) {
+	var tests = []struct {
+		name       string
+		url        string
+		expected   []string
+		unexpected []string
+	}{
+		// тестовый репозиторий возвращает 30 бронирований, по 25 на странице
+		{"all-first-page", "/admin/reservations-all", []string{"Guest01", "Guest25", "30 reservations", "page=2"},
+			[]string{"Guest26"}},
+		{"all-second-page", "/admin/reservations-all?page=2", []string{"Guest26", "Guest30"}, []string{"Guest25"}},
+		{"search", "/admin/reservations-all?q=guest1", []string{"Guest10", "Guest19", "10 reservations"},
+			[]string{"Guest20"}},
+		{"desc", "/admin/reservations-all?sort=id&dir=desc", []string{"Guest30"}, []string{"Guest01"}},
+		// в новых только необработанные (нечетные id)
+		{"new", "/admin/reservations-new", []string{"Guest01", "15 reservations"}, []string{"Guest02"}},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+
+		rr := httptest.NewRecorder()
+
+		getRoutes().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("failed %s: got status code %d", e.name, rr.Code)
+			continue
+		}
+
+		html := rr.Body.String()
+
+		for _, s := range e.expected {
+			if !strings.Contains(html, s) {
+				t.Errorf("failed %s: expected %q", e.name, s)
+			}
+		}
+
+		for _, s := range e.unexpected {
+			if strings.Contains(html, s) {
+				t.Errorf("failed %s: unexpected %q", e.name, s)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostTaxRules(t *testing.T) {
+	var taxTests = []struct {
+		name               string
+		amount             string
+		expectedStatusCode int
+	}{
+		{"valid", "2.50", http.StatusSeeOther},
+		{"invalid-amount", "2.505", http.StatusOK},
+		{"missing-amount", "", http.StatusOK},
+	}
+
+	for _, e := range taxTests {
+		postedData := url.Values{}
+		postedData.Add("name", "Tourist tax")
+		postedData.Add("kind", "tax")
+		postedData.Add("calculation", "fixed")
+		postedData.Add("per", "guest_night")
+		postedData.Add("amount", e.amount)
+
+		req, _ := http.NewRequest("POST", "/admin/taxes", strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostTaxRules)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminSettingsAudit(t *testing.T) {
+	// отдельная платежная система, чтобы платеж fake_1 из тестового репозитория был списан и его можно было вернуть
+	provider := payments.NewFakeProvider("test-secret")
+	authorized, _ := provider.Authorize(context.Background(), payments.AuthorizeRequest{Token: payments.FakeTokenApproved, Amount: 3600})
+	provider.Capture(context.Background(), authorized.Reference, 3600)
+
+	saved := app.Payments
+	app.Payments = provider
+	defer func() { app.Payments = saved }()
+
+	var auditTests = []struct {
+		name    string
+		handler http.HandlerFunc
+		params  map[string]string
+		data    url.Values
+		entity  string
+		id      int
+		action  string
+	}{
+		{"refund", Repo.AdminRefundPayment, map[string]string{"src": "all", "id": "1"}, url.Values{}, "payment", 1, "refund"},
+		{"create-stay-rule", Repo.AdminPostStayRules, nil, url.Values{"rule_name": {"Summer"}, "min_nights": {"3"}}, "stay_rule", 2, "create"},
+		{"delete-stay-rule", Repo.AdminDeleteStayRule, map[string]string{"id": "1"}, url.Values{}, "stay_rule", 1, "delete"},
+		{"create-tax-rule", Repo.AdminPostTaxRules, nil, url.Values{"name": {"Tourist tax"}, "amount": {"2.50"}}, "tax_rule", 3, "create"},
+		{"delete-tax-rule", Repo.AdminDeleteTaxRule, map[string]string{"id": "2"}, url.Values{}, "tax_rule", 2, "delete"},
+		{"create-promo-code", Repo.AdminPostPromoCode, map[string]string{"id": "new"}, url.Values{"code": {"spring"}, "amount": {"5"}}, "promo_code", 5, "create"},
+		{"update-promo-code", Repo.AdminPostPromoCode, map[string]string{"id": "3"}, url.Values{"code": {"ROOM2"}, "amount": {"15"}}, "promo_code", 3, "update"},
+		{"delete-promo-code", Repo.AdminDeletePromoCode, map[string]string{"id": "4"}, url.Values{}, "promo_code", 4, "delete"},
+	}
+
+	for _, e := range auditTests {
+		req, _ := http.NewRequest("POST", "/admin", strings.NewReader(e.data.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		session.Put(ctx, "user_id", 1)
+
+		chiCtx := chi.NewRouteContext()
+		for k, v := range e.params {
+			chiCtx.URLParams.Add(k, v)
+		}
+
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		entries, _, _ := Repo.DB.GetAuditEntries(context.Background(), models.AuditFilter{Entity: e.entity, EntityID: e.id, Action: e.action})
+		if len(entries) == 0 {
+			t.Errorf("failed %s: action was not recorded in the audit log", e.name)
+			continue
+		}
+
+		if e.action != "create" && entries[0].Before == "" {
+			t.Errorf("failed %s: state before the change was not recorded", e.name)
+		}
+
+		if e.action != "delete" && entries[0].After == "" {
+			t.Errorf("failed %s: state after the change was not recorded", e.name)
+		}
+	}
+}
+
+func TestRepository_AdminRefundPayment_Refused(t *testing.T) {
+	// 2 - уже возвращен полностью, 3 - не списан
+	for _, id := range []string{"2", "3"} {
+		req, _ := http.NewRequest("POST", "/admin/refund-payment/all/"+id+"/do", nil)
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("src", "all")
+		chiCtx.URLParams.Add("id", id)
+
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminRefundPayment).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed payment %s: got status code %d, want %d", id, rr.Code, http.StatusSeeOther)
+		}
+
+		if msg := session.GetString(ctx, "error"); msg != "This payment has nothing left to refund" {
+			t.Errorf("failed payment %s: got error %q", id, msg)
+		}
+
+		if session.GetString(ctx, "flash") != "" {
+			t.Errorf("failed payment %s: refused refund reported as done", id)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCode(t *testing.T) {
+	var promoTests = []struct {
+		name               string
+		id                 string
+		code               string
+		amount             string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"new", "new", "winter", "15", http.StatusSeeOther, ""},
+		{"update", "1", "SAVE10", "10", http.StatusSeeOther, ""},
+		{"duplicate", "new", "save10", "10", http.StatusOK, "This code already exists."},
+		{"too-much", "new", "HALF", "150", http.StatusOK, "Percentage discount cannot be more than 100."},
+	}
+
+	for _, e := range promoTests {
+		postedData := url.Values{}
+		postedData.Add("code", e.code)
+		postedData.Add("calculation", "percent")
+		postedData.Add("amount", e.amount)
+		postedData.Add("active", "1")
+
+		req, _ := http.NewRequest("POST", "/admin/promo-codes/"+e.id, strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostPromoCode)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostNewReservation(t *testing.T) {
+	var newResTests = []struct {
+		name               string
+		start              string
+		email              string
+		sendEmail          string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"phone", testDate(dbrepo.TestFreeDate, 0), "jd@jd.com", "1", http.StatusSeeOther, ""},
+		{"walk-in-without-email", testDate(dbrepo.TestFreeDate, 0), "", "", http.StatusSeeOther, ""},
+		{"email-required", testDate(dbrepo.TestFreeDate, 0), "", "1", http.StatusOK, "This field cannot be blank"},
+		{"not-available", "2050-01-01", "jd@jd.com", "1", http.StatusOK, "This room is not available for the selected dates."},
+	}
+
+	for _, e := range newResTests {
+		startDate, _ := time.Parse("2006-01-02", e.start)
+
+		postedData := url.Values{}
+		postedData.Add("room_id", "1")
+		postedData.Add("start_date", e.start)
+		postedData.Add("end_date", startDate.AddDate(0, 0, 2).Format("2006-01-02"))
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Doe")
+		postedData.Add("email", e.email)
+		postedData.Add("source", "walk-in")
+		postedData.Add("send_email", e.sendEmail)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/new", strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostNewReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if rr.Code == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/reservations/all/1/show" {
+			t.Errorf("failed %s: unexpected redirect to %s", e.name, rr.Header().Get("Location"))
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowReservation(t *testing.T) {
+	version := "2050-01-01T12:00:00Z"
+	free, freeEnd := testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2)
+
+	var editTests = []struct {
+		name               string
+		id                 string
+		start              string
+		end                string
+		roomID             string
+		updatedAt          string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"contacts-only", "7", "", "", "", "", http.StatusSeeOther, ""},
+		{"same-stay", "7", "2050-01-01", "2050-01-02", "1", version, http.StatusSeeOther, ""},
+		{"move", "7", free, freeEnd, "2", version, http.StatusSeeOther, ""},
+		{"conflict", "7", testDate(dbrepo.TestBookedDate, 0), testDate(dbrepo.TestBookedDate, 2), "1", version, http.StatusOK, "This room is not available for the selected dates."},
+		{"end-before-start", "7", freeEnd, free, "1", version, http.StatusOK, "Departure date must be after arrival date."},
+		// другой администратор изменил бронирование после того, как страница была открыта
+		{"stale", "7", free, freeEnd, "2", "2050-01-01T11:00:00Z", http.StatusOK, "changed by someone else"},
+		{"no-version", "7", free, freeEnd, "2", "", http.StatusOK, "Invalid version of the reservation."},
+		{"invoiced", "1", free, freeEnd, "2", version, http.StatusOK, "The invoice for this reservation has been issued"},
+		{"checked-out", "8", free, freeEnd, "2", version, http.StatusOK, "A reservation that has checked out cannot be moved."},
+		{"no-show", "9", free, freeEnd, "2", version, http.StatusOK, "A reservation marked as no-show cannot be moved."},
+	}
+
+	for _, e := range editTests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("notify_guest", "1")
+
+		if e.roomID != "" {
+			postedData.Add("start_date", e.start)
+			postedData.Add("end_date", e.end)
+			postedData.Add("room_id", e.roomID)
+			postedData.Add("updated_at", e.updatedAt)
+		}
+
+		// обработчик берет src и id из RequestURI, поэтому запрос создается через httptest
+		req := httptest.NewRequest("POST", "/admin/reservations/all/"+e.id, strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostShowReservation)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected HTML %s", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminReservationsTimelineJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations-timeline/data?view=month&start="+testDate(dbrepo.TestBookedDate, 0), nil)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminReservationsTimelineJSON)
+
+	handler.ServeHTTP(rr, req)
+
+	var c timeline.Calendar
+
+	err := json.Unmarshal(rr.Body.Bytes(), &c)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+
+	if len(c.Days) != 31 || len(c.Rows) != 2 {
+		t.Fatalf("unexpected calendar %d days, %d rows", len(c.Days), len(c.Rows))
+	}
+
+	bar := c.Rows[1].Bars[0]
+	if bar.ReservationID != 2 || bar.Offset != 2 || bar.Length != 5 || !bar.UpdatedAt.Equal(time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected bar %+v", bar)
+	}
+}
+
+func TestRepository_AdminPostReservationsTimeline(t *testing.T) {
+	version := "2050-01-01T12:00:00Z"
+
+	var moveTests = []struct {
+		name               string
+		id                 string
+		roomID             string
+		start              string
+		end                string
+		updatedAt          string
+		expectedStatusCode int
+		expectedOK         bool
+	}{
+		{"move", "7", "2", testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2), version, http.StatusOK, true},
+		{"stale", "7", "2", testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2), "2050-01-01T11:00:00Z", http.StatusConflict, false},
+		{"not-available", "7", "1", testDate(dbrepo.TestBookedDate, 0), testDate(dbrepo.TestBookedDate, 2), version, http.StatusConflict, false},
+		{"end-before-start", "7", "1", testDate(dbrepo.TestFreeDate, 2), testDate(dbrepo.TestFreeDate, 0), version, http.StatusUnprocessableEntity, false},
+		{"no-version", "7", "1", testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2), "", http.StatusBadRequest, false},
+		{"invoiced", "1", "2", testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2), version, http.StatusUnprocessableEntity, false},
+		{"no-show", "9", "2", testDate(dbrepo.TestFreeDate, 0), testDate(dbrepo.TestFreeDate, 2), version, http.StatusUnprocessableEntity, false},
+	}
+
+	for _, e := range moveTests {
+		postedData := url.Values{}
+		postedData.Add("reservation_id", e.id)
+		postedData.Add("room_id", e.roomID)
+		postedData.Add("start_date", e.start)
+		postedData.Add("end_date", e.end)
+		postedData.Add("updated_at", e.updatedAt)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations-timeline", strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostReservationsTimeline)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		var j jsonResponse
+
+		err = json.Unmarshal(rr.Body.Bytes(), &j)
+		if err != nil {
+			t.Errorf("failed %s: cannot parse json", e.name)
+		}
+
+		if j.OK != e.expectedOK {
+			t.Errorf("failed %s: got ok %v, message %s", e.name, j.OK, j.Message)
+		}
+	}
+}
+
+func TestRepository_AdminPostReservationsCalendar(t *testing.T) {
+	current, _ := Repo.DB.GetRestrictionsForRoomByDate(context.Background(), 1, dbrepo.TestBookedDate, dbrepo.TestBookedDate.AddDate(0, 1, -1))
+	version := blocks.Version(current)
+
+	// блокировка владельцем из тестового репозитория и день с бронированием комнаты 1
+	blocked, booked := testDate(dbrepo.TestBookedDate, 19), testDate(dbrepo.TestBookedDate, 0)
+
+	var calendarTests = []struct {
+		name          string
+		version       string
+		fields        map[string]string
+		expectedFlash string
+		expectedError string
+	}{
+		{"remove-block", version, map[string]string{"block_1_" + blocked: "3"}, "Changes saved", ""},
+		{"keep-and-add", version, map[string]string{"block_1_" + blocked: "3", "remove_block_1_" + blocked: "1", "add_block_1_" + testDate(dbrepo.TestBookedDate, 14): "1"}, "Changes saved", ""},
+		{"stale-version", "old", map[string]string{"block_1_" + blocked: "3"}, "", "blocks were changed by someone else"},
+		{"wrong-block-id", version, map[string]string{"block_1_" + blocked: "9"}, "", "block on " + blocked + " no longer exists"},
+		{"add-on-reservation", version, map[string]string{"add_block_1_" + booked: "1"}, "", booked + " is already taken"},
+		{"booked-meanwhile", version, map[string]string{"add_block_1_" + dbrepo.TestBlockTakenDate.Format("2006-01-02"): "1"}, "", "some of the days have just been booked"},
+		{"changed-meanwhile", version, map[string]string{"add_block_1_" + dbrepo.TestBlocksChangedDate.Format("2006-01-02"): "1"}, "", "Blocks were changed by someone else"},
+	}
+
+	for _, e := range calendarTests {
+		postedData := url.Values{}
+		postedData.Add("y", strconv.Itoa(dbrepo.TestBookedDate.Year()))
+		postedData.Add("m", fmt.Sprintf("%02d", dbrepo.TestBookedDate.Month()))
+		postedData.Add("version_1", e.version)
+
+		for k, v := range e.fields {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(postedData.Encode()))
+
+		// в сессии нет block_map_N: раньше такой запрос приводил к панике
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostReservationsCalendar)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		if e.expectedFlash != "" && session.GetString(ctx, "flash") != e.expectedFlash {
+			t.Errorf("failed %s: got flash %q", e.name, session.GetString(ctx, "flash"))
+		}
+
+		if e.expectedError != "" && !strings.Contains(session.GetString(ctx, "error"), e.expectedError) {
+			t.Errorf("failed %s: got error %q", e.name, session.GetString(ctx, "error"))
+		}
+	}
+}
+
+func TestRepository_AuditLog(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/process-reservation/new/1/do", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	session.Put(ctx, "user_id", 7)
+
+	req = req.WithContext(addIdToChiContext(ctx, "1"))
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminProcessReservation)
+
+	handler.ServeHTTP(rr, req)
+
+	entries, _, _ := Repo.DB.GetAuditEntries(context.Background(), models.AuditFilter{Entity: "reservation", EntityID: 1, Action: "process"})
+	if len(entries) == 0 {
+		t.Fatal("processing a reservation was not recorded in the audit log")
+	}
+
+	e := entries[0]
+	if e.UserID != 7 || e.IP != "10.0.0.1" || !strings.Contains(e.Before, `"processed":0`) || !strings.Contains(e.After, `"processed":1`) {
+		t.Errorf("unexpected audit entry %+v", e)
+	}
+
+	// гость записывается по email
+	postedData := url.Values{}
+	postedData.Add("name", "Jane")
+	postedData.Add("email", "jane@guest.com")
+	postedData.Add("start_date", testDate(dbrepo.TestBookedDate, 1))
+	postedData.Add("end_date", testDate(dbrepo.TestBookedDate, 3))
+
+	req, _ = http.NewRequest("POST", "/waitlist", strings.NewReader(postedData.Encode()))
+	ctx, _ = session.Load(req.Context(), req.Header.Get("X-Session"))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	http.HandlerFunc(Repo.PostWaitlist).ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, _, _ = Repo.DB.GetAuditEntries(context.Background(), models.AuditFilter{Entity: "waitlist_entry"})
+	if len(entries) == 0 || entries[0].UserID != 0 || entries[0].Actor != "jane@guest.com" {
+		t.Errorf("unexpected waitlist audit entries %+v", entries)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/audit-log?entity=reservation&entity_id=1", nil)
+	ctx, _ = session.Load(req.Context(), req.Header.Get("X-Session"))
+	req = req.WithContext(ctx)
+
+	rr = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminAuditLog).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "<strong>processed</strong>: 0 &rarr; 1") {
+		t.Error("audit log page does not show the change")
+	}
+}
+
+func TestRepository_AdminReservationInvoice(t *testing.T) {
+	var invoiceTests = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"valid", "1", http.StatusOK},
+		// по бронированию 2 ничего не оплачено, счет еще не выставлен
+		{"not-issued", "2", http.StatusSeeOther},
+		{"invalid-id", "abc", http.StatusInternalServerError},
+		{"not-found", "5000", http.StatusInternalServerError},
+	}
+
+	for _, e := range invoiceTests {
+		req, _ := http.NewRequest("GET", "/admin/reservations/all/"+e.id+"/invoice", nil)
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+		if err != nil {
+			log.Println(err)
+		}
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationInvoice)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/reservations/all/1/invoice", nil)
+	req = req.WithContext(addIdToChiContext(req.Context(), "1"))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReservationInvoice).ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Error("expected PDF document in response")
+	}
+
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "invoice-2050-000001.pdf") {
+		t.Errorf("unexpected Content-Disposition %s", rr.Header().Get("Content-Disposition"))
+	}
+
+	// счет, документ которого сохранен при выставлении, отдается как есть, а не собирается заново
+	req, _ = http.NewRequest("GET", "/admin/reservations/all/5/invoice", nil)
+	req = req.WithContext(addIdToChiContext(req.Context(), "5"))
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReservationInvoice).ServeHTTP(rr, req)
+
+	if rr.Body.String() != string(dbrepo.TestInvoiceDocument) {
+		t.Errorf("expected the stored invoice document, got %q", rr.Body.String())
+	}
+
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "invoice-2050-000002.pdf") {
+		t.Errorf("unexpected Content-Disposition %s", rr.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestRepository_AvailabilityJSON_RoomIsNotAvailable(t *testing.T) {
+
+	reqBody := "start_date=2050-01-01"
+	reqBody = fmt.Sprintf("%s&%s&%s", reqBody, "end_date=2050-01-02", "room_id=1")
+
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	var j jsonResponse
+
+	// Ответ (rr.Body.String()) парсится в структуру jsonResponse.
+	// Если парсинг не удаётся, тест падает с ошибкой failed parse json.
+	err = json.Unmarshal([]byte(rr.Body.String()), &j)
+
+	if err != nil {
+		t.Error("failed parse json")
+	}
+
+}
+
+func TestRepository_ChooseRoom_MissingURLParameter(t *testing.T) {
+	// Создаем запрос с пустым ID
+	req, _ := http.NewRequest("GET", "/choose-room/", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	// Устанавливаем ResponseRecorder
+	rr := httptest.NewRecorder()
+
+	// Вызываем обработчик
+	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем редирект
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+
+	// Проверяем сообщение об ошибке в сессии
+	flash := Repo.App.Session.PopString(req.Context(), "error")
+	if flash != "missing url parameter" {
+		t.Errorf("Expected flash 'missing url parameter', got '%s'", flash)
+	}
+}
+
+func TestRepository_ChooseRoom_NoReservationInSession(t *testing.T) {
+	// Создаем запрос с корректным ID
+	req, _ := http.NewRequest("GET", "/choose-room/1", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	ctx = addIdToChiContext(ctx, "1")
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+
+	flash := Repo.App.Session.PopString(req.Context(), "error")
+
+	if flash != "problem getting reservation from session" {
+		t.Errorf("Expected flash 'problem getting reservation from session', got '%s'", flash)
+	}
+}
+
+func TestRepository_ChooseRoom_Success(t *testing.T) {
+	// Создаем тестовую резервацию
+	reservation := models.Reservation{
+		RoomID: 0,
+		// другие поля...
+	}
+
+	// Создаем запрос с ID комнаты
+	req, _ := http.NewRequest("GET", "/choose-room/1", nil)
+
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	ctx = addIdToChiContext(ctx, "1")
+	req = req.WithContext(ctx)
+
+	// Кладем резервацию в сессию
+	Repo.App.Session.Put(ctx, "reservation", reservation)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем редирект
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected status %d, got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	// Проверяем, что резервация обновилась
+	updatedRes, ok := Repo.App.Session.Get(ctx, "reservation").(models.Reservation)
+	if !ok {
+		t.Error("Failed to get reservation from session")
+	}
+
+	if updatedRes.RoomID != 1 {
+		t.Errorf("Expected room ID 1, got %d", updatedRes.RoomID)
+	}
+}
+
+var loginTests = []struct {
+	name               string
+	email              string
+	expectedStatusCode int
+	expectedHTML       string
+	expectedLocation   string
+	expectedRole       string
+}{
+	{"valid-credentials",
+		"me@here.ca",
+		http.StatusSeeOther,
+		"",
+		"/",
+		access.RoleAdmin,
+	},
+	{
+		"housekeeping",
+		"maid@here.ca",
+		http.StatusSeeOther,
+		"",
+		"/",
+		housekeeping.Role,
+	},
+	{
+		"invalid-credentials",
+		"jack@nimble.com",
+		http.StatusSeeOther,
+		"",
+		"/user/login",
+		"",
+	},
+	{
+		"invalid-data",
+		"j",
+		http.StatusOK,
+		`action="/user/login"`,
+		"",
+		"",
+	},
+}
+
+func TestLogin(t *testing.T) {
+	for _, e := range loginTests {
+		postedData := url.Values{}
+		postedData.Add("email", e.email)
+		postedData.Add("password", "password")
+
+		// Метод .Encode() преобразует эту структуру в строку, закодированную по стандарту application/x-www-form-urlencoded
+		// strings.NewReader — это функция из пакета strings.
+		// Она принимает строку и возвращает объект типа *strings.Reader, который реализует интерфейс io.Reader.
+		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostShowLogin)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("Expected status %d, got %d", e.expectedStatusCode, rr.Code)
+		}
+
+		// роль сохраняется в сессии, по ней middleware пускает в админку
+		if role := session.GetString(ctx, "user_role"); role != e.expectedRole {
+			t.Errorf("failed %s: got role %q, want %q", e.name, role, e.expectedRole)
+		}
+
+		if e.expectedLocation != "" {
+			actualLocation, _ := rr.Result().Location()
+
+			if actualLocation.String() != e.expectedLocation {
+				t.Errorf("failed %s: Expected location %s, got %s", e.name, e.expectedLocation, actualLocation.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+
+			// Прочитаем тело ответа
+			html := rr.Body.String()
+			// Это подстрока, которую тест ищет в HTML, чтобы убедиться, что сервер вернул страницу с формой логина.
+			// в e.expectedHTML можем прокинуть любую инфу которая содержится в html странице в нашем случае (login.page.tmpl)
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: Expected HTML %s, got %s", e.name, e.expectedHTML, html)
+			}
+		}
+
+	}
+}
+
+func addIdToChiContext(parentCtx context.Context, id string) context.Context {
+
+	// Создаёт пустой RouteContext — специальный объект Chi для хранения параметров маршрута (например, id из /users/{id}).
+	chiCtx := chi.NewRouteContext()
+
+	// Вручную добавляет параметр id в контекст маршрута.
+	//Теперь chi.URLParam(r, "id") в обработчике сможет получить это значение.
+	chiCtx.URLParams.Add("id", id)
+	//fmt.Println(chi.RouteCtxKey)
+
+	// chi.RouteCtxKey - это ключ, по которому Chi ищет свой контекст
+	// Зачем передавать chi.RouteCtxKey
+	// Chi ищет свой контекст по этому ключу.
+	// Когда вы вызываете chi.URLParam(r, "id"), фреймворк делает примерно следующее:
+	// func URLParam(r *http.Request, key string) string {
 	//    if rctx := r.Context().Value(chi.RouteCtxKey); rctx != nil {
 	//        return rctx.(*RouteContext).URLParams.Get(key) // Ищет по chi.RouteCtxKey
 	//    }
@@ -736,3 +2195,185 @@ func addIdToChiContext(parentCtx context.Context, id string) context.Context {
 	// Chi не найдёт свой контекст, и URLParam() вернёт "".
 	return context.WithValue(parentCtx, chi.RouteCtxKey, chiCtx) // Сохраняем контекст Chi в родительский контекст
 }
+
+func TestRepository_FrontDesk(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+	var frontDeskTests = []struct {
+		name        string
+		handler     http.HandlerFunc
+		id          string
+		data        url.Values
+		expectedKey string
+		action      string
+	}{
+		{"check-in", Repo.AdminPostCheckIn, "4", url.Values{"id_document_type": {"passport"}, "id_document_number": {"X1"}}, "flash", "check_in"},
+		{"check-in-no-document", Repo.AdminPostCheckIn, "4", url.Values{"id_document_type": {"passport"}}, "error", ""},
+		{"check-in-twice", Repo.AdminPostCheckIn, "5", url.Values{"id_document_type": {"passport"}, "id_document_number": {"X1"}}, "error", ""},
+		{"early-check-out", Repo.AdminPostCheckOut, "5", url.Values{}, "flash", "check_out"},
+		{"late-check-out-taken", Repo.AdminPostCheckOut, "5", url.Values{"departure_date": {testDate(dbrepo.TestBookedDate, 4)}}, "error", ""},
+		{"check-out-not-in-house", Repo.AdminPostCheckOut, "4", url.Values{"departure_date": {tomorrow}}, "error", ""},
+		{"no-show", Repo.AdminPostNoShow, "6", url.Values{}, "flash", "no_show"},
+		{"no-show-in-house", Repo.AdminPostNoShow, "5", url.Values{}, "error", ""},
+		{"check-in-changed", Repo.AdminPostCheckIn, "10", url.Values{"id_document_type": {"passport"}, "id_document_number": {"X1"}}, "error", ""},
+		{"no-show-changed", Repo.AdminPostNoShow, "10", url.Values{}, "error", ""},
+	}
+
+	for _, e := range frontDeskTests {
+		req, _ := http.NewRequest("POST", "/admin/front-desk/"+e.id, strings.NewReader(e.data.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		session.Put(ctx, "user_id", 1)
+
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		if session.GetString(ctx, e.expectedKey) == "" {
+			t.Errorf("failed %s: expected %s message in session", e.name, e.expectedKey)
+		}
+
+		id, _ := strconv.Atoi(e.id)
+		entries, _, _ := Repo.DB.GetAuditEntries(context.Background(), models.AuditFilter{Entity: "reservation", EntityID: id, Action: e.action})
+
+		if e.action != "" && len(entries) == 0 {
+			t.Errorf("failed %s: action was not recorded in the audit log", e.name)
+		}
+
+		if e.expectedKey == "error" && id == 10 && len(entries) > 0 {
+			t.Errorf("failed %s: refused action was recorded in the audit log", e.name)
+		}
+	}
+}
+
+func TestRepository_Housekeeping(t *testing.T) {
+	var housekeepingTests = []struct {
+		name        string
+		handler     http.HandlerFunc
+		id          string
+		data        url.Values
+		expectedKey string
+	}{
+		{"generate", Repo.AdminPostHousekeepingGenerate, "", url.Values{"date": {"2050-01-10"}}, "flash"},
+		{"generate-bad-date", Repo.AdminPostHousekeepingGenerate, "", url.Values{"date": {"invalid"}}, "error"},
+		{"start-cleaning", Repo.AdminPostHousekeepingTask, "1", url.Values{"status": {"in_progress"}, "assigned_to": {"2"}}, "flash"},
+		{"skip-to-inspected", Repo.AdminPostHousekeepingTask, "1", url.Values{"status": {"inspected"}}, "error"},
+		{"assign-to-admin", Repo.AdminPostHousekeepingTask, "1", url.Values{"status": {"dirty"}, "assigned_to": {"1"}}, "error"},
+		{"inspect", Repo.AdminPostHousekeepingTask, "2", url.Values{"status": {"inspected"}, "assigned_to": {"2"}}, "flash"},
+	}
+
+	for _, e := range housekeepingTests {
+		req, _ := http.NewRequest("POST", "/admin/housekeeping", strings.NewReader(e.data.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		if session.GetString(ctx, e.expectedKey) == "" {
+			t.Errorf("failed %s: expected %s message in session", e.name, e.expectedKey)
+		}
+	}
+
+	// грязная комната помечена на календаре
+	req, _ := http.NewRequest("GET", "/admin/reservations-calendar?y=2050&m=01", nil)
+	ctx, _ := session.Load(req.Context(), req.Header.Get("X-Session"))
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminReservationsCalendar).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `class="badge bg-warning text-dark">dirty</a>`) {
+		t.Error("calendar does not show the dirty room")
+	}
+}
+
+func TestRepository_AdminPostMaintenanceTicket(t *testing.T) {
+	var ticketTests = []struct {
+		name               string
+		id                 string
+		data               url.Values
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"new", "new", url.Values{"room_id": {"1"}, "description": {"Boiler"}, "priority": {"urgent"}, "status": {"open"},
+			"out_of_order": {"1"}, "start_date": {testDate(dbrepo.TestFreeDate, 0)}, "expected_resolution": {testDate(dbrepo.TestFreeDate, 4)}}, http.StatusSeeOther, ""},
+		{"no-resolution-date", "new", url.Values{"room_id": {"1"}, "description": {"Boiler"}, "priority": {"urgent"}, "status": {"open"},
+			"out_of_order": {"1"}, "start_date": {testDate(dbrepo.TestFreeDate, 0)}}, http.StatusOK, "expected resolution date"},
+		{"booked-days", "new", url.Values{"room_id": {"1"}, "description": {"Boiler"}, "priority": {"high"}, "status": {"open"},
+			"out_of_order": {"1"}, "start_date": {testDate(dbrepo.TestBookedDate, 1)}, "expected_resolution": {testDate(dbrepo.TestBookedDate, 3)}}, http.StatusOK, "move them before closing the room"},
+		{"missing-description", "new", url.Values{"room_id": {"1"}, "priority": {"low"}, "status": {"open"},
+			"start_date": {testDate(dbrepo.TestFreeDate, 0)}}, http.StatusOK, "This field cannot be blank"},
+		// продление своей же блокировки не считается конфликтом
+		{"extend", "1", url.Values{"room_id": {"2"}, "description": {"Boiler is broken"}, "priority": {"urgent"}, "status": {"in_progress"},
+			"out_of_order": {"1"}, "start_date": {testDate(dbrepo.TestBookedDate, 9)}, "expected_resolution": {testDate(dbrepo.TestBookedDate, 14)}}, http.StatusSeeOther, ""},
+		{"close", "1", url.Values{"room_id": {"2"}, "description": {"Boiler is broken"}, "priority": {"urgent"}, "status": {"closed"},
+			"out_of_order": {"1"}, "start_date": {testDate(dbrepo.TestBookedDate, 9)}, "expected_resolution": {testDate(dbrepo.TestBookedDate, 12)}}, http.StatusSeeOther, ""},
+	}
+
+	for _, e := range ticketTests {
+		req, _ := http.NewRequest("POST", "/admin/maintenance/"+e.id, strings.NewReader(e.data.Encode()))
+
+		ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		req = req.WithContext(addIdToChiContext(ctx, e.id))
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostMaintenanceTicket).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: got status code %d, want %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %q", e.name, e.expectedHTML)
+		}
+	}
+
+	// дни, закрытые заявкой, ведут из календаря на заявку
+	req, _ := http.NewRequest("GET", "/admin/reservations-calendar?"+testBookedMonth, nil)
+	ctx, _ := session.Load(req.Context(), req.Header.Get("X-Session"))
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminReservationsCalendar).ServeHTTP(rr, req)
+
+	if strings.Count(rr.Body.String(), `href="/admin/maintenance/1"`) != 3 {
+		t.Error("calendar does not link the maintenance ticket from its days")
+	}
+}
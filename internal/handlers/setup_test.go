@@ -8,10 +8,16 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/helpers"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
+	"github.com/krasnov23/guest-house-golang/internal/metrics"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
 	"github.com/krasnov23/guest-house-golang/internal/render"
+	"github.com/krasnov23/guest-house-golang/internal/reports"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -32,6 +38,9 @@ var functions = template.FuncMap{
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
 	"add":        render.Add,
+	"weekdays":   render.Weekdays,
+	"money":      render.FormatMoney,
+	"reportCell": reports.FormatCell,
 }
 
 func TestMain(m *testing.M) {
@@ -45,12 +54,9 @@ func TestMain(m *testing.M) {
 	// изменяем данное свойство когда выходим в продакшн
 	app.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	// будет отображать Дата + время + сообщение в консоли
-	errLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errLog
+	// в тестах пишем логи в консоль в том же JSON-формате, что и в продакшне
+	app.Logger = logging.New(os.Stdout, slog.LevelInfo)
+	app.Metrics = metrics.New()
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -76,6 +82,10 @@ func TestMain(m *testing.M) {
 	// корневой директории в нашем же случае путь до шаблонов будет указывать с текущей директории где  написан данный тест
 	// true нужен для функции render.Template()
 	app.UseCache = true
+	app.SuggestionDays = 7
+	app.Payments = payments.NewFakeProvider("test-secret")
+	app.DepositPercent = 30
+	app.Currency = "USD"
 
 	listenForMail()
 
@@ -86,6 +96,7 @@ func TestMain(m *testing.M) {
 
 	// прокидываются данные для функции RenderTemplate
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	// m.Run() – запускает все тесты (*testing.M), которые определены в текущем пакете, и возвращает код завершения (exit code):
 	//0 – если все тесты прошли успешно.
@@ -109,20 +120,27 @@ func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
+	mux.Use(app.Metrics.Middleware)
 	//mux.Use(NoSurf)
 	mux.Use(SessionLoad)
 
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
+	mux.Handle("/metrics", app.Metrics.Registry)
 	mux.Get("/generals-quarters", Repo.Generals)
 	mux.Get("/majors-suite", Repo.Majors)
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/availability-calendar", Repo.AvailabilityCalendar)
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Get("/choose-room/{id}", Repo.ChooseRoom)
+	mux.Post("/waitlist", Repo.PostWaitlist)
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
+	mux.Get("/make-payment", Repo.Payment)
+	mux.Post("/make-payment", Repo.PostPayment)
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
 	mux.Get("/contact", Repo.Contact)
 
@@ -135,12 +153,48 @@ func getRoutes() http.Handler {
 	mux.Get("/admin/reservations-all", Repo.AdminAllReservations)
 	mux.Get("/admin/reservations-calendar", Repo.AdminReservationsCalendar)
 	mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
+	mux.Get("/admin/reservations-timeline", Repo.AdminReservationsTimeline)
+	mux.Get("/admin/reservations-timeline/data", Repo.AdminReservationsTimelineJSON)
+	mux.Post("/admin/reservations-timeline", Repo.AdminPostReservationsTimeline)
+	mux.Get("/admin/front-desk", Repo.AdminFrontDesk)
+	mux.Post("/admin/front-desk/{id}/check-in", Repo.AdminPostCheckIn)
+	mux.Post("/admin/front-desk/{id}/check-out", Repo.AdminPostCheckOut)
+	mux.Post("/admin/front-desk/{id}/no-show", Repo.AdminPostNoShow)
+	mux.Get("/admin/housekeeping", Repo.AdminHousekeeping)
+	mux.Post("/admin/housekeeping/generate", Repo.AdminPostHousekeepingGenerate)
+	mux.Post("/admin/housekeeping/{id}", Repo.AdminPostHousekeepingTask)
+	mux.Get("/admin/maintenance", Repo.AdminMaintenance)
+	mux.Get("/admin/maintenance/{id}", Repo.AdminMaintenanceTicket)
+	mux.Post("/admin/maintenance/{id}", Repo.AdminPostMaintenanceTicket)
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Post("/admin/cancel-reservation/{src}/{id}/do", Repo.AdminCancelReservation)
+	mux.Post("/admin/refund-payment/{src}/{id}/do", Repo.AdminRefundPayment)
 
+	mux.Get("/admin/reservations/new", Repo.AdminNewReservation)
+	mux.Post("/admin/reservations/new", Repo.AdminPostNewReservation)
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
+	mux.Get("/admin/reservations/{src}/{id}/invoice", Repo.AdminReservationInvoice)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
 
+	mux.Get("/admin/stay-rules", Repo.AdminStayRules)
+	mux.Post("/admin/stay-rules", Repo.AdminPostStayRules)
+	mux.Post("/admin/stay-rules/{id}/delete", Repo.AdminDeleteStayRule)
+
+	mux.Get("/admin/taxes", Repo.AdminTaxRules)
+	mux.Post("/admin/taxes", Repo.AdminPostTaxRules)
+	mux.Post("/admin/taxes/{id}/delete", Repo.AdminDeleteTaxRule)
+
+	mux.Get("/admin/promo-codes", Repo.AdminPromoCodes)
+	mux.Get("/admin/promo-codes/{id}", Repo.AdminPromoCode)
+	mux.Post("/admin/promo-codes/{id}", Repo.AdminPostPromoCode)
+	mux.Post("/admin/promo-codes/{id}/delete", Repo.AdminDeletePromoCode)
+	mux.Get("/admin/promo-codes/{id}/usage", Repo.AdminPromoCodeUsage)
+
+	mux.Get("/admin/audit-log", Repo.AdminAuditLog)
+	mux.Get("/admin/reports", Repo.AdminReports)
+	mux.Get("/admin/reports/{report}/{format}", Repo.AdminReportExport)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 	return mux
@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// ErrTimeout - проверка не уложилась в отведенное время
+var ErrTimeout = errors.New("check timed out")
+
+// Check - одна проверка готовности: Run должен уважать отмену контекста
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult - результат одной проверки в ответе /readyz
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Response - тело ответа /healthz и /readyz
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Live отвечает, что процесс жив; ничего внешнего не проверяет, чтобы оркестратор не перезапускал
+// приложение из-за недоступной БД
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, Response{Status: StatusOK})
+}
+
+// Run выполняет проверки параллельно, каждую не дольше timeout. Проверка, которая не вернулась вовремя,
+// считается проваленной, даже если не уважает контекст
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Response {
+	resp := Response{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+
+			res := runCheck(ctx, timeout, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[c.Name] = res
+			if res.Status != StatusOK {
+				resp.Status = StatusFail
+			}
+		}(c)
+	}
+
+	wg.Wait()
+
+	return resp
+}
+
+func runCheck(ctx context.Context, timeout time.Duration, c Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// буфер на одно значение, чтобы зависшая проверка могла завершиться и после того, как ее перестали ждать
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	res := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// Ready возвращает обработчик /readyz: 200, если все проверки прошли, иначе 503 с разбором по проверкам
+func Ready(timeout time.Duration, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := Run(r.Context(), timeout, checks)
+
+		status := http.StatusOK
+		if resp.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeResponse(w, status, resp)
+	}
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	out, _ := json.MarshalIndent(resp, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(out)
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLive(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	var resp Response
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+
+	if rr.Code != http.StatusOK || resp.Status != StatusOK {
+		t.Errorf("got %d %+v", rr.Code, resp)
+	}
+}
+
+func TestReady(t *testing.T) {
+	ok := Check{Name: "database", Run: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "smtp", Run: func(ctx context.Context) error { return errors.New("connection refused") }}
+	// проверка, которая не смотрит на контекст, не должна задерживать ответ
+	stuck := Check{Name: "templates", Run: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		want   int
+		failed map[string]string
+	}{
+		{"all-ok", []Check{ok}, http.StatusOK, nil},
+		{"one-failed", []Check{ok, failing}, http.StatusServiceUnavailable, map[string]string{"smtp": "connection refused"}},
+		{"timeout", []Check{ok, stuck}, http.StatusServiceUnavailable, map[string]string{"templates": ErrTimeout.Error()}},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+
+		start := time.Now()
+		Ready(50*time.Millisecond, e.checks...)(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: readiness took %s", e.name, time.Since(start))
+		}
+
+		if rr.Code != e.want {
+			t.Errorf("%s: got status %d, want %d", e.name, rr.Code, e.want)
+		}
+
+		var resp Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid json: %v", e.name, err)
+		}
+
+		if len(resp.Checks) != len(e.checks) {
+			t.Errorf("%s: got %d checks, want %d", e.name, len(resp.Checks), len(e.checks))
+		}
+
+		for name, res := range resp.Checks {
+			wantErr, failed := e.failed[name]
+			if failed && (res.Status != StatusFail || res.Error != wantErr) {
+				t.Errorf("%s: check %s got %+v, want error %q", e.name, name, res, wantErr)
+			}
+			if !failed && res.Status != StatusOK {
+				t.Errorf("%s: check %s failed: %+v", e.name, name, res)
+			}
+		}
+	}
+}
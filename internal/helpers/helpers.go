@@ -1,8 +1,8 @@
 package helpers
 
 import (
-	"fmt"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
 	"net/http"
 	"runtime/debug"
 )
@@ -13,14 +13,14 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	app.InfoLog.Println("Client error: %d\n", status)
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	logging.FromContext(r.Context()).Info("client error", "status", status)
 	http.Error(w, http.StatusText(status), status)
 }
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+// ServerError пишет ошибку со стеком в лог запроса и отвечает 500
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("server error", "error", err.Error(), "stack", string(debug.Stack()))
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
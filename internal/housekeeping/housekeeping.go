@@ -0,0 +1,154 @@
+package housekeeping
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/frontdesk"
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Role - роль пользователей, которым назначается уборка
+const Role = "housekeeping"
+
+// Виды уборки: после выезда гостя и у гостя, который остается
+const (
+	KindDeparture = "departure"
+	KindStayOver  = "stay_over"
+)
+
+// Состояния задачи уборки
+const (
+	StatusDirty      = "dirty"
+	StatusInProgress = "in_progress"
+	StatusClean      = "clean"
+	StatusInspected  = "inspected"
+)
+
+// Statuses - состояния в порядке работы, по ним строятся колонки доски
+var Statuses = []string{StatusDirty, StatusInProgress, StatusClean, StatusInspected}
+
+// transitions - допустимые переходы: вперед по порядку работы, и возврат в dirty, если уборку не приняли
+var transitions = map[string][]string{
+	StatusDirty:      {StatusInProgress, StatusClean},
+	StatusInProgress: {StatusDirty, StatusClean},
+	StatusClean:      {StatusDirty, StatusInspected},
+	StatusInspected:  {StatusDirty},
+}
+
+// CanMove проверяет, что задачу можно перевести из состояния from в to
+func CanMove(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	for _, s := range transitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("a task cannot go from %s to %s", from, to)
+}
+
+// Generate создает задачи уборки на день по бронированиям, которые его захватывают (start_date <= day <= end_date):
+// у комнаты, из которой сегодня выезжают, - уборка после выезда, у комнаты с проживающим гостем - текущая уборка.
+// Выезд важнее: если в комнату в тот же день заезжает следующий гость, ее нужно убрать полностью.
+// Отмененные бронирования и гости, которые не приехали, комнату не пачкают
+func Generate(day time.Time, reservations []models.Reservation) []models.HousekeepingTask {
+	day = frontdesk.Day(day)
+
+	byRoom := make(map[int]models.HousekeepingTask)
+
+	for _, res := range reservations {
+		status := frontdesk.Status(res)
+		if status == frontdesk.StatusCancelled || status == frontdesk.StatusNoShow {
+			continue
+		}
+
+		start, end := frontdesk.Day(res.StartDate), frontdesk.Day(res.EndDate)
+
+		var kind string
+
+		switch {
+		case end.Equal(day):
+			kind = KindDeparture
+		case start.Before(day) && end.After(day):
+			kind = KindStayOver
+		default:
+			continue
+		}
+
+		if t, ok := byRoom[res.RoomID]; ok && t.Kind == KindDeparture {
+			continue
+		}
+
+		byRoom[res.RoomID] = models.HousekeepingTask{
+			RoomID:        res.RoomID,
+			ReservationID: res.ID,
+			TaskDate:      day,
+			Kind:          kind,
+			Status:        StatusDirty,
+		}
+	}
+
+	tasks := make([]models.HousekeepingTask, 0, len(byRoom))
+	for _, t := range byRoom {
+		tasks = append(tasks, t)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].RoomID < tasks[j].RoomID
+	})
+
+	return tasks
+}
+
+// IsClean сообщает, убрана ли комната по ее последней задаче уборки
+func IsClean(t models.HousekeepingTask) bool {
+	return t.Status == StatusClean || t.Status == StatusInspected
+}
+
+// RoomStatus возвращает clean или dirty для каждой комнаты по последним задачам уборки.
+// Комната без задач считается чистой
+func RoomStatus(rooms []models.Room, latest []models.HousekeepingTask) map[int]string {
+	status := make(map[int]string)
+
+	for _, r := range rooms {
+		status[r.ID] = StatusClean
+	}
+
+	for _, t := range latest {
+		if !IsClean(t) {
+			status[t.RoomID] = StatusDirty
+		}
+	}
+
+	return status
+}
+
+// Column - колонка доски уборки
+type Column struct {
+	Status string
+	Tasks  []models.HousekeepingTask
+}
+
+// Board раскладывает задачи по колонкам состояний
+func Board(tasks []models.HousekeepingTask) []Column {
+	columns := make([]Column, 0, len(Statuses))
+
+	for _, s := range Statuses {
+		c := Column{Status: s}
+
+		for _, t := range tasks {
+			if t.Status == s {
+				c.Tasks = append(c.Tasks, t)
+			}
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns
+}
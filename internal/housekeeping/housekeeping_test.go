@@ -0,0 +1,80 @@
+package housekeeping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestGenerate(t *testing.T) {
+	day := date(2050, 1, 10)
+
+	tasks := Generate(day.Add(9*time.Hour), []models.Reservation{
+		// комната 1: выезд и заезд в один день - уборка после выезда
+		{ID: 1, RoomID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 12)},
+		{ID: 2, RoomID: 1, StartDate: date(2050, 1, 7), EndDate: date(2050, 1, 10)},
+		// комната 2: гость остается
+		{ID: 3, RoomID: 2, StartDate: date(2050, 1, 9), EndDate: date(2050, 1, 11)},
+		// комната 3: гость не приехал
+		{ID: 4, RoomID: 3, StartDate: date(2050, 1, 9), EndDate: date(2050, 1, 11), NoShowAt: date(2050, 1, 9)},
+	})
+
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2: %+v", len(tasks), tasks)
+	}
+
+	if tasks[0].RoomID != 1 || tasks[0].Kind != KindDeparture || tasks[0].ReservationID != 2 || !tasks[0].TaskDate.Equal(day) {
+		t.Errorf("unexpected task %+v", tasks[0])
+	}
+
+	if tasks[1].RoomID != 2 || tasks[1].Kind != KindStayOver || tasks[1].Status != StatusDirty {
+		t.Errorf("unexpected task %+v", tasks[1])
+	}
+}
+
+func TestCanMove(t *testing.T) {
+	var tests = []struct {
+		from, to string
+		ok       bool
+	}{
+		{StatusDirty, StatusInProgress, true},
+		{StatusInProgress, StatusClean, true},
+		{StatusClean, StatusInspected, true},
+		{StatusInspected, StatusDirty, true},
+		{StatusDirty, StatusInspected, false},
+		{StatusInspected, StatusInProgress, false},
+		{StatusClean, StatusClean, true},
+	}
+
+	for _, e := range tests {
+		if err := CanMove(e.from, e.to); (err == nil) != e.ok {
+			t.Errorf("%s -> %s: got %v", e.from, e.to, err)
+		}
+	}
+}
+
+func TestRoomStatus(t *testing.T) {
+	rooms := []models.Room{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	status := RoomStatus(rooms, []models.HousekeepingTask{
+		{RoomID: 1, Status: StatusInProgress},
+		{RoomID: 2, Status: StatusInspected},
+	})
+
+	if status[1] != StatusDirty || status[2] != StatusClean || status[3] != StatusClean {
+		t.Errorf("unexpected status %v", status)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	columns := Board([]models.HousekeepingTask{{ID: 1, Status: StatusClean}, {ID: 2, Status: StatusDirty}})
+
+	if len(columns) != len(Statuses) || len(columns[0].Tasks) != 1 || columns[0].Tasks[0].ID != 2 || len(columns[2].Tasks) != 1 {
+		t.Errorf("unexpected board %+v", columns)
+	}
+}
@@ -0,0 +1,254 @@
+package invoice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/payments"
+	"github.com/krasnov23/guest-house-golang/internal/pricing"
+)
+
+// SellerName - название гостевого дома в шапке счета
+const SellerName = "Fort Smythe Bed and Breakfast"
+
+// Line - строка счета. Суммы в копейках (центах), у скидок Amount отрицательный
+type Line struct {
+	Description string
+	Quantity    int
+	UnitPrice   int
+	Amount      int
+}
+
+// Invoice - счет по бронированию, из которого собирается PDF
+type Invoice struct {
+	Number      string
+	IssuedAt    time.Time
+	Currency    string
+	Reservation models.Reservation
+	Lines       []Line
+	Discounts   []Line
+	Taxes       []Line
+	Payments    []models.Payment
+
+	Subtotal   int
+	Discount   int
+	Tax        int
+	Total      int
+	Paid       int
+	BalanceDue int
+}
+
+// FormatNumber возвращает номер счета в виде "2026-000001"
+func FormatNumber(year, number int) string {
+	return fmt.Sprintf("%d-%06d", year, number)
+}
+
+// Build собирает счет по бронированию: строки расчета стоимости (res.Charges) и внесенные платежи.
+// Для старых бронирований без сохраненного расчета считается только проживание по цене комнаты
+func Build(inv models.Invoice, res models.Reservation, paid []models.Payment, currency string) *Invoice {
+	i := &Invoice{
+		Number:      inv.InvoiceNumber,
+		IssuedAt:    inv.CreatedAt,
+		Currency:    currency,
+		Reservation: res,
+	}
+
+	if i.IssuedAt.IsZero() {
+		i.IssuedAt = time.Now()
+	}
+
+	charges := res.Charges
+	if len(charges) == 0 {
+		charges = pricing.Calculate(pricing.Stay{
+			Room:      res.Room,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+			Guests:    res.Guests,
+		}, nil).Items
+	}
+
+	for _, c := range charges {
+		line := Line{
+			Description: c.Description,
+			Quantity:    c.Quantity,
+			UnitPrice:   c.UnitAmount,
+			Amount:      c.Amount,
+		}
+
+		switch c.Kind {
+		case pricing.KindRoom:
+			i.Lines = append(i.Lines, line)
+		case pricing.KindDiscount:
+			i.Discounts = append(i.Discounts, line)
+		default:
+			i.Taxes = append(i.Taxes, line)
+		}
+	}
+
+	// в счет попадают только прошедшие платежи, неудачные попытки не показываются
+	for _, p := range paid {
+		if p.Status == payments.StatusCaptured || p.Status == payments.StatusRefunded {
+			i.Payments = append(i.Payments, p)
+		}
+	}
+
+	i.Calculate()
+
+	return i
+}
+
+// Calculate пересчитывает итоговые суммы счета
+func (i *Invoice) Calculate() {
+	i.Subtotal, i.Discount, i.Tax, i.Paid = 0, 0, 0, 0
+
+	for _, l := range i.Lines {
+		i.Subtotal += l.Amount
+	}
+
+	for _, l := range i.Discounts {
+		i.Discount += l.Amount
+	}
+
+	for _, l := range i.Taxes {
+		i.Tax += l.Amount
+	}
+
+	for _, p := range i.Payments {
+		i.Paid += p.Amount - p.RefundedAmount
+	}
+
+	i.Total = i.Subtotal + i.Discount + i.Tax
+	i.BalanceDue = i.Total - i.Paid
+}
+
+// FileName - имя файла счета для скачивания и вложения в письмо
+func (i *Invoice) FileName() string {
+	return FileName(i.Number)
+}
+
+// FileName возвращает имя файла счета с номером number
+func FileName(number string) string {
+	return fmt.Sprintf("invoice-%s.pdf", number)
+}
+
+// PDF формирует документ счета
+func (i *Invoice) PDF() []byte {
+	const (
+		left  = 50.0
+		right = 545.0
+	)
+
+	d := newPDF()
+	d.addPage()
+
+	d.text(left, 60, 20, true, "INVOICE")
+	d.textRight(right, 50, 11, true, SellerName)
+	d.textRight(right, 66, 10, false, fmt.Sprintf("Invoice No: %s", i.Number))
+	d.textRight(right, 80, 10, false, fmt.Sprintf("Date: %s", i.IssuedAt.Format("2006-01-02")))
+
+	res := i.Reservation
+
+	y := 120.0
+	d.text(left, y, 10, true, "Bill to")
+	d.text(left, y+15, 10, false, fmt.Sprintf("%s %s", res.FirstName, res.LastName))
+	d.text(left, y+29, 10, false, res.Email)
+	d.text(left, y+43, 10, false, res.Phone)
+
+	d.text(320, y, 10, true, "Stay")
+	d.text(320, y+15, 10, false, fmt.Sprintf("Reservation: #%d", res.ID))
+	d.text(320, y+29, 10, false, fmt.Sprintf("Arrival: %s", res.StartDate.Format("2006-01-02")))
+	d.text(320, y+43, 10, false, fmt.Sprintf("Departure: %s", res.EndDate.Format("2006-01-02")))
+
+	// при длинном списке строк вывод продолжается на новой странице
+	newline := func(step float64) {
+		y += step
+		if y > 760 {
+			d.addPage()
+			y = 60
+		}
+	}
+
+	y = 210
+	d.text(left, y, 10, true, "Description")
+	d.textRight(360, y, 10, true, "Nights")
+	d.textRight(450, y, 10, true, "Rate")
+	d.textRight(right, y, 10, true, "Amount")
+	d.line(left, right, y+6)
+	y += 22
+
+	for _, l := range i.Lines {
+		d.text(left, y, 10, false, l.Description)
+		d.textRight(360, y, 10, false, fmt.Sprintf("%d", l.Quantity))
+		d.textRight(450, y, 10, false, i.money(l.UnitPrice))
+		d.textRight(right, y, 10, false, i.money(l.Amount))
+		newline(16)
+	}
+
+	for _, l := range append(append([]Line{}, i.Discounts...), i.Taxes...) {
+		d.text(left, y, 10, false, l.Description)
+		if l.Quantity > 1 {
+			d.textRight(360, y, 10, false, fmt.Sprintf("%d", l.Quantity))
+			d.textRight(450, y, 10, false, i.money(l.UnitPrice))
+		}
+		d.textRight(right, y, 10, false, i.money(l.Amount))
+		newline(16)
+	}
+
+	d.line(320, right, y-6)
+	y += 10
+
+	totals := []struct {
+		label  string
+		amount int
+		bold   bool
+	}{
+		{"Subtotal", i.Subtotal, false},
+		{"Discounts", i.Discount, false},
+		{"Taxes and fees", i.Tax, false},
+		{"Total", i.Total, true},
+	}
+
+	for _, t := range totals {
+		if t.amount == 0 && !t.bold {
+			continue
+		}
+		d.text(320, y, 10, t.bold, t.label)
+		d.textRight(right, y, 10, t.bold, i.money(t.amount))
+		newline(16)
+	}
+
+	if len(i.Payments) > 0 {
+		newline(14)
+		d.text(left, y, 10, true, "Payments")
+		d.line(left, right, y+6)
+		y += 22
+
+		for _, p := range i.Payments {
+			d.text(left, y, 10, false, fmt.Sprintf("%s %s (%s)", p.CreatedAt.Format("2006-01-02"), p.Kind, p.Status))
+			d.textRight(right, y, 10, false, i.money(p.Amount-p.RefundedAmount))
+			newline(16)
+		}
+	}
+
+	newline(10)
+	d.text(320, y, 10, false, "Paid")
+	d.textRight(right, y, 10, false, i.money(i.Paid))
+	newline(16)
+	d.text(320, y, 11, true, "Balance due")
+	d.textRight(right, y, 11, true, i.money(i.BalanceDue))
+
+	d.text(left, 800, 8, false, "Thank you for staying with us.")
+
+	return d.bytes()
+}
+
+func (i *Invoice) money(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, i.Currency)
+}
@@ -0,0 +1,115 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func testInvoice() *Invoice {
+	res := models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith (Acme)",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters", Price: 12000},
+	}
+
+	paid := []models.Payment{
+		{Kind: "deposit", Amount: 10800, RefundedAmount: 800, Status: "captured"},
+		{Kind: "full", Amount: 36000, Status: "failed"},
+	}
+
+	return Build(models.Invoice{InvoiceNumber: FormatNumber(2050, 12)}, res, paid, "USD")
+}
+
+func TestBuild(t *testing.T) {
+	i := testInvoice()
+
+	if i.Number != "2050-000012" {
+		t.Errorf("got number %s, want 2050-000012", i.Number)
+	}
+
+	if len(i.Lines) != 1 || i.Lines[0].Quantity != 3 || i.Lines[0].Amount != 36000 {
+		t.Errorf("unexpected lines %+v", i.Lines)
+	}
+
+	// неудачный платеж в счет не попадает
+	if len(i.Payments) != 1 || i.Paid != 10000 {
+		t.Errorf("got %d payments and %d paid, want 1 and 10000", len(i.Payments), i.Paid)
+	}
+
+	i.Discounts = append(i.Discounts, Line{Description: "Promo", Amount: -1000})
+	i.Taxes = append(i.Taxes, Line{Description: "City tax", Amount: 500})
+	i.Calculate()
+
+	if i.Total != 35500 || i.BalanceDue != 25500 {
+		t.Errorf("got total %d and balance %d, want 35500 and 25500", i.Total, i.BalanceDue)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	doc := testInvoice().PDF()
+
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatal("document has no PDF header or trailer")
+	}
+
+	for _, s := range []string{"(Invoice No: 2050-000012)", "(John Smith \\(Acme\\))", "(360.00 USD)"} {
+		if !bytes.Contains(doc, []byte(s)) {
+			t.Errorf("document does not contain %s", s)
+		}
+	}
+
+	// startxref должен указывать на таблицу xref, а она - на начало каждого объекта
+	pos := bytes.LastIndex(doc, []byte("startxref\n"))
+	var xref int
+	fmt.Sscanf(string(doc[pos+len("startxref\n"):]), "%d", &xref)
+
+	if !bytes.HasPrefix(doc[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point to xref table", xref)
+	}
+
+	lines := bytes.Split(doc[xref:], []byte("\n"))
+	for n, entry := range lines[3:] {
+		if !bytes.HasSuffix(entry, []byte(" n ")) {
+			break
+		}
+
+		offset, _ := strconv.Atoi(string(entry[:10]))
+		if !bytes.HasPrefix(doc[offset:], []byte(fmt.Sprintf("%d 0 obj", n+1))) {
+			t.Errorf("xref entry %d points to wrong offset %d", n+1, offset)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if s := escape(`a(b)\ é ж`); s != `a\(b\)\\ \351 ?` {
+		t.Errorf("got %s", s)
+	}
+}
+
+func TestBuild_SavedCharges(t *testing.T) {
+	res := models.Reservation{
+		Charges: []models.ReservationCharge{
+			{Kind: "room", Description: "Accommodation", Quantity: 2, UnitAmount: 10000, Amount: 20000},
+			{Kind: "tax", Description: "Tourist tax", Quantity: 4, UnitAmount: 150, Amount: 600},
+			{Kind: "fee", Description: "Cleaning", Quantity: 1, UnitAmount: 2500, Amount: 2500},
+		},
+	}
+
+	i := Build(models.Invoice{InvoiceNumber: "2050-000001"}, res, nil, "USD")
+
+	if len(i.Lines) != 1 || len(i.Taxes) != 2 {
+		t.Fatalf("got %d lines and %d taxes, want 1 and 2", len(i.Lines), len(i.Taxes))
+	}
+
+	if i.Total != 23100 || i.BalanceDue != 23100 {
+		t.Errorf("got total %d and balance %d, want 23100", i.Total, i.BalanceDue)
+	}
+}
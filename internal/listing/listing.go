@@ -0,0 +1,191 @@
+package listing
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// PerPage - количество бронирований на странице списка
+const PerPage = 25
+
+// MaxPage - последняя страница, которую можно запросить: дальше offset в запросе переполняется
+const MaxPage = 10000
+
+// Columns - колонки, по которым можно сортировать список бронирований
+var Columns = []string{"id", "name", "room", "arrival", "departure", "created"}
+
+// Statuses - значения фильтра по статусу
+var Statuses = []string{"new", "processed", "cancelled"}
+
+const layout = "2006-01-02"
+
+// Parse читает фильтры, сортировку и страницу из query-параметров. Некорректные значения игнорируются
+func Parse(q url.Values) models.ReservationFilter {
+	f := models.ReservationFilter{
+		Search:  strings.TrimSpace(q.Get("q")),
+		Sort:    "arrival",
+		Desc:    q.Get("dir") == "desc",
+		Page:    1,
+		PerPage: PerPage,
+	}
+
+	if t, err := time.Parse(layout, q.Get("from")); err == nil {
+		f.From = t
+	}
+
+	if t, err := time.Parse(layout, q.Get("to")); err == nil {
+		f.To = t
+	}
+
+	if id, err := strconv.Atoi(q.Get("room")); err == nil && id > 0 {
+		f.RoomID = id
+	}
+
+	if contains(Statuses, q.Get("status")) {
+		f.Status = q.Get("status")
+	}
+
+	if contains(Columns, q.Get("sort")) {
+		f.Sort = q.Get("sort")
+	}
+
+	if p, err := strconv.Atoi(q.Get("page")); err == nil && p > 0 {
+		f.Page = min(p, MaxPage)
+	}
+
+	return f
+}
+
+// Values переводит фильтр обратно в query-параметры, значения по умолчанию не записываются
+func Values(f models.ReservationFilter) url.Values {
+	q := url.Values{}
+
+	if !f.From.IsZero() {
+		q.Set("from", f.From.Format(layout))
+	}
+
+	if !f.To.IsZero() {
+		q.Set("to", f.To.Format(layout))
+	}
+
+	if f.RoomID > 0 {
+		q.Set("room", strconv.Itoa(f.RoomID))
+	}
+
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+
+	if f.Search != "" {
+		q.Set("q", f.Search)
+	}
+
+	if f.Sort != "" && f.Sort != "arrival" {
+		q.Set("sort", f.Sort)
+	}
+
+	if f.Desc {
+		q.Set("dir", "desc")
+	}
+
+	if f.Page > 1 {
+		q.Set("page", strconv.Itoa(f.Page))
+	}
+
+	return q
+}
+
+// List - состояние списка для шаблона: текущий фильтр, общее количество и адрес страницы списка
+type List struct {
+	Path   string
+	Filter models.ReservationFilter
+	Total  int
+}
+
+// Pages возвращает количество страниц
+func (l List) Pages() int {
+	perPage := l.Filter.PerPage
+	if perPage < 1 {
+		perPage = PerPage
+	}
+
+	pages := (l.Total + perPage - 1) / perPage
+	if pages < 1 {
+		pages = 1
+	}
+
+	return pages
+}
+
+// PageNumbers возвращает номера страниц для пагинации: не больше двух страниц по обе стороны от текущей
+func (l List) PageNumbers() []int {
+	var numbers []int
+
+	for p := l.Filter.Page - 2; p <= l.Filter.Page+2; p++ {
+		if p >= 1 && p <= l.Pages() {
+			numbers = append(numbers, p)
+		}
+	}
+
+	return numbers
+}
+
+// PageURL возвращает ссылку на страницу page с теми же фильтрами и сортировкой
+func (l List) PageURL(page int) string {
+	f := l.Filter
+	f.Page = page
+
+	return l.url(f)
+}
+
+// SortURL возвращает ссылку для заголовка колонки: сортировка по колонке, повторный клик меняет направление.
+// При смене сортировки список открывается с первой страницы
+func (l List) SortURL(column string) string {
+	f := l.Filter
+	f.Desc = f.Sort == column && !f.Desc
+	f.Sort = column
+	f.Page = 1
+
+	return l.url(f)
+}
+
+// SortIndicator возвращает стрелку для колонки, по которой сейчас отсортирован список
+func (l List) SortIndicator(column string) string {
+	if l.Filter.Sort != column {
+		return ""
+	}
+
+	if l.Filter.Desc {
+		return "▼"
+	}
+
+	return "▲"
+}
+
+// Query возвращает текущие параметры списка, например для ссылки "назад к списку"
+func (l List) Query() string {
+	return Values(l.Filter).Encode()
+}
+
+func (l List) url(f models.ReservationFilter) string {
+	q := Values(f).Encode()
+	if q == "" {
+		return l.Path
+	}
+
+	return l.Path + "?" + q
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package listing
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	q, _ := url.ParseQuery("q=+smith+&from=2050-01-01&to=bad&room=2&status=cancelled&sort=name&dir=desc&page=3")
+
+	f := Parse(q)
+
+	want := models.ReservationFilter{
+		From:    time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		RoomID:  2,
+		Status:  "cancelled",
+		Search:  "smith",
+		Sort:    "name",
+		Desc:    true,
+		Page:    3,
+		PerPage: PerPage,
+	}
+
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("got %+v, want %+v", f, want)
+	}
+
+	// неизвестные значения заменяются значениями по умолчанию
+	q, _ = url.ParseQuery("status=deleted&sort=password&page=-1")
+	f = Parse(q)
+
+	if f.Status != "" || f.Sort != "arrival" || f.Page != 1 {
+		t.Errorf("unexpected defaults %+v", f)
+	}
+
+	q, _ = url.ParseQuery("page=9223372036854775807")
+	if f = Parse(q); f.Page != MaxPage {
+		t.Errorf("got page %d, want %d", f.Page, MaxPage)
+	}
+}
+
+func TestValues(t *testing.T) {
+	q, _ := url.ParseQuery("q=smith&room=2&sort=name&dir=desc&page=3")
+
+	if got := Values(Parse(q)).Encode(); got != "dir=desc&page=3&q=smith&room=2&sort=name" {
+		t.Errorf("got %s", got)
+	}
+
+	if got := Values(Parse(url.Values{})).Encode(); got != "" {
+		t.Errorf("default filter should not produce parameters, got %s", got)
+	}
+}
+
+func TestList(t *testing.T) {
+	q, _ := url.ParseQuery("q=smith&sort=name&page=4")
+
+	l := List{Path: "/admin/reservations-all", Filter: Parse(q), Total: 101}
+
+	if l.Pages() != 5 {
+		t.Errorf("got %d pages, want 5", l.Pages())
+	}
+
+	if !reflect.DeepEqual(l.PageNumbers(), []int{2, 3, 4, 5}) {
+		t.Errorf("got page numbers %v", l.PageNumbers())
+	}
+
+	if got := l.PageURL(5); got != "/admin/reservations-all?page=5&q=smith&sort=name" {
+		t.Errorf("got page url %s", got)
+	}
+
+	// повторная сортировка по той же колонке меняет направление и сбрасывает страницу
+	if got := l.SortURL("name"); got != "/admin/reservations-all?dir=desc&q=smith&sort=name" {
+		t.Errorf("got sort url %s", got)
+	}
+
+	if got := l.SortURL("arrival"); got != "/admin/reservations-all?q=smith" {
+		t.Errorf("got sort url %s", got)
+	}
+
+	if l.SortIndicator("name") != "▲" || l.SortIndicator("room") != "" {
+		t.Error("unexpected sort indicator")
+	}
+
+	if (List{}).Pages() != 1 {
+		t.Error("empty list should have one page")
+	}
+}
@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader - заголовок с ID запроса: входящий используется, если он есть (например, от балансировщика),
+// и в любом случае возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+// New создает логгер, который пишет записи в формате JSON
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+type ctxKey struct{}
+
+// NewContext возвращает контекст с логгером запроса
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext возвращает логгер запроса, а вне запроса - логгер по умолчанию
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+
+	return slog.Default()
+}
+
+// NewRequestID возвращает случайный ID запроса
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// requestID берет ID из заголовка запроса, если он разумной длины и из безопасных символов, иначе создает новый
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 64 {
+		return NewRequestID()
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return NewRequestID()
+		}
+	}
+
+	return id
+}
+
+// StatusRecorder запоминает код ответа. Им пользуются и лог запросов, и метрики
+type StatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// NewStatusRecorder оборачивает w, чтобы после ответа узнать его код
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+func (s *StatusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status возвращает код ответа: 200, если обработчик ничего не записал
+func (s *StatusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// Observe выполняет next и после ответа вызывает done с кодом ответа и длительностью запроса.
+// Если обработчик запаниковал, done получает 500, а паника уходит дальше - ее обрабатывает Recoverer
+func Observe(w http.ResponseWriter, r *http.Request, next http.Handler, done func(status int, d time.Duration)) {
+	rec := NewStatusRecorder(w)
+	start := time.Now()
+
+	defer func() {
+		p := recover()
+
+		status := rec.Status()
+		if p != nil {
+			status = http.StatusInternalServerError
+		}
+
+		done(status, time.Since(start))
+
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+}
+
+// Middleware назначает запросу ID, кладет в контекст логгер с этим ID и после ответа пишет метод, путь, код ответа,
+// длительность и ID пользователя (userID вызывается после обработчика, так что вход в систему попадает в лог того же запроса)
+func Middleware(logger *slog.Logger, userID func(r *http.Request) int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := requestID(r)
+			w.Header().Set(RequestIDHeader, id)
+
+			reqLogger := logger.With("request_id", id)
+			r = r.WithContext(NewContext(r.Context(), reqLogger))
+
+			Observe(w, r, next, func(status int, d time.Duration) {
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+
+				reqLogger.LogAttrs(r.Context(), level, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int64("duration_ms", d.Milliseconds()),
+					slog.Int("user_id", userID(r)),
+				)
+			})
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	var handlerLogger *slog.Logger
+
+	h := Middleware(logger, func(r *http.Request) int { return 7 })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerLogger = FromContext(r.Context())
+		handlerLogger.Info("inside")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest("GET", "/admin/dashboard?x=1", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("got request id %q", rr.Header().Get(RequestIDHeader))
+	}
+
+	if handlerLogger == nil || handlerLogger == slog.Default() {
+		t.Fatal("handler did not get the request logger")
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+
+	var inside, request map[string]interface{}
+	_ = json.Unmarshal(lines[0], &inside)
+	_ = json.Unmarshal(lines[1], &request)
+
+	if inside["request_id"] != "abc-123" {
+		t.Errorf("handler log has no request id: %v", inside)
+	}
+
+	if request["msg"] != "request" || request["method"] != "GET" || request["path"] != "/admin/dashboard" ||
+		request["status"] != float64(http.StatusTeapot) || request["user_id"] != float64(7) || request["duration_ms"] == nil {
+		t.Errorf("unexpected request log %v", request)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	var tests = []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		panics  bool
+	}{
+		{"nothing-written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK, false},
+		{"body-only", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) }, http.StatusOK, false},
+		{"not-found", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }, http.StatusNotFound, false},
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, http.StatusInternalServerError, true},
+	}
+
+	for _, e := range tests {
+		got := 0
+
+		func() {
+			defer func() {
+				if p := recover(); (p != nil) != e.panics {
+					t.Errorf("failed %s: got panic %v", e.name, p)
+				}
+			}()
+
+			Observe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), e.handler,
+				func(status int, d time.Duration) { got = status })
+		}()
+
+		if got != e.status {
+			t.Errorf("failed %s: got status %d, want %d", e.name, got, e.status)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	if id := requestID(req); id == "bad id\n" || len(id) != 16 {
+		t.Errorf("got %q", id)
+	}
+
+	req.Header.Del(RequestIDHeader)
+	if requestID(req) == requestID(req) {
+		t.Error("request ids are not unique")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(httptest.NewRequest("GET", "/", nil).Context()) != slog.Default() {
+		t.Error("expected default logger outside of a request")
+	}
+}
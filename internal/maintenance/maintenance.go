@@ -0,0 +1,101 @@
+package maintenance
+
+import (
+	"errors"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Приоритеты заявок
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// Priorities - приоритеты по возрастанию, для формы заявки
+var Priorities = []string{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+
+// Состояния заявки
+const (
+	StatusOpen       = "open"
+	StatusInProgress = "in_progress"
+	StatusClosed     = "closed"
+)
+
+// Statuses - все состояния, для формы и фильтра
+var Statuses = []string{StatusOpen, StatusInProgress, StatusClosed}
+
+// ErrResolutionRequired - комнату нельзя закрыть без даты, когда ее починят
+var ErrResolutionRequired = errors.New("an out of order room needs an expected resolution date after the start date")
+
+// IsOpen сообщает, что заявка еще не закрыта
+func IsOpen(t models.MaintenanceTicket) bool {
+	return t.Status != StatusClosed
+}
+
+// Validate проверяет приоритет, состояние и то, что у закрытой на ремонт комнаты есть срок
+func Validate(t models.MaintenanceTicket) error {
+	if !contains(Priorities, t.Priority) {
+		return errors.New("unknown priority")
+	}
+
+	if !contains(Statuses, t.Status) {
+		return errors.New("unknown status")
+	}
+
+	if t.OutOfOrder && IsOpen(t) && !t.ExpectedResolution.After(t.StartDate) {
+		return ErrResolutionRequired
+	}
+
+	return nil
+}
+
+// Block возвращает блокировку комнаты, которую держит заявка. ok == false - заявка комнату не закрывает:
+// она закрыта или комната работает
+func Block(t models.MaintenanceTicket) (rr models.RoomRestriction, ok bool) {
+	if !t.OutOfOrder || !IsOpen(t) || !t.ExpectedResolution.After(t.StartDate) {
+		return rr, false
+	}
+
+	return models.RoomRestriction{
+		RoomID:              t.RoomID,
+		StartDate:           day(t.StartDate),
+		EndDate:             day(t.ExpectedResolution),
+		RestrictionID:       2,
+		MaintenanceTicketID: t.ID,
+	}, true
+}
+
+// Days возвращает дни, закрытые заявками, в виде "2006-01-02" -> ID заявки, для ссылок из календаря
+func Days(restrictions []models.RoomRestriction) map[string]int {
+	days := make(map[string]int)
+
+	for _, rr := range restrictions {
+		if rr.MaintenanceTicketID == 0 {
+			continue
+		}
+
+		for d := rr.StartDate; d.Before(rr.EndDate); d = d.AddDate(0, 0, 1) {
+			days[d.Format("2006-01-02")] = rr.MaintenanceTicketID
+		}
+	}
+
+	return days
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var ticket = models.MaintenanceTicket{
+	ID:                 3,
+	RoomID:             1,
+	Priority:           PriorityUrgent,
+	Status:             StatusOpen,
+	OutOfOrder:         true,
+	StartDate:          date(2050, 1, 10),
+	ExpectedResolution: date(2050, 1, 13),
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(ticket); err != nil {
+		t.Error(err)
+	}
+
+	noDate := ticket
+	noDate.ExpectedResolution = time.Time{}
+	if err := Validate(noDate); err != ErrResolutionRequired {
+		t.Errorf("got %v", err)
+	}
+
+	// закрытой заявке срок не нужен
+	noDate.Status = StatusClosed
+	if err := Validate(noDate); err != nil {
+		t.Error(err)
+	}
+
+	bad := ticket
+	bad.Priority = "whenever"
+	if err := Validate(bad); err == nil {
+		t.Error("expected priority error")
+	}
+}
+
+func TestBlock(t *testing.T) {
+	rr, ok := Block(ticket)
+	if !ok || rr.RoomID != 1 || rr.MaintenanceTicketID != 3 || !rr.StartDate.Equal(ticket.StartDate) ||
+		!rr.EndDate.Equal(ticket.ExpectedResolution) || rr.RestrictionID != 2 {
+		t.Errorf("unexpected block %+v %v", rr, ok)
+	}
+
+	closed := ticket
+	closed.Status = StatusClosed
+	if _, ok := Block(closed); ok {
+		t.Error("closed ticket blocks the room")
+	}
+
+	working := ticket
+	working.OutOfOrder = false
+	if _, ok := Block(working); ok {
+		t.Error("ticket without out of order blocks the room")
+	}
+}
+
+func TestDays(t *testing.T) {
+	rr, _ := Block(ticket)
+
+	days := Days([]models.RoomRestriction{rr, {ID: 9, RoomID: 1, StartDate: date(2050, 1, 20), EndDate: date(2050, 1, 21), RestrictionID: 2}})
+
+	if len(days) != 3 || days["2050-01-10"] != 3 || days["2050-01-12"] != 3 {
+		t.Errorf("unexpected days %v", days)
+	}
+}
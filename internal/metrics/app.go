@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// App - метрики приложения, которые отдаются на /metrics
+type App struct {
+	Registry *Registry
+
+	// Requests и RequestDuration - запросы по шаблону маршрута chi (а не по пути, чтобы id не плодили ряды)
+	Requests        *Counter
+	RequestDuration *Histogram
+
+	// MailSent и MailFailures - результаты отправки писем воркером, причина ошибки: connect или send
+	MailSent     *Counter
+	MailFailures *Counter
+
+	// ReservationsCreated - созданные бронирования по источнику, AvailabilitySearches - поиски свободных дат по виду поиска
+	ReservationsCreated  *Counter
+	AvailabilitySearches *Counter
+}
+
+// New создает реестр и регистрирует в нем метрики приложения
+func New() *App {
+	r := NewRegistry()
+
+	return &App{
+		Registry: r,
+		Requests: r.Counter("http_requests_total",
+			"HTTP requests by method, route pattern and status code.", "method", "route", "status"),
+		RequestDuration: r.Histogram("http_request_duration_seconds",
+			"HTTP request latency by method and route pattern.", DefaultBuckets, "method", "route"),
+		MailSent: r.Counter("mail_sent_total",
+			"Emails sent by the mail worker."),
+		MailFailures: r.Counter("mail_failures_total",
+			"Emails the mail worker failed to send, by reason.", "reason"),
+		ReservationsCreated: r.Counter("reservations_created_total",
+			"Reservations created, by source.", "source"),
+		AvailabilitySearches: r.Counter("availability_searches_total",
+			"Availability searches, by kind of search.", "kind"),
+	}
+}
+
+// DBStats регистрирует метрики пула соединений, значения берутся из stats в момент сбора
+func (a *App) DBStats(stats func() sql.DBStats) {
+	gauge := func(name, help string, f func(s sql.DBStats) float64) {
+		a.Registry.GaugeFunc(name, help, func() float64 { return f(stats()) })
+	}
+	counter := func(name, help string, f func(s sql.DBStats) float64) {
+		a.Registry.CounterFunc(name, help, func() float64 { return f(stats()) })
+	}
+
+	gauge("db_max_open_connections", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_open_connections", "Established connections, both in use and idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_in_use_connections", "Connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_idle_connections", "Idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_wait_count_total", "Connections waited for.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_wait_duration_seconds_total", "Time blocked waiting for a new connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
+
+// MailQueue регистрирует размер очереди писем, которые ждут отправки
+func (a *App) MailQueue(depth func() int) {
+	a.Registry.GaugeFunc("mail_queue_depth", "Emails waiting in the mail worker queue.",
+		func() float64 { return float64(depth()) })
+}
+
+// Middleware считает запросы и их длительность. Шаблон маршрута известен только после того,
+// как chi выбрал обработчик, поэтому он читается после ответа; запросы мимо маршрутов идут в route="unmatched"
+func (a *App) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.Observe(w, r, next, func(status int, d time.Duration) {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			a.Requests.Inc(r.Method, route, strconv.Itoa(status))
+			a.RequestDuration.Observe(d.Seconds(), r.Method, route)
+		})
+	})
+}
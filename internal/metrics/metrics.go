@@ -0,0 +1,320 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType - тип ответа в текстовом формате Prometheus
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets - границы гистограммы длительности запросов в секундах
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric - одна метрика со всеми ее рядами
+type metric interface {
+	header() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Registry хранит метрики и отдает их в текстовом формате Prometheus
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry создает пустой реестр
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(m metric) {
+	name, _, _ := m.header()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// Counter регистрирует счетчик с перечисленными метками
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]*series)}
+	r.register(c)
+	return c
+}
+
+// Histogram регистрирует гистограмму с заданными границами корзин
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histSeries)}
+	r.register(h)
+	return h
+}
+
+// GaugeFunc регистрирует значение, которое вычисляется в момент сбора (размер очереди, соединения пула)
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "gauge", f: f})
+}
+
+// CounterFunc регистрирует счетчик, который ведется вне реестра (например, в sql.DBStats)
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "counter", f: f})
+}
+
+// Write пишет все метрики, отсортированные по имени
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	names := sortedKeys(r.metrics)
+	list := make([]metric, len(names))
+	for i, name := range names {
+		list[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range list {
+		name, help, kind := m.header()
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, kind)
+		m.write(bw)
+	}
+	bw.Flush()
+}
+
+// ServeHTTP отдает метрики по запросу сборщика
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// series - один ряд счетчика (набор значений меток)
+type series struct {
+	labels []string
+	value  float64
+}
+
+// Counter - монотонно растущий счетчик
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+// Inc увеличивает ряд с указанными значениями меток на единицу
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает ряд на v; отрицательные значения игнорируются, счетчик не убывает
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := seriesKey(c.name, c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.values[key]
+	if !ok {
+		s = &series{labels: append([]string{}, labelValues...)}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+// Value возвращает текущее значение ряда
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := seriesKey(c.name, c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.values[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) header() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labels), formatValue(s.value))
+	}
+}
+
+// histSeries - один ряд гистограммы: счетчики по корзинам (не накопительные), сумма и количество
+type histSeries struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram - распределение значений (например, длительности запросов) по корзинам
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histSeries
+}
+
+// Observe добавляет значение в ряд с указанными значениями меток
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := seriesKey(h.name, h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.values[key]
+	if !ok {
+		s = &histSeries{labels: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+
+	// значение попадает в первую корзину, верхняя граница которой не меньше него
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Count возвращает количество наблюдений в ряду
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := seriesKey(h.name, h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.values[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) header() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+
+	for _, key := range sortedKeys(h.values) {
+		s := h.values[key]
+
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			values := append(append([]string{}, s.labels...), formatValue(le))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), cumulative)
+		}
+		values := append(append([]string{}, s.labels...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), s.count)
+
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labels), s.count)
+	}
+}
+
+// funcMetric - метрика без меток, значение которой берется из функции при сборе
+type funcMetric struct {
+	name string
+	help string
+	kind string
+	f    func() float64
+}
+
+func (m *funcMetric) header() (string, string, string) {
+	return m.name, m.help, m.kind
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", m.name, formatValue(m.f()))
+}
+
+// seriesKey проверяет количество значений меток и склеивает их в ключ ряда
+func seriesKey(name string, labels, values []string) string {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", name, len(labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("b_total", "Counter with labels.", "kind")
+	c.Inc("x")
+	c.Add(2, "x")
+	c.Inc(`a"b`)
+	c.Add(-5, "x")
+
+	h := r.Histogram("a_seconds", "Histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/")
+	h.Observe(0.5, "/")
+	h.Observe(3, "/")
+
+	r.GaugeFunc("c_depth", "Gauge\nwith newline.", func() float64 { return 4 })
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	want := `# HELP a_seconds Histogram.
+# TYPE a_seconds histogram
+a_seconds_bucket{route="/",le="0.1"} 1
+a_seconds_bucket{route="/",le="1"} 2
+a_seconds_bucket{route="/",le="+Inf"} 3
+a_seconds_sum{route="/"} 3.55
+a_seconds_count{route="/"} 3
+# HELP b_total Counter with labels.
+# TYPE b_total counter
+b_total{kind="a\"b"} 1
+b_total{kind="x"} 3
+# HELP c_depth Gauge\nwith newline.
+# TYPE c_depth gauge
+c_depth 4
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	if c.Value("x") != 3 || h.Count("/") != 3 || h.Count("/missing") != 0 {
+		t.Errorf("got counter %v and histogram count %d", c.Value("x"), h.Count("/"))
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(r *Registry)
+	}{
+		{"duplicate", func(r *Registry) {
+			r.Counter("x_total", "x")
+			r.Counter("x_total", "x")
+		}},
+		{"label-count", func(r *Registry) {
+			r.Counter("x_total", "x", "a", "b").Inc("only-one")
+		}},
+	}
+
+	for _, e := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", e.name)
+				}
+			}()
+			e.f(NewRegistry())
+		}()
+	}
+}
+
+func TestApp_Middleware(t *testing.T) {
+	a := New()
+
+	mux := chi.NewRouter()
+	mux.Use(a.Middleware)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Post("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/rooms/1", "/rooms/2"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/fail", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+
+	if v := a.Requests.Value("GET", "/rooms/{id}", "200"); v != 2 {
+		t.Errorf("got %v requests for /rooms/{id}, want 2", v)
+	}
+
+	if v := a.Requests.Value("POST", "/fail", "500"); v != 1 {
+		t.Errorf("got %v failed requests, want 1", v)
+	}
+
+	if v := a.Requests.Value("GET", "unmatched", "404"); v != 1 {
+		t.Errorf("got %v unmatched requests, want 1", v)
+	}
+
+	if n := a.RequestDuration.Count("GET", "/rooms/{id}"); n != 2 {
+		t.Errorf("got %d latency observations, want 2", n)
+	}
+}
+
+func TestApp_Handler(t *testing.T) {
+	a := New()
+	a.DBStats(func() sql.DBStats { return sql.DBStats{MaxOpenConnections: 10, InUse: 3} })
+	a.MailQueue(func() int { return 2 })
+	a.ReservationsCreated.Inc("website")
+	a.MailFailures.Inc("send")
+
+	rr := httptest.NewRecorder()
+	a.Registry.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Header().Get("Content-Type") != ContentType {
+		t.Errorf("got content type %q", rr.Header().Get("Content-Type"))
+	}
+
+	body := rr.Body.String()
+	for _, line := range []string{
+		"db_max_open_connections 10",
+		"db_in_use_connections 3",
+		"mail_queue_depth 2",
+		`reservations_created_total{source="website"} 1`,
+		`mail_failures_total{reason="send"} 1`,
+		"# TYPE db_wait_count_total counter",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics output has no %q", line)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table - таблица с версиями примененных миграций
+const Table = "schema_migrations"
+
+// sodaTable - таблица версий soda, которым раньше применялись миграции: при первом запуске
+// уже примененные через soda версии переносятся в Table, чтобы не выполнять их повторно
+const sodaTable = "schema_migration"
+
+// lockKey - ключ advisory lock: пока одна копия приложения применяет миграции, остальные ждут
+const lockKey int64 = 20250409095533
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration - одна миграция: SQL для применения и отката
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - миграция и время ее применения (нулевое, если миграция еще не применена)
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Load читает миграции из fsys и сортирует по версии. У каждой версии должны быть оба файла, up и down
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	seen := make(map[string]bool)
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		parts := fileName.FindStringSubmatch(e.Name())
+		if parts == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version: %w", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, m.Name, parts[2])
+		}
+
+		key := parts[1] + "." + parts[3]
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate %s migration for version %d", parts[3], version)
+		}
+		seen[key] = true
+
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for v, m := range byVersion {
+		if !seen[strconv.FormatInt(v, 10)+".up"] || !seen[strconv.FormatInt(v, 10)+".down"] {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", v, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Pending возвращает миграции, которые еще не применены, в порядке применения
+func Pending(migrations []Migration, applied map[int64]time.Time) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// ToRevert возвращает steps последних примененных миграций в порядке отката.
+// Примененная версия, которой нет среди файлов, - ошибка: откатить ее нечем
+func ToRevert(migrations []Migration, applied map[int64]time.Time, steps int) ([]Migration, error) {
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	if steps > len(versions) {
+		steps = len(versions)
+	}
+
+	revert := make([]Migration, 0, steps)
+	for _, v := range versions[:steps] {
+		m, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %d has no files to revert it", v)
+		}
+		revert = append(revert, m)
+	}
+
+	return revert, nil
+}
+
+// Migrator применяет и откатывает миграции в БД
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New создает Migrator для списка миграций, обычно полученного через Load
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up применяет все непримененные миграции, каждую в своей транзакции, и возвращает примененные
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range Pending(m.migrations, applied) {
+			err := inTx(ctx, conn, mig.Up, `insert into `+Table+` (version, name, applied_at) values ($1, $2, $3)`,
+				mig.Version, mig.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down откатывает steps последних примененных миграций и возвращает откаченные
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		revert, err := ToRevert(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range revert {
+			err := inTx(ctx, conn, mig.Down, `delete from `+Table+` where version = $1`, mig.Version)
+			if err != nil {
+				return fmt.Errorf("revert %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status возвращает все миграции с временем применения
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			statuses = append(statuses, Status{Migration: mig, AppliedAt: applied[mig.Version]})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock берет advisory lock на отдельном соединении (блокировка живет, пока живет соединение),
+// создает таблицу версий и выполняет f
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("cannot lock migrations: %w", err)
+	}
+	defer func() {
+		// снимаем блокировку, даже если ctx уже отменен
+		_, unlockErr := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, lockKey)
+		if err == nil && unlockErr != nil {
+			err = fmt.Errorf("cannot unlock migrations: %w", unlockErr)
+		}
+	}()
+
+	if err = ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// ensureTable создает таблицу версий, а если она пустая - переносит в нее версии из таблицы soda
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `create table if not exists `+Table+` (
+		version bigint primary key,
+		name varchar(255) not null default '',
+		applied_at timestamp not null default now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %w", Table, err)
+	}
+
+	var count int
+	if err := conn.QueryRowContext(ctx, `select count(*) from `+Table).Scan(&count); err != nil {
+		return err
+	}
+
+	var soda sql.NullString
+	if err := conn.QueryRowContext(ctx, `select to_regclass($1)::text`, sodaTable).Scan(&soda); err != nil {
+		return err
+	}
+
+	if count > 0 || !soda.Valid {
+		return nil
+	}
+
+	_, err = conn.ExecContext(ctx, `insert into `+Table+` (version, name, applied_at)
+		select version::bigint, '', now() from `+sodaTable+` on conflict do nothing`)
+	if err != nil {
+		return fmt.Errorf("cannot import versions from %s: %w", sodaTable, err)
+	}
+
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from `+Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// inTx выполняет SQL миграции и запись в таблицу версий в одной транзакции: при ошибке не остается
+// ни частично примененной схемы, ни версии без схемы
+func inTx(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// без аргументов драйвер отправляет запрос простым протоколом, поэтому в файле может быть несколько команд;
+	// пустой файл (например, откат, которому нечего делать) только меняет версию
+	if strings.TrimSpace(migration) != "" {
+		if _, err := tx.ExecContext(ctx, migration); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
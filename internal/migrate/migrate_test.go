@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"github.com/krasnov23/guest-house-golang/migrations"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20_add_b.up.sql":      file("alter table a add column b integer;"),
+		"20_add_b.down.sql":    file("alter table a drop column b;"),
+		"10_create_a.up.sql":   file("create table a (id serial primary key);"),
+		"10_create_a.down.sql": file("drop table a;"),
+		"readme.md":            file("not a migration"),
+	}
+
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].Version != 10 || list[1].Version != 20 {
+		t.Fatalf("got %+v, want versions 10 and 20 in order", list)
+	}
+
+	if list[0].Name != "create_a" || list[0].Down != "drop table a;" || !strings.HasPrefix(list[1].Up, "alter table a add") {
+		t.Errorf("unexpected migration %+v", list[0])
+	}
+
+	bad := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"no-down", fstest.MapFS{"10_a.up.sql": file("select 1")}},
+		{"no-up", fstest.MapFS{"10_a.down.sql": file("select 1")}},
+		{"same-version", fstest.MapFS{
+			"10_a.up.sql": file(""), "10_a.down.sql": file(""),
+			"10_b.up.sql": file(""), "10_b.down.sql": file(""),
+		}},
+	}
+
+	for _, e := range bad {
+		if _, err := Load(e.fsys); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestPendingAndToRevert(t *testing.T) {
+	list := []Migration{{Version: 10}, {Version: 20}, {Version: 30}}
+	applied := map[int64]time.Time{10: time.Now(), 20: time.Now()}
+
+	pending := Pending(list, applied)
+	if len(pending) != 1 || pending[0].Version != 30 {
+		t.Errorf("got pending %+v, want 30", pending)
+	}
+
+	revert, err := ToRevert(list, applied, 1)
+	if err != nil || len(revert) != 1 || revert[0].Version != 20 {
+		t.Errorf("got %+v, %v, want 20", revert, err)
+	}
+
+	revert, err = ToRevert(list, applied, 5)
+	if err != nil || len(revert) != 2 || revert[0].Version != 20 || revert[1].Version != 10 {
+		t.Errorf("got %+v, %v, want 20 then 10", revert, err)
+	}
+
+	// версия применена, но файла для нее нет - откатывать нечем
+	applied[40] = time.Now()
+	if _, err := ToRevert(list, applied, 1); err == nil {
+		t.Error("expected an error for an unknown applied version")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for _, m := range list {
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %d_%s has an empty up file", m.Version, m.Name)
+		}
+	}
+}
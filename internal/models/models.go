@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log/slog"
 	"time"
 )
 
@@ -11,17 +12,28 @@ type User struct {
 	Email       string
 	Password    string
 	AccessLevel int
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// Role - admin или housekeeping (горничные, которым назначается уборка)
+	Role      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type Room struct {
-	ID        int
-	RoomName  string
+	ID       int
+	RoomName string
+	// Price - цена за ночь в копейках (центах), 0 - цена не задана
+	Price     int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// DayAvailability - доступность комнаты на одну ночь для календаря бронирования
+type DayAvailability struct {
+	Date      time.Time
+	Available bool
+	Price     int
+}
+
 type Restriction struct {
 	ID              int
 	RestrictionName string
@@ -41,7 +53,43 @@ type Reservation struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Processed int
-	Room      Room
+	// Guests - количество гостей, нужно для сборов за человека
+	Guests int
+	// PromoCodeID - примененный промокод, 0 - без промокода
+	PromoCodeID int
+	// Source - откуда пришло бронирование (сайт, телефон и т.д.), Nationality - гражданство гостя для отчетов
+	Source      string
+	Nationality string
+	// CancelledAt - время отмены, нулевое у действующих бронирований
+	CancelledAt time.Time
+	// CheckedInAt, CheckedOutAt - фактическое время заезда и выезда, NoShowAt - когда гость отмечен как не приехавший
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	NoShowAt     time.Time
+	// IDDocumentType, IDDocumentNumber - документ, предъявленный при заезде
+	IDDocumentType   string
+	IDDocumentNumber string
+	Room             Room
+	// Charges - строки расчета стоимости, сохраненные при бронировании
+	Charges []ReservationCharge
+}
+
+// ReservationFilter - фильтры, сортировка и страница для списков бронирований в админке.
+// Нулевые значения полей означают "без фильтра"
+type ReservationFilter struct {
+	// From, To - бронирования, проживание по которым пересекается с периодом (To включительно)
+	From   time.Time
+	To     time.Time
+	RoomID int
+	// Status - new, processed или cancelled
+	Status string
+	// Search - часть имени, фамилии, email или телефона гостя
+	Search string
+	// Sort - колонка сортировки (id, name, room, arrival, departure, created), Desc - по убыванию
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
 }
 
 type RoomRestriction struct {
@@ -51,11 +99,150 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	// MaintenanceTicketID - заявка на ремонт, из-за которой комната закрыта, 0 - обычная блокировка
+	MaintenanceTicketID int
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Room                Room
+	Reservation         Reservation
+	Restriction         Restriction
+}
+
+// StayRule - правило проживания для комнаты (RoomID = 0 - для всех комнат).
+// Если SeasonStart/SeasonEnd не заданы, правило действует круглый год.
+// ArrivalDays и DepartureDays - битовые маски дней недели (бит 0 - воскресенье), 0 - любой день.
+// Нулевые MaxNights, MinLeadDays и MaxAdvanceDays означают отсутствие ограничения.
+type StayRule struct {
+	ID             int
+	RuleName       string
+	RoomID         int
+	SeasonStart    time.Time
+	SeasonEnd      time.Time
+	MinNights      int
+	MaxNights      int
+	ArrivalDays    int
+	DepartureDays  int
+	MinLeadDays    int
+	MaxAdvanceDays int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Room           Room
+}
+
+// TaxRule - налог или сбор, начисляемый на проживание.
+// Calculation "percent" - Amount в сотых долях процента (2000 = 20%) от стоимости ночей, "fixed" - Amount в копейках (центах)
+// за каждую единицу Per: "stay" - за проживание, "night" - за ночь, "guest" - за гостя, "guest_night" - за гостя в ночь.
+// Если ValidFrom/ValidTo не заданы, правило действует без ограничения по датам
+type TaxRule struct {
+	ID          int
+	Name        string
+	Kind        string
+	Calculation string
+	Amount      int
+	Per         string
+	ValidFrom   time.Time
+	ValidTo     time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ReservationCharge - строка расчета стоимости бронирования: проживание, налог, сбор или скидка. Суммы в копейках (центах)
+type ReservationCharge struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	Description   string
+	Quantity      int
+	UnitAmount    int
+	Amount        int
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	Room          Room
-	Reservation   Reservation
-	Restriction   Restriction
+}
+
+// PromoCode - промокод на скидку. Calculation "percent" - Amount в сотых долях процента, "fixed" - в копейках (центах).
+// ValidFrom/ValidTo ограничивают дату бронирования (включительно), StayFrom/StayTo - даты проживания:
+// заезд не раньше StayFrom, выезд не позже StayTo. Нулевые даты, RoomID и MaxUses - без ограничения.
+// Uses - количество бронирований с этим кодом, заполняется при выборке списка
+type PromoCode struct {
+	ID           int
+	Code         string
+	Description  string
+	Calculation  string
+	Amount       int
+	ValidFrom    time.Time
+	ValidTo      time.Time
+	StayFrom     time.Time
+	StayTo       time.Time
+	RoomID       int
+	MaxUses      int
+	OncePerGuest bool
+	Active       bool
+	Uses         int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Room         Room
+}
+
+// PromoCodeUse - бронирование, сделанное с промокодом, для отчета об использовании
+type PromoCodeUse struct {
+	ReservationID int
+	FirstName     string
+	LastName      string
+	Email         string
+	StartDate     time.Time
+	EndDate       time.Time
+	RoomName      string
+	Discount      int
+	CreatedAt     time.Time
+}
+
+// WaitlistEntry - заявка гостя в лист ожидания на даты, когда свободных комнат не было.
+// RoomID = 0 - подойдет любая комната, NotifiedAt заполняется после отправки письма о свободных датах
+type WaitlistEntry struct {
+	ID         int
+	Name       string
+	Email      string
+	StartDate  time.Time
+	EndDate    time.Time
+	RoomID     int
+	NotifiedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room
+}
+
+// ReportReservation - бронирование для отчетов вместе с выручкой за проживание (ночи за вычетом скидок, без налогов)
+type ReportReservation struct {
+	Reservation Reservation
+	Revenue     int
+}
+
+// Invoice - счет по бронированию. Номера идут подряд в пределах года, InvoiceNumber - номер в виде "2026-000001"
+type Invoice struct {
+	ID            int
+	ReservationID int
+	Year          int
+	Number        int
+	InvoiceNumber string
+	// Document - PDF счета в том виде, в каком его получил гость; пустой, если документ еще не сохранен
+	Document  []byte
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Payment - оплата (депозит или предоплата) по бронированию. Суммы - в копейках (центах)
+type Payment struct {
+	ID             int
+	ReservationID  int
+	Provider       string
+	ProviderRef    string
+	Kind           string
+	Amount         int
+	RefundedAmount int
+	Currency       string
+	Status         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 type MailData struct {
@@ -64,4 +251,75 @@ type MailData struct {
 	Subject  string
 	Content  string
 	Template string
+	// Attachments - вложения письма (например, PDF-счет)
+	Attachments []MailAttachment
+	// Logger - логгер запроса, из которого отправлено письмо, чтобы ошибки отправки были видны с его ID
+	Logger *slog.Logger
+}
+
+// MailAttachment - файл, прикладываемый к письму
+type MailAttachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// AuditEntry - запись журнала изменений. Before и After - состояние сущности в JSON (пустые, если его не было)
+type AuditEntry struct {
+	ID int
+	// UserID - администратор, 0 - гость (тогда в Actor его email)
+	UserID   int
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID int
+	Before   string
+	After    string
+	IP       string
+	// User - администратор, заполняется при чтении журнала
+	User      User
+	CreatedAt time.Time
+}
+
+// AuditFilter - фильтры и страница журнала изменений, нулевые значения означают "без фильтра"
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	UserID   int
+	Action   string
+	Page     int
+	PerPage  int
+}
+
+// HousekeepingTask - уборка комнаты на день: после выезда (departure) или у проживающего гостя (stay_over)
+type HousekeepingTask struct {
+	ID            int
+	RoomID        int
+	ReservationID int
+	TaskDate      time.Time
+	Kind          string
+	Status        string
+	// AssignedTo - ID горничной, 0 - не назначена
+	AssignedTo int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room
+	User       User
+}
+
+// MaintenanceTicket - заявка на ремонт комнаты. Открытая заявка с OutOfOrder закрывает комнату
+// с StartDate по ExpectedResolution (не включая)
+type MaintenanceTicket struct {
+	ID                 int
+	RoomID             int
+	Description        string
+	Priority           string
+	Status             string
+	OutOfOrder         bool
+	StartDate          time.Time
+	ExpectedResolution time.Time
+	ClosedAt           time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Room               Room
 }
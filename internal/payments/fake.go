@@ -0,0 +1,168 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Токены тестовых карт для FakeProvider, их выдает виджет оплаты на странице make-payment
+const (
+	FakeTokenApproved      = "tok_approved"
+	FakeTokenDeclined      = "tok_declined"
+	FakeTokenCaptureFailed = "tok_capture_failed"
+)
+
+type fakePayment struct {
+	status        string
+	authorized    int
+	captured      int
+	refunded      int
+	captureFailed bool
+}
+
+// FakeProvider - локальная платежная система для разработки и тестов, работает без сети.
+// Любой токен кроме FakeTokenDeclined одобряется, уведомления подписываются HMAC-SHA256 с секретом secret
+type FakeProvider struct {
+	secret   []byte
+	mu       sync.Mutex
+	next     int
+	payments map[string]*fakePayment
+}
+
+// NewFakeProvider создает фейковую платежную систему
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{
+		secret:   []byte(secret),
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (Result, error) {
+	if req.Amount <= 0 {
+		return Result{Status: StatusFailed, Message: "invalid amount"}, ErrInvalidAmount
+	}
+
+	if req.Token == "" {
+		return Result{Status: StatusFailed, Amount: req.Amount, Message: "missing card token"}, ErrMissingToken
+	}
+
+	if req.Token == FakeTokenDeclined {
+		return Result{Status: StatusFailed, Amount: req.Amount, Message: "card declined"}, ErrDeclined
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	reference := fmt.Sprintf("fake_%d", p.next)
+	p.payments[reference] = &fakePayment{status: StatusAuthorized, authorized: req.Amount,
+		captureFailed: req.Token == FakeTokenCaptureFailed}
+
+	return Result{Reference: reference, Status: StatusAuthorized, Amount: req.Amount}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount int) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[reference]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+
+	if payment.status != StatusAuthorized {
+		return Result{Reference: reference, Status: payment.status}, ErrInvalidState
+	}
+
+	if amount <= 0 || amount > payment.authorized {
+		return Result{Reference: reference, Status: payment.status}, ErrInvalidAmount
+	}
+
+	if payment.captureFailed {
+		return Result{Reference: reference, Status: payment.status, Message: "capture declined"}, ErrDeclined
+	}
+
+	payment.status = StatusCaptured
+	payment.captured = amount
+
+	return Result{Reference: reference, Status: StatusCaptured, Amount: amount}, nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, reference string) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[reference]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+
+	if payment.status != StatusAuthorized {
+		return Result{Reference: reference, Status: payment.status}, ErrInvalidState
+	}
+
+	payment.status = StatusVoided
+
+	return Result{Reference: reference, Status: StatusVoided}, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, reference string, amount int) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[reference]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+
+	if payment.status != StatusCaptured {
+		return Result{Reference: reference, Status: payment.status}, ErrInvalidState
+	}
+
+	if amount <= 0 || amount > payment.captured-payment.refunded {
+		return Result{Reference: reference, Status: payment.status}, ErrInvalidAmount
+	}
+
+	payment.refunded += amount
+	if payment.refunded == payment.captured {
+		payment.status = StatusRefunded
+	}
+
+	return Result{Reference: reference, Status: payment.status, Amount: amount}, nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	var event Event
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.sign(payload)) {
+		return event, ErrInvalidSignature
+	}
+
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
+
+// Sign возвращает подпись уведомления в том виде, в каком ее присылает провайдер (hex HMAC-SHA256)
+func (p *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
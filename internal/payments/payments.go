@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+// Статусы платежа, в таком же виде хранятся в таблице payments
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusFailed     = "failed"
+)
+
+// Виды платежа: депозит (часть стоимости) или полная предоплата
+const (
+	KindDeposit = "deposit"
+	KindFull    = "full"
+)
+
+var (
+	ErrDeclined         = errors.New("payments: card declined")
+	ErrMissingToken     = errors.New("payments: missing card token")
+	ErrNotFound         = errors.New("payments: payment not found")
+	ErrInvalidState     = errors.New("payments: operation is not allowed in current payment state")
+	ErrInvalidAmount    = errors.New("payments: invalid amount")
+	ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+)
+
+// AuthorizeRequest - запрос на блокировку суммы на карте гостя. Amount - в копейках (центах).
+// Token - токен карты, который выдает виджет провайдера в браузере: номер карты и CVC до приложения не доходят
+type AuthorizeRequest struct {
+	Amount        int
+	Currency      string
+	Description   string
+	ReservationID int
+	Token         string
+}
+
+// Result - ответ платежной системы. Reference - идентификатор платежа у провайдера
+type Result struct {
+	Reference string
+	Status    string
+	Amount    int
+	Message   string
+}
+
+// Event - уведомление (webhook) от платежной системы об изменении статуса платежа
+type Event struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Amount    int    `json:"amount"`
+}
+
+// Provider - интерфейс платежной системы. Для подключения реального провайдера достаточно реализовать эти методы
+type Provider interface {
+	// Name возвращает имя провайдера, которое сохраняется вместе с платежом
+	Name() string
+	// Authorize блокирует сумму на карте
+	Authorize(ctx context.Context, req AuthorizeRequest) (Result, error)
+	// Capture списывает ранее заблокированную сумму (полностью или частично)
+	Capture(ctx context.Context, reference string, amount int) (Result, error)
+	// Void снимает блокировку суммы, которая не была списана
+	Void(ctx context.Context, reference string) (Result, error)
+	// Refund возвращает гостю списанную сумму (полностью или частично)
+	Refund(ctx context.Context, reference string, amount int) (Result, error)
+	// VerifyWebhook проверяет подпись уведомления и разбирает его
+	VerifyWebhook(payload []byte, signature string) (Event, error)
+}
+
+// DepositAmount возвращает сумму депозита в процентах от полной стоимости, округляя вверх до копейки
+func DepositAmount(total, percent int) int {
+	if percent <= 0 || percent >= 100 {
+		return total
+	}
+
+	return (total*percent + 99) / 100
+}
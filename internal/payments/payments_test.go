@@ -0,0 +1,122 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFakeProvider_Flow(t *testing.T) {
+	p := NewFakeProvider("secret")
+	ctx := context.Background()
+
+	res, err := p.Authorize(ctx, AuthorizeRequest{Amount: 10000, Token: FakeTokenApproved})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Status != StatusAuthorized || res.Reference == "" {
+		t.Errorf("unexpected authorize result %+v", res)
+	}
+
+	// нельзя списать больше заблокированного
+	_, err = p.Capture(ctx, res.Reference, 20000)
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+
+	captured, err := p.Capture(ctx, res.Reference, 10000)
+	if err != nil || captured.Status != StatusCaptured {
+		t.Fatalf("capture failed: %v %+v", err, captured)
+	}
+
+	refund, err := p.Refund(ctx, res.Reference, 4000)
+	if err != nil || refund.Status != StatusCaptured {
+		t.Errorf("partial refund failed: %v %+v", err, refund)
+	}
+
+	refund, err = p.Refund(ctx, res.Reference, 6000)
+	if err != nil || refund.Status != StatusRefunded {
+		t.Errorf("full refund failed: %v %+v", err, refund)
+	}
+
+	_, err = p.Refund(ctx, res.Reference, 1)
+	if !errors.Is(err, ErrInvalidState) {
+		t.Errorf("got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestFakeProvider_Declined(t *testing.T) {
+	p := NewFakeProvider("secret")
+
+	res, err := p.Authorize(context.Background(), AuthorizeRequest{Amount: 10000, Token: FakeTokenDeclined})
+	if !errors.Is(err, ErrDeclined) || res.Status != StatusFailed {
+		t.Errorf("expected declined payment, got %v %+v", err, res)
+	}
+
+	_, err = p.Capture(context.Background(), "unknown", 100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+
+	_, err = p.Authorize(context.Background(), AuthorizeRequest{Amount: 10000})
+	if !errors.Is(err, ErrMissingToken) {
+		t.Errorf("got %v, want ErrMissingToken", err)
+	}
+}
+
+func TestFakeProvider_Void(t *testing.T) {
+	p := NewFakeProvider("secret")
+	ctx := context.Background()
+
+	res, _ := p.Authorize(ctx, AuthorizeRequest{Amount: 10000, Token: FakeTokenCaptureFailed})
+
+	if _, err := p.Capture(ctx, res.Reference, 10000); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("got %v, want ErrDeclined", err)
+	}
+
+	voided, err := p.Void(ctx, res.Reference)
+	if err != nil || voided.Status != StatusVoided {
+		t.Errorf("void failed: %v %+v", err, voided)
+	}
+
+	// снятую блокировку нельзя ни списать, ни снять повторно
+	if _, err := p.Capture(ctx, res.Reference, 10000); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("got %v, want ErrInvalidState", err)
+	}
+
+	if _, err := p.Void(ctx, res.Reference); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestFakeProvider_VerifyWebhook(t *testing.T) {
+	p := NewFakeProvider("secret")
+
+	payload, _ := json.Marshal(Event{Type: "payment.refunded", Reference: "fake_1", Status: StatusRefunded, Amount: 100})
+
+	event, err := p.VerifyWebhook(payload, p.Sign(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Reference != "fake_1" || event.Status != StatusRefunded {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	_, err = p.VerifyWebhook(payload, NewFakeProvider("other").Sign(payload))
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestDepositAmount(t *testing.T) {
+	if a := DepositAmount(10001, 30); a != 3001 {
+		t.Errorf("got %d, want 3001", a)
+	}
+
+	if a := DepositAmount(10000, 0); a != 10000 {
+		t.Errorf("got %d, want full amount", a)
+	}
+}
@@ -0,0 +1,216 @@
+package pricing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/stayrules"
+)
+
+// Виды строк расчета, в таком же виде хранятся в reservation_charges.kind
+const (
+	KindRoom     = "room"
+	KindTax      = "tax"
+	KindFee      = "fee"
+	KindDiscount = "discount"
+)
+
+// Способ расчета налога или сбора
+const (
+	CalcPercent = "percent"
+	CalcFixed   = "fixed"
+)
+
+// За что начисляется фиксированный сбор
+const (
+	PerStay       = "stay"
+	PerNight      = "night"
+	PerGuest      = "guest"
+	PerGuestNight = "guest_night"
+)
+
+// Stay - параметры проживания, по которым считается стоимость
+type Stay struct {
+	Room      models.Room
+	StartDate time.Time
+	EndDate   time.Time
+	Guests    int
+	// Promo - примененный промокод (уже проверенный), nil - без скидки
+	Promo *models.PromoCode
+}
+
+// Quote - расчет стоимости: строки и итоговые суммы в копейках (центах)
+type Quote struct {
+	Items         []models.ReservationCharge
+	Accommodation int
+	Discounts     int
+	Taxes         int
+	Total         int
+}
+
+// Calculate считает стоимость проживания: ночи по цене комнаты и все действующие налоги и сборы.
+// Это единственное место расчета цены, его используют страница оплаты, итоговая страница и счета
+func Calculate(stay Stay, rules []models.TaxRule) Quote {
+	nights := stayrules.Nights(stay.StartDate, stay.EndDate)
+	if nights < 0 {
+		nights = 0
+	}
+
+	guests := stay.Guests
+	if guests < 1 {
+		guests = 1
+	}
+
+	items := []models.ReservationCharge{{
+		Kind:        KindRoom,
+		Description: fmt.Sprintf("Accommodation - %s", stay.Room.RoomName),
+		Quantity:    nights,
+		UnitAmount:  stay.Room.Price,
+		Amount:      nights * stay.Room.Price,
+	}}
+
+	accommodation := nights * stay.Room.Price
+
+	// скидка считается от стоимости ночей и не может быть больше нее
+	discount := 0
+	if stay.Promo != nil {
+		if stay.Promo.Calculation == CalcPercent {
+			discount = accommodation * stay.Promo.Amount / 10000
+		} else {
+			discount = stay.Promo.Amount
+		}
+
+		if discount > accommodation {
+			discount = accommodation
+		}
+
+		if discount > 0 {
+			items = append(items, models.ReservationCharge{
+				Kind:        KindDiscount,
+				Description: fmt.Sprintf("Promo code %s", stay.Promo.Code),
+				Quantity:    1,
+				UnitAmount:  -discount,
+				Amount:      -discount,
+			})
+		}
+	}
+
+	for _, rule := range rules {
+		// налог начисляется только за ночи, попадающие в период действия правила
+		n := nightsWithin(rule, stay.StartDate, nights)
+		if n == 0 {
+			continue
+		}
+
+		item := models.ReservationCharge{
+			Kind:        rule.Kind,
+			Description: rule.Name,
+			Quantity:    1,
+		}
+
+		if item.Kind != KindFee {
+			item.Kind = KindTax
+		}
+
+		if rule.Calculation == CalcPercent {
+			// процент берется от стоимости ночей за вычетом скидки, округление до копейки вверх
+			base := stay.Room.Price * n
+			if discount > 0 {
+				base = base * (accommodation - discount) / accommodation
+			}
+
+			item.Amount = (base*rule.Amount + 9999) / 10000
+			item.UnitAmount = item.Amount
+		} else {
+			switch rule.Per {
+			case PerNight:
+				item.Quantity = n
+			case PerGuest:
+				item.Quantity = guests
+			case PerGuestNight:
+				item.Quantity = guests * n
+			}
+
+			item.UnitAmount = rule.Amount
+			item.Amount = rule.Amount * item.Quantity
+		}
+
+		if item.Amount == 0 {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return Summarize(items)
+}
+
+// Summarize считает итоговые суммы по готовым (например, сохраненным в бронировании) строкам
+func Summarize(items []models.ReservationCharge) Quote {
+	q := Quote{Items: items}
+
+	for _, item := range items {
+		switch item.Kind {
+		case KindRoom:
+			q.Accommodation += item.Amount
+		case KindDiscount:
+			q.Discounts += item.Amount
+		default:
+			q.Taxes += item.Amount
+		}
+
+		q.Total += item.Amount
+	}
+
+	return q
+}
+
+// nightsWithin возвращает количество ночей проживания в периоде действия правила (конец периода не включается)
+func nightsWithin(rule models.TaxRule, start time.Time, nights int) int {
+	n := 0
+
+	for i := 0; i < nights; i++ {
+		night := start.AddDate(0, 0, i)
+
+		if !rule.ValidFrom.IsZero() && night.Before(rule.ValidFrom) {
+			continue
+		}
+
+		if !rule.ValidTo.IsZero() && !night.Before(rule.ValidTo) {
+			continue
+		}
+
+		n++
+	}
+
+	return n
+}
+
+// ParseAmount разбирает сумму или процент в виде "20", "2.5" или "2,50" и возвращает значение в сотых долях
+func ParseAmount(s string) (int, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("pricing: too many decimal places in %q", s)
+	}
+
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	w, err := strconv.Atoi(whole)
+	if err != nil || w < 0 {
+		return 0, fmt.Errorf("pricing: invalid amount %q", s)
+	}
+
+	f, err := strconv.Atoi(frac)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("pricing: invalid amount %q", s)
+	}
+
+	return w*100 + f, nil
+}
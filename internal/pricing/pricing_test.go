@@ -0,0 +1,117 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCalculate(t *testing.T) {
+	stay := Stay{
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters", Price: 10000},
+		StartDate: date(2050, 1, 1),
+		EndDate:   date(2050, 1, 4),
+		Guests:    2,
+	}
+
+	rules := []models.TaxRule{
+		{Name: "VAT", Kind: KindTax, Calculation: CalcPercent, Amount: 2000},
+		{Name: "Tourist tax", Kind: KindTax, Calculation: CalcFixed, Amount: 150, Per: PerGuestNight},
+		{Name: "Cleaning", Kind: KindFee, Calculation: CalcFixed, Amount: 2500, Per: PerStay},
+		// действует только в последнюю ночь
+		{Name: "Festival fee", Kind: KindFee, Calculation: CalcFixed, Amount: 300, Per: PerNight,
+			ValidFrom: date(2050, 1, 3)},
+		// уже не действует
+		{Name: "Old tax", Kind: KindTax, Calculation: CalcFixed, Amount: 999, Per: PerStay,
+			ValidTo: date(2050, 1, 1)},
+	}
+
+	q := Calculate(stay, rules)
+
+	if len(q.Items) != 5 {
+		t.Fatalf("got %d items, want 5: %+v", len(q.Items), q.Items)
+	}
+
+	if q.Accommodation != 30000 {
+		t.Errorf("got accommodation %d, want 30000", q.Accommodation)
+	}
+
+	// 6000 VAT + 2 гостя * 3 ночи * 150 + 2500 + 300
+	if q.Taxes != 6000+900+2500+300 {
+		t.Errorf("got taxes %d, want %d", q.Taxes, 6000+900+2500+300)
+	}
+
+	if q.Total != q.Accommodation+q.Taxes {
+		t.Errorf("got total %d", q.Total)
+	}
+
+	if q.Items[2].Quantity != 6 || q.Items[2].UnitAmount != 150 {
+		t.Errorf("unexpected tourist tax line %+v", q.Items[2])
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	q := Summarize([]models.ReservationCharge{
+		{Kind: KindRoom, Amount: 10000},
+		{Kind: KindDiscount, Amount: -1000},
+		{Kind: KindFee, Amount: 500},
+	})
+
+	if q.Accommodation != 10000 || q.Discounts != -1000 || q.Taxes != 500 || q.Total != 9500 {
+		t.Errorf("unexpected quote %+v", q)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"20", 2000, false},
+		{"2.5", 250, false},
+		{"2,50", 250, false},
+		{"0.05", 5, false},
+		{"1.234", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+	}
+
+	for _, e := range tests {
+		got, err := ParseAmount(e.in)
+		if (err != nil) != e.wantErr || got != e.want {
+			t.Errorf("ParseAmount(%q) = %d, %v", e.in, got, err)
+		}
+	}
+}
+
+func TestCalculate_Promo(t *testing.T) {
+	stay := Stay{
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters", Price: 10000},
+		StartDate: date(2050, 1, 1),
+		EndDate:   date(2050, 1, 3),
+		Promo:     &models.PromoCode{Code: "SAVE10", Calculation: CalcPercent, Amount: 1000},
+	}
+
+	rules := []models.TaxRule{{Name: "VAT", Kind: KindTax, Calculation: CalcPercent, Amount: 2000}}
+
+	q := Calculate(stay, rules)
+
+	// скидка 10% от 200.00, НДС 20% от 180.00
+	if q.Discounts != -2000 || q.Taxes != 3600 || q.Total != 21600 {
+		t.Errorf("unexpected quote %+v", q)
+	}
+
+	// фиксированная скидка не больше стоимости ночей
+	stay.Promo = &models.PromoCode{Code: "FREE", Calculation: CalcFixed, Amount: 50000}
+	q = Calculate(stay, nil)
+
+	if q.Discounts != -20000 || q.Total != 0 {
+		t.Errorf("unexpected quote %+v", q)
+	}
+}
@@ -0,0 +1,81 @@
+package promo
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Ошибки проверки промокода. Текст для гостя подбирает обработчик формы
+var (
+	ErrInactive     = errors.New("promo code is not active")
+	ErrExpired      = errors.New("promo code has expired")
+	ErrNotStarted   = errors.New("promo code is not valid yet")
+	ErrStayDates    = errors.New("promo code is not valid for the stay dates")
+	ErrRoom         = errors.New("promo code is not valid for the room")
+	ErrUsageLimit   = errors.New("promo code usage limit reached")
+	ErrAlreadyUsed  = errors.New("promo code already used by the guest")
+	ErrInvalidValue = errors.New("promo code has no discount")
+)
+
+// Usage - сколько раз код уже использован: всего и этим гостем (по email)
+type Usage struct {
+	Total int
+	Guest int
+}
+
+// Normalize приводит введенный гостем код к виду, в котором коды хранятся в базе
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check проверяет, можно ли применить промокод к бронированию комнаты roomID на даты start-end, сделанному в момент now
+func Check(code models.PromoCode, roomID int, start, end, now time.Time, usage Usage) error {
+	if !code.Active {
+		return ErrInactive
+	}
+
+	if code.Amount <= 0 {
+		return ErrInvalidValue
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if !code.ValidFrom.IsZero() && today.Before(code.ValidFrom) {
+		return ErrNotStarted
+	}
+
+	if !code.ValidTo.IsZero() && today.After(code.ValidTo) {
+		return ErrExpired
+	}
+
+	if !code.StayFrom.IsZero() && start.Before(code.StayFrom) {
+		return ErrStayDates
+	}
+
+	if !code.StayTo.IsZero() && end.After(code.StayTo) {
+		return ErrStayDates
+	}
+
+	if code.RoomID != 0 && code.RoomID != roomID {
+		return ErrRoom
+	}
+
+	return CheckUsage(code, usage)
+}
+
+// CheckUsage проверяет только лимиты использования кода. При сохранении бронирования
+// ее повторяют под блокировкой промокода, чтобы два гостя не заняли последнее использование
+func CheckUsage(code models.PromoCode, usage Usage) error {
+	if code.MaxUses > 0 && usage.Total >= code.MaxUses {
+		return ErrUsageLimit
+	}
+
+	if code.OncePerGuest && usage.Guest > 0 {
+		return ErrAlreadyUsed
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package promo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCheck(t *testing.T) {
+	code := models.PromoCode{
+		Code:         "SUMMER",
+		Calculation:  "percent",
+		Amount:       1000,
+		ValidFrom:    date(2050, 1, 1),
+		ValidTo:      date(2050, 3, 31),
+		StayFrom:     date(2050, 6, 1),
+		StayTo:       date(2050, 9, 1),
+		RoomID:       1,
+		MaxUses:      10,
+		OncePerGuest: true,
+		Active:       true,
+	}
+
+	now := date(2050, 3, 31)
+	start, end := date(2050, 7, 1), date(2050, 7, 5)
+
+	var tests = []struct {
+		name   string
+		change func(c *models.PromoCode)
+		roomID int
+		start  time.Time
+		end    time.Time
+		now    time.Time
+		usage  Usage
+		want   error
+	}{
+		{"valid", nil, 1, start, end, now, Usage{Total: 9}, nil},
+		{"inactive", func(c *models.PromoCode) { c.Active = false }, 1, start, end, now, Usage{}, ErrInactive},
+		{"not-started", nil, 1, start, end, date(2049, 12, 31), Usage{}, ErrNotStarted},
+		{"expired", nil, 1, start, end, date(2050, 4, 1), Usage{}, ErrExpired},
+		{"early-arrival", nil, 1, date(2050, 5, 31), end, now, Usage{}, ErrStayDates},
+		{"late-departure", nil, 1, start, date(2050, 9, 2), now, Usage{}, ErrStayDates},
+		{"room", nil, 2, start, end, now, Usage{}, ErrRoom},
+		{"limit", nil, 1, start, end, now, Usage{Total: 10}, ErrUsageLimit},
+		{"guest", nil, 1, start, end, now, Usage{Total: 1, Guest: 1}, ErrAlreadyUsed},
+	}
+
+	for _, e := range tests {
+		c := code
+		if e.change != nil {
+			e.change(&c)
+		}
+
+		err := Check(c, e.roomID, e.start, e.end, e.now, e.usage)
+		if !errors.Is(err, e.want) {
+			t.Errorf("failed %s: got %v, want %v", e.name, err, e.want)
+		}
+	}
+}
+
+func TestCheckUsage(t *testing.T) {
+	unlimited := models.PromoCode{Active: true, Amount: 1000}
+	if err := CheckUsage(unlimited, Usage{Total: 100, Guest: 5}); err != nil {
+		t.Errorf("unlimited code: got %v", err)
+	}
+
+	last := models.PromoCode{MaxUses: 1}
+	if err := CheckUsage(last, Usage{Total: 1}); !errors.Is(err, ErrUsageLimit) {
+		t.Errorf("last use taken: got %v, want %v", err, ErrUsageLimit)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if c := Normalize("  summer10 "); c != "SUMMER10" {
+		t.Errorf("got %q", c)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"github.com/justinas/nosurf"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/reports"
+	"github.com/krasnov23/guest-house-golang/internal/stayrules"
 	"html/template"
 	"net/http"
 	"path/filepath"
@@ -18,6 +21,9 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"weekdays":   Weekdays,
+	"money":      FormatMoney,
+	"reportCell": reports.FormatCell,
 }
 
 var app *config.AppConfig
@@ -48,6 +54,22 @@ func Add(a, b int) int {
 	return a + b
 }
 
+// Weekdays выводит битовую маску дней недели из правил проживания в читаемом виде
+func Weekdays(mask int) string {
+	return stayrules.DaysString(mask)
+}
+
+// FormatMoney выводит сумму в копейках (центах) в виде 120.50
+func FormatMoney(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
 func FormatDate(t time.Time, f string) string {
 	return t.Format(f)
 }
@@ -108,7 +130,7 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 	// Если шаблон выполнен успешно, данные из буфера отправляются клиенту с помощью buf.WriteTo(w)
 	_, err := buf.WriteTo(w)
 	if err != nil {
-		fmt.Println("error writing template to browser", err)
+		logging.FromContext(r.Context()).Error("error writing template to browser", "template", tmpl, "error", err)
 	}
 
 	return nil
@@ -4,8 +4,9 @@ import (
 	"encoding/gob"
 	"github.com/alexedwards/scs/v2"
 	"github.com/krasnov23/guest-house-golang/internal/config"
+	"github.com/krasnov23/guest-house-golang/internal/logging"
 	"github.com/krasnov23/guest-house-golang/internal/models"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
@@ -21,12 +22,8 @@ func TestMain(m *testing.M) {
 
 	testApp.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	testApp.InfoLog = infoLog
-
-	// будет отображать Дата + время + сообщение в консоли
-	errLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	testApp.ErrorLog = errLog
+	// в тестах пишем логи в консоль в том же JSON-формате, что и в продакшне
+	testApp.Logger = logging.New(os.Stdout, slog.LevelInfo)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
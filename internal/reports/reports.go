@@ -0,0 +1,363 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Money - сумма в копейках (центах), в выгрузках выводится как число с двумя знаками после запятой
+type Money int
+
+// Percent - значение в процентах, в выгрузках выводится с одним знаком после запятой
+type Percent float64
+
+// ErrUnknownReport - запрошен отчет, которого нет в списке Available
+var ErrUnknownReport = errors.New("reports: unknown report")
+
+// Kind - отчет из списка отчетов в админке
+type Kind struct {
+	Name  string
+	Title string
+}
+
+// Available - отчеты, которые можно построить и выгрузить
+var Available = []Kind{
+	{"occupancy", "Occupancy"},
+	{"revenue", "Revenue, ADR and RevPAR"},
+	{"sources", "Bookings by source"},
+	{"cancellations", "Cancellations"},
+	{"nationality", "Guest nationality"},
+}
+
+// Report - построенный отчет: заголовки колонок, строки и итоговая строка.
+// Значения ячеек - string, int, Money, Percent или time.Time
+type Report struct {
+	Name    string
+	Title   string
+	Start   time.Time
+	End     time.Time
+	Columns []string
+	Rows    [][]interface{}
+	Totals  []interface{}
+}
+
+// Build строит отчет name за период с start по end (end не включается) по бронированиям из GetReportReservations
+func Build(name string, start, end time.Time, rooms []models.Room, reservations []models.ReportReservation) (*Report, error) {
+	r := &Report{Name: name, Start: start, End: end}
+
+	for _, k := range Available {
+		if k.Name == name {
+			r.Title = k.Title
+		}
+	}
+
+	switch name {
+	case "occupancy":
+		r.occupancy(rooms, reservations)
+	case "revenue":
+		r.revenue(rooms, reservations)
+	case "sources":
+		r.sources(reservations)
+	case "cancellations":
+		r.cancellations(reservations)
+	case "nationality":
+		r.nationality(reservations)
+	default:
+		return nil, ErrUnknownReport
+	}
+
+	return r, nil
+}
+
+// FileName - имя файла выгрузки, например "occupancy-2026-10-01-2026-10-31.csv"
+func (r *Report) FileName(ext string) string {
+	return fmt.Sprintf("%s-%s-%s.%s", r.Name, r.Start.Format("2006-01-02"),
+		r.End.AddDate(0, 0, -1).Format("2006-01-02"), ext)
+}
+
+// roomStats - проданные ночи и выручка по комнате за период
+type roomStats struct {
+	reservations int
+	nights       int
+	revenue      int
+}
+
+// byRoom считает проданные в периоде ночи и выручку по комнатам. Выручка бронирования, которое
+// выходит за границы периода, делится пропорционально ночам
+func (r *Report) byRoom(reservations []models.ReportReservation) map[int]*roomStats {
+	stats := make(map[int]*roomStats)
+
+	for _, i := range reservations {
+		res := i.Reservation
+		if !res.CancelledAt.IsZero() {
+			continue
+		}
+
+		n := r.nightsWithin(res)
+		if n == 0 {
+			continue
+		}
+
+		s, ok := stats[res.RoomID]
+		if !ok {
+			s = &roomStats{}
+			stats[res.RoomID] = s
+		}
+
+		s.reservations++
+		s.nights += n
+
+		if total := nights(res.StartDate, res.EndDate); total > 0 {
+			s.revenue += i.Revenue * n / total
+		}
+	}
+
+	return stats
+}
+
+func (r *Report) occupancy(rooms []models.Room, reservations []models.ReportReservation) {
+	r.Columns = []string{"Room", "Available nights", "Nights sold", "Occupancy, %"}
+
+	stats := r.byRoom(reservations)
+	available := nights(r.Start, r.End)
+
+	var totalAvailable, totalSold int
+
+	for _, room := range rooms {
+		sold := 0
+		if s, ok := stats[room.ID]; ok {
+			sold = s.nights
+		}
+
+		r.Rows = append(r.Rows, []interface{}{room.RoomName, available, sold, percent(sold, available)})
+
+		totalAvailable += available
+		totalSold += sold
+	}
+
+	r.Totals = []interface{}{"Total", totalAvailable, totalSold, percent(totalSold, totalAvailable)}
+}
+
+func (r *Report) revenue(rooms []models.Room, reservations []models.ReportReservation) {
+	r.Columns = []string{"Room", "Reservations", "Nights sold", "Revenue", "ADR", "RevPAR"}
+
+	stats := r.byRoom(reservations)
+	available := nights(r.Start, r.End)
+
+	var total roomStats
+
+	for _, room := range rooms {
+		s, ok := stats[room.ID]
+		if !ok {
+			s = &roomStats{}
+		}
+
+		r.Rows = append(r.Rows, []interface{}{room.RoomName, s.reservations, s.nights, Money(s.revenue),
+			Money(div(s.revenue, s.nights)), Money(div(s.revenue, available))})
+
+		total.reservations += s.reservations
+		total.nights += s.nights
+		total.revenue += s.revenue
+	}
+
+	r.Totals = []interface{}{"Total", total.reservations, total.nights, Money(total.revenue),
+		Money(div(total.revenue, total.nights)), Money(div(total.revenue, available*len(rooms)))}
+}
+
+// sources - бронирования, сделанные в периоде, по источникам
+func (r *Report) sources(reservations []models.ReportReservation) {
+	r.Columns = []string{"Source", "Bookings", "Cancelled", "Nights", "Revenue"}
+
+	type sourceStats struct {
+		bookings, cancelled, nights, revenue int
+	}
+
+	stats := make(map[string]*sourceStats)
+
+	for _, i := range reservations {
+		res := i.Reservation
+		if !r.contains(res.CreatedAt) {
+			continue
+		}
+
+		source := res.Source
+		if source == "" {
+			source = "website"
+		}
+
+		s, ok := stats[source]
+		if !ok {
+			s = &sourceStats{}
+			stats[source] = s
+		}
+
+		s.bookings++
+
+		if !res.CancelledAt.IsZero() {
+			s.cancelled++
+			continue
+		}
+
+		s.nights += nights(res.StartDate, res.EndDate)
+		s.revenue += i.Revenue
+	}
+
+	var total sourceStats
+
+	for _, source := range sortedKeys(stats) {
+		s := stats[source]
+		r.Rows = append(r.Rows, []interface{}{source, s.bookings, s.cancelled, s.nights, Money(s.revenue)})
+
+		total.bookings += s.bookings
+		total.cancelled += s.cancelled
+		total.nights += s.nights
+		total.revenue += s.revenue
+	}
+
+	r.Totals = []interface{}{"Total", total.bookings, total.cancelled, total.nights, Money(total.revenue)}
+}
+
+// cancellations - бронирования, отмененные в периоде
+func (r *Report) cancellations(reservations []models.ReportReservation) {
+	r.Columns = []string{"Reservation", "Guest", "Room", "Arrival", "Departure", "Booked", "Cancelled",
+		"Days before arrival", "Lost revenue"}
+
+	count, lost := 0, 0
+
+	for _, i := range reservations {
+		res := i.Reservation
+		if res.CancelledAt.IsZero() || !r.contains(res.CancelledAt) {
+			continue
+		}
+
+		cancelled := truncate(res.CancelledAt)
+
+		r.Rows = append(r.Rows, []interface{}{res.ID, fmt.Sprintf("%s %s", res.FirstName, res.LastName),
+			res.Room.RoomName, res.StartDate, res.EndDate, res.CreatedAt, res.CancelledAt,
+			nights(cancelled, res.StartDate), Money(i.Revenue)})
+
+		count++
+		lost += i.Revenue
+	}
+
+	r.Totals = []interface{}{"Total", count, "", "", "", "", "", "", Money(lost)}
+}
+
+// nationality - гости, проживающие в периоде, по гражданству
+func (r *Report) nationality(reservations []models.ReportReservation) {
+	r.Columns = []string{"Nationality", "Reservations", "Guests", "Nights"}
+
+	type nationalityStats struct {
+		reservations, guests, nights int
+	}
+
+	stats := make(map[string]*nationalityStats)
+
+	for _, i := range reservations {
+		res := i.Reservation
+		if !res.CancelledAt.IsZero() {
+			continue
+		}
+
+		n := r.nightsWithin(res)
+		if n == 0 {
+			continue
+		}
+
+		nationality := res.Nationality
+		if nationality == "" {
+			nationality = "Unknown"
+		}
+
+		s, ok := stats[nationality]
+		if !ok {
+			s = &nationalityStats{}
+			stats[nationality] = s
+		}
+
+		guests := res.Guests
+		if guests < 1 {
+			guests = 1
+		}
+
+		s.reservations++
+		s.guests += guests
+		s.nights += n
+	}
+
+	var total nationalityStats
+
+	for _, nationality := range sortedKeys(stats) {
+		s := stats[nationality]
+		r.Rows = append(r.Rows, []interface{}{nationality, s.reservations, s.guests, s.nights})
+
+		total.reservations += s.reservations
+		total.guests += s.guests
+		total.nights += s.nights
+	}
+
+	r.Totals = []interface{}{"Total", total.reservations, total.guests, total.nights}
+}
+
+// nightsWithin возвращает количество ночей бронирования, попадающих в период отчета
+func (r *Report) nightsWithin(res models.Reservation) int {
+	start, end := res.StartDate, res.EndDate
+
+	if start.Before(r.Start) {
+		start = r.Start
+	}
+
+	if end.After(r.End) {
+		end = r.End
+	}
+
+	if n := nights(start, end); n > 0 {
+		return n
+	}
+
+	return 0
+}
+
+// contains проверяет, что момент t попадает в период отчета
+func (r *Report) contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+func nights(start, end time.Time) int {
+	return int(truncate(end).Sub(truncate(start)).Hours() / 24)
+}
+
+func truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func percent(part, whole int) Percent {
+	if whole == 0 {
+		return 0
+	}
+
+	return Percent(float64(part) * 100 / float64(whole))
+}
+
+func div(a, b int) int {
+	if b == 0 {
+		return 0
+	}
+
+	return a / b
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
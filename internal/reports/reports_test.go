@@ -0,0 +1,216 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(m time.Month, d int) time.Time {
+	return time.Date(2050, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var rooms = []models.Room{{ID: 1, RoomName: "General's Quarters"}, {ID: 2, RoomName: "Majors Suite"}}
+
+var reservations = []models.ReportReservation{
+	{Reservation: models.Reservation{ID: 1, RoomID: 1, StartDate: date(1, 1), EndDate: date(1, 4), Guests: 2,
+		Source: "website", Nationality: "Germany", CreatedAt: date(1, 1).AddDate(0, -1, 0)}, Revenue: 36000},
+	// выходит за конец января, в отчет попадают 2 ночи из 3
+	{Reservation: models.Reservation{ID: 2, RoomID: 2, StartDate: date(1, 30), EndDate: date(2, 2), Guests: 1,
+		Source: "phone", CreatedAt: date(1, 5)}, Revenue: 30000},
+	{Reservation: models.Reservation{ID: 3, RoomID: 1, StartDate: date(1, 20), EndDate: date(1, 22),
+		Source: "website", CreatedAt: date(1, 2), CancelledAt: date(1, 10).Add(15 * time.Hour)}, Revenue: 24000},
+}
+
+func build(t *testing.T, name string) *Report {
+	r, err := Build(name, date(1, 1), date(2, 1), rooms, reservations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestBuild_Occupancy(t *testing.T) {
+	r := build(t, "occupancy")
+
+	if r.Rows[0][2] != 3 || r.Rows[1][2] != 2 {
+		t.Errorf("unexpected nights sold %v", r.Rows)
+	}
+
+	if r.Totals[1] != 62 || FormatCell(r.Totals[3]) != "8.1" {
+		t.Errorf("unexpected totals %v", r.Totals)
+	}
+}
+
+func TestBuild_Revenue(t *testing.T) {
+	r := build(t, "revenue")
+
+	// комната 1: 360.00 за 3 ночи, RevPAR 360.00 / 31
+	if r.Rows[0][3] != Money(36000) || r.Rows[0][4] != Money(12000) || r.Rows[0][5] != Money(1161) {
+		t.Errorf("unexpected row %v", r.Rows[0])
+	}
+
+	// комната 2: 2/3 от 300.00
+	if r.Rows[1][3] != Money(20000) || r.Rows[1][4] != Money(10000) {
+		t.Errorf("unexpected row %v", r.Rows[1])
+	}
+}
+
+func TestBuild_Sources(t *testing.T) {
+	r := build(t, "sources")
+
+	// бронирование 1 сделано в декабре и в отчет за январь не попадает
+	if len(r.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %v", len(r.Rows), r.Rows)
+	}
+
+	if r.Rows[0][0] != "phone" || r.Rows[0][4] != Money(30000) {
+		t.Errorf("unexpected row %v", r.Rows[0])
+	}
+
+	if r.Rows[1][0] != "website" || r.Rows[1][1] != 1 || r.Rows[1][2] != 1 || r.Rows[1][4] != Money(0) {
+		t.Errorf("unexpected row %v", r.Rows[1])
+	}
+}
+
+func TestBuild_Cancellations(t *testing.T) {
+	r := build(t, "cancellations")
+
+	if len(r.Rows) != 1 || r.Rows[0][0] != 3 || r.Rows[0][7] != 10 {
+		t.Errorf("unexpected rows %v", r.Rows)
+	}
+}
+
+func TestBuild_Nationality(t *testing.T) {
+	r := build(t, "nationality")
+
+	if len(r.Rows) != 2 || r.Rows[0][0] != "Germany" || r.Rows[0][2] != 2 || r.Rows[1][0] != "Unknown" || r.Rows[1][3] != 2 {
+		t.Errorf("unexpected rows %v", r.Rows)
+	}
+}
+
+func TestBuild_Unknown(t *testing.T) {
+	if _, err := Build("nope", date(1, 1), date(2, 1), rooms, reservations); !errors.Is(err, ErrUnknownReport) {
+		t.Errorf("got %v, want ErrUnknownReport", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := build(t, "revenue").WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %q", len(lines), buf.String())
+	}
+
+	if lines[0] != "Room,Reservations,Nights sold,Revenue,ADR,RevPAR" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+
+	if lines[1] != "General's Quarters,1,3,360.00,120.00,11.61" {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
+
+func TestWriteCSV_Formula(t *testing.T) {
+	r := &Report{
+		Columns: []string{"Guest", "Amount"},
+		Rows: [][]interface{}{
+			{"=HYPERLINK(\"http://evil\")", Money(-1200)},
+			{"+1", Money(100)},
+			{"-1", Money(100)},
+			{"@SUM(A1)", Money(100)},
+			{"John", Money(100)},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"Guest,Amount",
+		`"'=HYPERLINK(""http://evil"")",-12.00`,
+		"'+1,1.00",
+		"'-1,1.00",
+		"'@SUM(A1),1.00",
+		"John,1.00",
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), len(want), buf.String())
+	}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: got %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := build(t, "revenue").WriteXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip archive: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/styles.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+
+	expected := []string{
+		`<c r="A1" s="1" t="inlineStr"><is><t>Room</t></is></c>`,
+		`<t>General&#39;s Quarters</t>`,
+		`<c r="D2" s="2"><v>360.00</v></c>`,
+		`<row r="4">`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(sheet, e) {
+			t.Errorf("expected %s in sheet", e)
+		}
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
 	"github.com/krasnov23/guest-house-golang/internal/config"
 	"github.com/krasnov23/guest-house-golang/internal/repository"
+	"strings"
+	"time"
 )
 
+// defaultQueryTimeout - таймаут запроса к БД, если в конфигурации он не задан
+const defaultQueryTimeout = 3 * time.Second
+
+// foreignKeyViolation - код ошибки Postgres, когда удаление нарушает внешний ключ
+const foreignKeyViolation = "23503"
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -28,3 +37,22 @@ func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
 		App: a,
 	}
 }
+
+// withTimeout ограничивает запрос таймаутом из конфигурации. Контекст приходит из HTTP-запроса,
+// поэтому если клиент ушел, запрос к БД тоже отменяется
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultQueryTimeout
+	if m.App != nil && m.App.DBQueryTimeout > 0 {
+		timeout = m.App.DBQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// likeEscaper экранирует спецсимволы шаблона like/ilike (escape-символ по умолчанию - обратный слеш)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern возвращает шаблон ilike для поиска подстроки: % и _ во введенном тексте ищутся как обычные символы
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
@@ -0,0 +1,70 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/krasnov23/guest-house-golang/internal/config"
+	"testing"
+	"time"
+)
+
+func TestPostgresDBRepo_WithTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     *config.AppConfig
+		timeout time.Duration
+	}{
+		{"default", &config.AppConfig{}, defaultQueryTimeout},
+		{"no-config", nil, defaultQueryTimeout},
+		{"configured", &config.AppConfig{DBQueryTimeout: time.Second}, time.Second},
+	}
+
+	for _, e := range tests {
+		m := &postgresDBRepo{App: e.app}
+
+		ctx, cancel := m.withTimeout(context.Background())
+		deadline, ok := ctx.Deadline()
+		cancel()
+
+		if !ok {
+			t.Errorf("%s: no deadline", e.name)
+			continue
+		}
+
+		if left := time.Until(deadline); left > e.timeout || left < e.timeout-time.Second/2 {
+			t.Errorf("%s: got %s until deadline, want about %s", e.name, left, e.timeout)
+		}
+	}
+
+	// клиент ушел - запрос к БД отменяется, не дожидаясь таймаута
+	m := &postgresDBRepo{App: &config.AppConfig{}}
+	parent, cancelParent := context.WithCancel(context.Background())
+
+	ctx, cancel := m.withTimeout(parent)
+	defer cancel()
+
+	cancelParent()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("query context was not cancelled with the request")
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"smith", "%smith%"},
+		{"100%", `%100\%%`},
+		{"a_b", `%a\_b%`},
+		{`c:\x`, `%c:\\x%`},
+	}
+
+	for _, e := range tests {
+		if got := containsPattern(e.search); got != e.want {
+			t.Errorf("containsPattern(%q) = %q, want %q", e.search, got, e.want)
+		}
+	}
+}
@@ -2,85 +2,34 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/krasnov23/guest-house-golang/internal/blocks"
+	"github.com/krasnov23/guest-house-golang/internal/invoice"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/promo"
+	"github.com/krasnov23/guest-house-golang/internal/repository"
 	"golang.org/x/crypto/bcrypt"
-	"log"
+	"sort"
+	"strings"
 	"time"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
+func (m *postgresDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, roomID int, start, end time.Time) (bool, error) {
 
-	// Автоматическая отмена запроса, если он выполняется дольше 3 секунд
-	// Защита от "зависания" при проблемах с БД
-	// Освобождение ресурсов (соединений с БД) при таймауте
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-
-	var newID int
-
-	stmt := `insert into reservations (first_name, last_name,email,phone,start_date,
-                          end_date,room_id,created_at,updated_at)
-    		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
-
-	// Выполняется запрос с контекстом (для таймаута)
-	// Передаются параметры из объекта res (бронирование) и текущее время для полей created/updated
-	// Результат (новый ID) сканируется в переменную newID
-	err := m.DB.QueryRowContext(ctx, stmt,
-		res.FirstName,
-		res.LastName,
-		res.Email,
-		res.Phone,
-		res.StartDate,
-		res.EndDate,
-		res.RoomID,
-		time.Now(),
-		time.Now(),
-	).Scan(&newID)
-
-	if err != nil {
-		return 0, err
-	}
-
-	return newID, nil
-}
-
-func (m *postgresDBRepo) InsertRoomRestriction(rr models.RoomRestriction) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-
-	stmt := `insert into room_restrictions (start_date,end_date, room_id,reservation_id,
-				created_at,updated_at,restriction_id) VALUES ($1, $2, $3, $4,$5,$6,$7)`
-
-	_, err := m.DB.ExecContext(ctx, stmt,
-		rr.StartDate,
-		rr.EndDate,
-		rr.RoomID,
-		rr.ReservationID,
-		time.Now(),
-		time.Now(),
-		rr.RestrictionID)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(roomID int, start, end time.Time) (bool, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var numRows int
 
-	query := `select count(*) from reservations where 
+	// занятость берется из room_restrictions, как и в SearchAvailabilityForAllRooms: там и бронирования, и блокировки
+	query := `select count(*) from room_restrictions where
                                       room_id = $1 and end_date > $2 and start_date < $3;`
 
 	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
@@ -100,9 +49,9 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(roomID int, start, en
 	return false, nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
@@ -147,17 +96,17 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 
 }
 
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var room models.Room
 
-	query := `select r.id,r.room_name,r.created_at,r.updated_at from rooms r where r.id=$1;`
+	query := `select r.id,r.room_name,r.price,r.created_at,r.updated_at from rooms r where r.id=$1;`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
-	err := row.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.ID, &room.RoomName, &room.Price, &room.CreatedAt, &room.UpdatedAt)
 
 	if err != nil {
 		return room, err
@@ -166,11 +115,11 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *postgresDBRepo) GetUserById(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) GetUserById(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `select id,first_name,last_name,email, password, access_level,created_at,updated_at
+	query := `select id,first_name,last_name,email, password, access_level, role, created_at,updated_at
 			from users u where u.id=$1;`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
@@ -184,6 +133,7 @@ func (m *postgresDBRepo) GetUserById(id int) (models.User, error) {
 		&u.Email,
 		&u.Password,
 		&u.AccessLevel,
+		&u.Role,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -195,8 +145,8 @@ func (m *postgresDBRepo) GetUserById(id int) (models.User, error) {
 	return u, nil
 }
 
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5 where id = $5;`
@@ -210,8 +160,9 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 	return nil
 }
 
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// Authenticate проверяет email и пароль и возвращает ID и роль пользователя
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	/*hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.DefaultCost)
@@ -222,10 +173,10 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	}*/
 
 	var id int
-	var hashedPassword string
+	var hashedPassword, role string
 
-	row := m.DB.QueryRowContext(ctx, `select id,password from users where email = $1`, email)
-	err := row.Scan(&id, &hashedPassword)
+	row := m.DB.QueryRowContext(ctx, `select id,password,role from users where email = $1`, email)
+	err := row.Scan(&id, &hashedPassword, &role)
 	if err != nil {
 		return id, "", err
 	}
@@ -239,75 +190,41 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 		return 0, "", err
 	}
 
-	return id, hashedPassword, nil
+	return id, role, nil
 }
 
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-
-	var reservations []models.Reservation
-
-	query := `
-		select r.id,r.first_name,r.last_name,r.email,r.phone, r.start_date,
-		r.end_date, r.room_id,r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
-		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		order by r.start_date asc
-	`
-
-	rows, err := m.DB.QueryContext(ctx, query)
-
-	if err != nil {
-		return reservations, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var i models.Reservation
-
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-
-		if err != nil {
-			return reservations, err
-		}
-
-		reservations = append(reservations, i)
-	}
+// reservationSortColumns - колонки, по которым можно сортировать списки бронирований.
+// В запрос попадают только значения из этой мапы, а не то, что пришло в параметрах
+var reservationSortColumns = map[string]string{
+	"id":        "r.id",
+	"name":      "r.last_name",
+	"room":      "rm.room_name",
+	"arrival":   "r.start_date",
+	"departure": "r.end_date",
+	"created":   "r.created_at",
+}
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
-	}
+// reservationsPerPage - размер страницы списка бронирований по умолчанию
+const reservationsPerPage = 25
 
-	return reservations, nil
+// AllReservations возвращает страницу списка бронирований с учетом фильтров и общее количество найденных бронирований
+func (m *postgresDBRepo) AllReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error) {
+	return m.findReservations(ctx, f)
 }
 
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var res models.Reservation
 
 	query := `
 	select r.id,r.first_name,r.last_name,r.email,r.phone, r.start_date,
-	r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-	rm.id, rm.room_name
+	r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, r.guests, coalesce(r.promo_code_id, 0),
+	r.source, r.nationality, coalesce(r.cancelled_at, '0001-01-01'::timestamp),
+	coalesce(r.checked_in_at, '0001-01-01'::timestamp), coalesce(r.checked_out_at, '0001-01-01'::timestamp),
+	coalesce(r.no_show_at, '0001-01-01'::timestamp), r.id_document_type, r.id_document_number,
+	rm.id, rm.room_name, rm.price
 	from reservations r
 	left join rooms rm on (r.room_id = rm.id)
 	where r.id = $1;`
@@ -326,37 +243,123 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Guests,
+		&res.PromoCodeID,
+		&res.Source,
+		&res.Nationality,
+		&res.CancelledAt,
+		&res.CheckedInAt,
+		&res.CheckedOutAt,
+		&res.NoShowAt,
+		&res.IDDocumentType,
+		&res.IDDocumentNumber,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.Price,
 	)
 
 	if err != nil {
 		return res, err
 	}
 
+	clearStayTimes(&res)
+
 	return res, nil
 }
 
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// AllNewReservations - то же, что AllReservations, но только необработанные и не отмененные бронирования
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error) {
+	f.Status = "new"
+	return m.findReservations(ctx, f)
+}
+
+func (m *postgresDBRepo) findReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
 
+	var where []string
+	var args []interface{}
+
+	// arg добавляет параметр запроса и возвращает его плейсхолдер
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !f.From.IsZero() {
+		where = append(where, "r.end_date > "+arg(f.From))
+	}
+
+	if !f.To.IsZero() {
+		where = append(where, "r.start_date <= "+arg(f.To))
+	}
+
+	if f.RoomID > 0 {
+		where = append(where, "r.room_id = "+arg(f.RoomID))
+	}
+
+	switch f.Status {
+	case "new":
+		where = append(where, "r.processed = 0 and r.cancelled_at is null")
+	case "processed":
+		where = append(where, "r.processed = 1 and r.cancelled_at is null")
+	case "cancelled":
+		where = append(where, "r.cancelled_at is not null")
+	}
+
+	if search := strings.TrimSpace(f.Search); search != "" {
+		p := arg(containsPattern(search))
+		where = append(where, fmt.Sprintf(
+			"(r.first_name ilike %[1]s or r.last_name ilike %[1]s or r.email ilike %[1]s or r.phone ilike %[1]s)", p))
+	}
+
+	conditions := ""
+	if len(where) > 0 {
+		conditions = " where " + strings.Join(where, " and ")
+	}
+
+	var total int
+
+	err := m.DB.QueryRowContext(ctx, `select count(*) from reservations r`+conditions, args...).Scan(&total)
+	if err != nil {
+		return reservations, 0, err
+	}
+
+	order, ok := reservationSortColumns[f.Sort]
+	if !ok {
+		order = "r.start_date"
+	}
+
+	if f.Desc {
+		order += " desc"
+	}
+
+	perPage := f.PerPage
+	if perPage < 1 {
+		perPage = reservationsPerPage
+	}
+
+	page := f.Page
+	if page < 1 {
+		page = 1
+	}
+
 	query := `
 		select r.id,r.first_name,r.last_name,r.email,r.phone, r.start_date,
-		r.end_date, r.room_id,r.created_at, r.updated_at,
+		r.end_date, r.room_id,r.created_at, r.updated_at, r.processed,
+		coalesce(r.cancelled_at, '0001-01-01'::timestamp),
 		rm.id, rm.room_name
 		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		where r.processed = 0
-		order by r.start_date asc
-	`
+		left join rooms rm on (r.room_id = rm.id)` + conditions + `
+		order by ` + order + `, r.id
+		limit ` + arg(perPage) + ` offset ` + arg((page-1)*perPage)
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 
 	if err != nil {
-		return reservations, err
+		return reservations, 0, err
 	}
 
 	defer rows.Close()
@@ -375,26 +378,32 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Processed,
+			&i.CancelledAt,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
 
 		if err != nil {
-			return reservations, err
+			return reservations, 0, err
+		}
+
+		if i.CancelledAt.Year() == 1 {
+			i.CancelledAt = time.Time{}
 		}
 
 		reservations = append(reservations, i)
 	}
 
 	if err = rows.Err(); err != nil {
-		return reservations, err
+		return reservations, 0, err
 	}
 
-	return reservations, nil
+	return reservations, total, nil
 }
 
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where id = $6;`
@@ -408,14 +417,20 @@ func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
 	return nil
 }
 
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `delete from reservations where id = $1;`
 
 	_, err := m.DB.ExecContext(ctx, query, id)
 
+	// внешние ключи платежей и счетов не дают удалить бронирование (on delete restrict)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return repository.ErrReservationReferenced
+	}
+
 	if err != nil {
 		return err
 	}
@@ -424,8 +439,8 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 
 }
 
-func (m *postgresDBRepo) UpdateProcessedForReservation(id int, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id int, processed int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `update reservations set processed = $1 where id = $2;`
@@ -439,13 +454,13 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id int, processed int) er
 	return nil
 }
 
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
 
-	query := `select id,room_name,created_at,updated_at from rooms order by room_name`
+	query := `select id,room_name,price,created_at,updated_at from rooms order by room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 
@@ -460,6 +475,7 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&i.ID,
 			&i.RoomName,
+			&i.Price,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 		)
@@ -478,16 +494,75 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 	return rooms, nil
 }
 
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// GetCalendarRestrictions возвращает ограничения всех комнат, пересекающиеся с периодом start-end (конец не включается),
+// у бронирований заполняются данные гостя
+func (m *postgresDBRepo) GetCalendarRestrictions(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `select rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+			coalesce(r.first_name, ''), coalesce(r.last_name, ''), coalesce(r.updated_at, '0001-01-01'::timestamp)
+			from room_restrictions rr
+			left join reservations r on (r.id = rr.reservation_id)
+			where rr.end_date > $1 and rr.start_date < $2
+			order by rr.room_id, rr.start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.RoomRestriction
+		err := rows.Scan(
+			&i.ID,
+			&i.ReservationID,
+			&i.RestrictionID,
+			&i.RoomID,
+			&i.StartDate,
+			&i.EndDate,
+			&i.Reservation.FirstName,
+			&i.Reservation.LastName,
+			&i.Reservation.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		i.Reservation.ID = i.ReservationID
+
+		restrictions = append(restrictions, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
+	return queryRestrictions(ctx, m.DB, roomId, start, end)
+}
+
+// queryRestrictions читает ограничения комнаты за период. q - база или транзакция,
+// в транзакции UpdateRoomBlocks ограничения перечитываются под блокировкой комнаты
+func queryRestrictions(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
 
-	query := `select id,coalesce(reservation_id, 0),restriction_id,room_id,start_date,end_date
+	query := `select id,coalesce(reservation_id, 0),restriction_id,room_id,start_date,end_date,coalesce(maintenance_ticket_id, 0)
 			  from room_restrictions where end_date > $1 and $2 >= start_date and room_id = $3`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end, roomId)
+	rows, err := q.QueryContext(ctx, query, start, end, roomId)
 
 	if err != nil {
 		return nil, err
@@ -505,6 +580,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end tim
 			&i.RoomID,
 			&i.StartDate,
 			&i.EndDate,
+			&i.MaintenanceTicketID,
 		)
 
 		if err != nil {
@@ -521,8 +597,8 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end tim
 	return restrictions, nil
 }
 
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `insert into room_restrictions (start_date, end_date,room_id,restriction_id, created_at, updated_at) values ($1, $2, $3, $4,$5,$6)`
@@ -530,7 +606,6 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
 
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
@@ -538,8 +613,8 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 
 }
 
-func (m *postgresDBRepo) DeleteBlockById(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (m *postgresDBRepo) DeleteBlockById(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `delete from room_restrictions where id = $1;`
@@ -547,10 +622,2011 @@ func (m *postgresDBRepo) DeleteBlockById(id int) error {
 	_, err := m.DB.ExecContext(ctx, query, id)
 
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	return nil
 
 }
+
+// UpdateRoomBlocks снимает и ставит блокировки комнат из календаря в одной транзакции.
+// versions - отпечатки блокировок комнат за период start-end, которые видел администратор (blocks.Version):
+// под блокировкой комнат они сверяются заново, и если блокировки успели поменять - repository.ErrBlocksChanged.
+// Удаляются только блокировки (без бронирования); если новый день успели занять - repository.ErrRoomNotAvailable
+func (m *postgresDBRepo) UpdateRoomBlocks(ctx context.Context, versions map[int]string, start, end time.Time,
+	add []models.RoomRestriction, remove []int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// комнаты блокируются по возрастанию ID, чтобы два календаря не ждали друг друга
+	roomIDs := make([]int, 0, len(versions))
+	for id := range versions {
+		roomIDs = append(roomIDs, id)
+	}
+	sort.Ints(roomIDs)
+
+	for _, id := range roomIDs {
+		var roomID int
+
+		err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, id).Scan(&roomID)
+		if err != nil {
+			return err
+		}
+
+		current, err := queryRestrictions(ctx, tx, id, start, end)
+		if err != nil {
+			return err
+		}
+
+		if blocks.Version(current) != versions[id] {
+			return repository.ErrBlocksChanged
+		}
+	}
+
+	for _, id := range remove {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1 and reservation_id is null
+			and maintenance_ticket_id is null`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, b := range add {
+		var roomID, busy int
+
+		err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, b.RoomID).Scan(&roomID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `select count(*) from room_restrictions
+			where room_id = $1 and end_date > $2 and start_date < $3`, b.RoomID, b.StartDate, b.EndDate).Scan(&busy)
+		if err != nil {
+			return err
+		}
+
+		if busy > 0 {
+			return repository.ErrRoomNotAvailable
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+				created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`,
+			b.StartDate, b.EndDate, b.RoomID, b.RestrictionID, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// scanStayRules считывает правила проживания из результата запроса
+func scanStayRules(rows *sql.Rows) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	for rows.Next() {
+		var i models.StayRule
+		err := rows.Scan(
+			&i.ID,
+			&i.RuleName,
+			&i.RoomID,
+			&i.SeasonStart,
+			&i.SeasonEnd,
+			&i.MinNights,
+			&i.MaxNights,
+			&i.ArrivalDays,
+			&i.DepartureDays,
+			&i.MinLeadDays,
+			&i.MaxAdvanceDays,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return rules, err
+		}
+
+		// '0001-01-01' из coalesce превращаем обратно в нулевое время
+		if i.SeasonStart.Year() == 1 {
+			i.SeasonStart = time.Time{}
+		}
+		if i.SeasonEnd.Year() == 1 {
+			i.SeasonEnd = time.Time{}
+		}
+
+		rules = append(rules, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+const stayRulesSelect = `
+	select sr.id, sr.rule_name, coalesce(sr.room_id, 0),
+	coalesce(sr.season_start, '0001-01-01'::date), coalesce(sr.season_end, '0001-01-01'::date),
+	sr.min_nights, sr.max_nights, sr.arrival_days, sr.departure_days,
+	sr.min_lead_days, sr.max_advance_days, sr.created_at, sr.updated_at,
+	coalesce(rm.room_name, '')
+	from stay_rules sr
+	left join rooms rm on (sr.room_id = rm.id)
+`
+
+func (m *postgresDBRepo) AllStayRules(ctx context.Context) ([]models.StayRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stayRulesSelect+` order by sr.room_id nulls first, sr.season_start nulls first`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanStayRules(rows)
+}
+
+// GetStayRulesForRoom возвращает правила конкретной комнаты и общие правила для всех комнат (room_id is null)
+func (m *postgresDBRepo) GetStayRulesForRoom(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stayRulesSelect+` where sr.room_id is null or sr.room_id = $1`, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanStayRules(rows)
+}
+
+// GetStayRuleByID возвращает правило проживания, sql.ErrNoRows - если его нет
+func (m *postgresDBRepo) GetStayRuleByID(ctx context.Context, id int) (models.StayRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stayRulesSelect+` where sr.id = $1`, id)
+	if err != nil {
+		return models.StayRule{}, err
+	}
+
+	defer rows.Close()
+
+	rules, err := scanStayRules(rows)
+	if err != nil {
+		return models.StayRule{}, err
+	}
+
+	if len(rules) == 0 {
+		return models.StayRule{}, sql.ErrNoRows
+	}
+
+	return rules[0], nil
+}
+
+// InsertStayRule сохраняет правило проживания и возвращает его ID
+func (m *postgresDBRepo) InsertStayRule(ctx context.Context, rule models.StayRule) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into stay_rules (rule_name, room_id, season_start, season_end, min_nights, max_nights,
+				arrival_days, departure_days, min_lead_days, max_advance_days, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		rule.RuleName,
+		nullInt(rule.RoomID),
+		nullTime(rule.SeasonStart),
+		nullTime(rule.SeasonEnd),
+		rule.MinNights,
+		rule.MaxNights,
+		rule.ArrivalDays,
+		rule.DepartureDays,
+		rule.MinLeadDays,
+		rule.MaxAdvanceDays,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) DeleteStayRule(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from stay_rules where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// nullInt превращает нулевой id в null для необязательных внешних ключей
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// clearStayTimes превращает '0001-01-01' из coalesce обратно в нулевое время
+func clearStayTimes(res *models.Reservation) {
+	for _, t := range []*time.Time{&res.CancelledAt, &res.CheckedInAt, &res.CheckedOutAt, &res.NoShowAt} {
+		if t.Year() == 1 {
+			*t = time.Time{}
+		}
+	}
+}
+
+func nullJSON(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullTime превращает нулевое время в null для необязательных дат
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// GetAvailabilityCalendar возвращает доступность комнаты по дням с start по end (не включая end) одним запросом:
+// generate_series строит список ночей, а exists проверяет пересечение каждой ночи с бронированиями и блокировками.
+// Для несуществующей комнаты - sql.ErrNoRows
+func (m *postgresDBRepo) GetAvailabilityCalendar(ctx context.Context, roomID int, start, end time.Time) ([]models.DayAvailability, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var days []models.DayAvailability
+
+	// без этой проверки запрос ниже для неизвестной комнаты вернул бы пустой календарь
+	var exists bool
+	if err := m.DB.QueryRowContext(ctx, `select exists(select 1 from rooms where id = $1)`, roomID).Scan(&exists); err != nil {
+		return days, err
+	}
+
+	if !exists {
+		return days, sql.ErrNoRows
+	}
+
+	query := `
+		select d::date,
+		not exists (select 1 from room_restrictions rr
+			where rr.room_id = r.id and rr.start_date <= d::date and rr.end_date > d::date),
+		r.price
+		from rooms r
+		cross join generate_series($2::date, $3::date - interval '1 day', interval '1 day') d
+		where r.id = $1
+		order by d
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, start, end)
+	if err != nil {
+		return days, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.DayAvailability
+		err := rows.Scan(&i.Date, &i.Available, &i.Price)
+		if err != nil {
+			return days, err
+		}
+
+		days = append(days, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return days, err
+	}
+
+	return days, nil
+}
+
+func (m *postgresDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into payments (reservation_id, provider, provider_ref, kind, amount, refunded_amount,
+				currency, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Provider,
+		p.ProviderRef,
+		p.Kind,
+		p.Amount,
+		p.RefundedAmount,
+		p.Currency,
+		p.Status,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdatePayment обновляет статус, идентификатор у провайдера и сумму возврата
+func (m *postgresDBRepo) UpdatePayment(ctx context.Context, p models.Payment) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update payments set provider_ref = $1, status = $2, refunded_amount = $3, updated_at = $4 where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, query, p.ProviderRef, p.Status, p.RefundedAmount, time.Now(), p.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const paymentsSelect = `
+	select id, reservation_id, provider, provider_ref, kind, amount, refunded_amount,
+	currency, status, created_at, updated_at
+	from payments
+`
+
+func scanPayment(row interface{ Scan(dest ...any) error }) (models.Payment, error) {
+	var p models.Payment
+
+	err := row.Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Provider,
+		&p.ProviderRef,
+		&p.Kind,
+		&p.Amount,
+		&p.RefundedAmount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+
+	return p, err
+}
+
+func (m *postgresDBRepo) GetPaymentByID(ctx context.Context, id int) (models.Payment, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanPayment(m.DB.QueryRowContext(ctx, paymentsSelect+` where id = $1`, id))
+}
+
+func (m *postgresDBRepo) GetPaymentByProviderRef(ctx context.Context, provider, ref string) (models.Payment, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanPayment(m.DB.QueryRowContext(ctx, paymentsSelect+` where provider = $1 and provider_ref = $2`, provider, ref))
+}
+
+func (m *postgresDBRepo) GetPaymentsByReservationID(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var payments []models.Payment
+
+	rows, err := m.DB.QueryContext(ctx, paymentsSelect+` where reservation_id = $1 order by created_at`, reservationID)
+	if err != nil {
+		return payments, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return payments, err
+		}
+
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// GetInvoice возвращает выставленный счет по бронированию или sql.ErrNoRows, если счета еще нет
+func (m *postgresDBRepo) GetInvoice(ctx context.Context, reservationID int) (models.Invoice, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var inv models.Invoice
+
+	query := `select id, reservation_id, year, number, invoice_number, document, created_at, updated_at
+		from invoices where reservation_id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, reservationID).Scan(
+		&inv.ID,
+		&inv.ReservationID,
+		&inv.Year,
+		&inv.Number,
+		&inv.InvoiceNumber,
+		&inv.Document,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+
+	return inv, err
+}
+
+// IssueInvoice выставляет счет по бронированию со следующим номером в текущем году, а если счет уже есть - возвращает его.
+// Номер выдается под advisory-блокировкой транзакции, поэтому параллельные запросы не получат одинаковых номеров
+func (m *postgresDBRepo) IssueInvoice(ctx context.Context, reservationID int) (models.Invoice, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var inv models.Invoice
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select pg_advisory_xact_lock(hashtext('invoices'))`)
+	if err != nil {
+		return inv, err
+	}
+
+	query := `select id, reservation_id, year, number, invoice_number, document, created_at, updated_at
+		from invoices where reservation_id = $1`
+
+	err = tx.QueryRowContext(ctx, query, reservationID).Scan(
+		&inv.ID,
+		&inv.ReservationID,
+		&inv.Year,
+		&inv.Number,
+		&inv.InvoiceNumber,
+		&inv.Document,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+
+	if err == nil {
+		return inv, tx.Commit()
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	now := time.Now()
+	inv = models.Invoice{
+		ReservationID: reservationID,
+		Year:          now.Year(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = tx.QueryRowContext(ctx, `select coalesce(max(number), 0) + 1 from invoices where year = $1`, inv.Year).Scan(&inv.Number)
+	if err != nil {
+		return inv, err
+	}
+
+	inv.InvoiceNumber = invoice.FormatNumber(inv.Year, inv.Number)
+
+	stmt := `insert into invoices (reservation_id, year, number, invoice_number, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		inv.ReservationID,
+		inv.Year,
+		inv.Number,
+		inv.InvoiceNumber,
+		inv.CreatedAt,
+		inv.UpdatedAt,
+	).Scan(&inv.ID)
+
+	if err != nil {
+		return inv, err
+	}
+
+	return inv, tx.Commit()
+}
+
+// SaveInvoiceDocument сохраняет PDF счета, если он еще не сохранен, и возвращает сохраненный документ.
+// Если документ уже сохранил параллельный запрос, он не перезаписывается
+func (m *postgresDBRepo) SaveInvoiceDocument(ctx context.Context, invoiceID int, document []byte) ([]byte, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var stored []byte
+
+	err := m.DB.QueryRowContext(ctx, `update invoices set document = coalesce(document, $1), updated_at = $2
+		where id = $3 returning document`, document, time.Now(), invoiceID).Scan(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func (m *postgresDBRepo) AllTaxRules(ctx context.Context) ([]models.TaxRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, taxRulesSelect+` order by kind, name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanTaxRules(rows)
+}
+
+// GetTaxRuleByID возвращает налог или сбор, sql.ErrNoRows - если его нет
+func (m *postgresDBRepo) GetTaxRuleByID(ctx context.Context, id int) (models.TaxRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, taxRulesSelect+` where id = $1`, id)
+	if err != nil {
+		return models.TaxRule{}, err
+	}
+
+	defer rows.Close()
+
+	rules, err := scanTaxRules(rows)
+	if err != nil {
+		return models.TaxRule{}, err
+	}
+
+	if len(rules) == 0 {
+		return models.TaxRule{}, sql.ErrNoRows
+	}
+
+	return rules[0], nil
+}
+
+const taxRulesSelect = `
+	select id, name, kind, calculation, amount, per,
+	coalesce(valid_from, '0001-01-01'::date), coalesce(valid_to, '0001-01-01'::date), created_at, updated_at
+	from tax_rules
+`
+
+func scanTaxRules(rows *sql.Rows) ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+
+	for rows.Next() {
+		var i models.TaxRule
+		err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Kind,
+			&i.Calculation,
+			&i.Amount,
+			&i.Per,
+			&i.ValidFrom,
+			&i.ValidTo,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		)
+
+		if err != nil {
+			return rules, err
+		}
+
+		// '0001-01-01' из coalesce превращаем обратно в нулевое время
+		if i.ValidFrom.Year() == 1 {
+			i.ValidFrom = time.Time{}
+		}
+		if i.ValidTo.Year() == 1 {
+			i.ValidTo = time.Time{}
+		}
+
+		rules = append(rules, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertTaxRule сохраняет налог или сбор и возвращает его ID
+func (m *postgresDBRepo) InsertTaxRule(ctx context.Context, rule models.TaxRule) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into tax_rules (name, kind, calculation, amount, per, valid_from, valid_to, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		rule.Name,
+		rule.Kind,
+		rule.Calculation,
+		rule.Amount,
+		rule.Per,
+		nullTime(rule.ValidFrom),
+		nullTime(rule.ValidTo),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) DeleteTaxRule(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from tax_rules where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) GetReservationCharges(ctx context.Context, reservationID int) ([]models.ReservationCharge, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var charges []models.ReservationCharge
+
+	query := `select id, reservation_id, kind, description, quantity, unit_amount, amount, created_at, updated_at
+		from reservation_charges where reservation_id = $1 order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return charges, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ReservationCharge
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.Kind,
+			&c.Description,
+			&c.Quantity,
+			&c.UnitAmount,
+			&c.Amount,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+
+		if err != nil {
+			return charges, err
+		}
+
+		charges = append(charges, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return charges, err
+	}
+
+	return charges, nil
+}
+
+const promoCodesSelect = `
+	select pc.id, pc.code, pc.description, pc.calculation, pc.amount,
+	coalesce(pc.valid_from, '0001-01-01'::date), coalesce(pc.valid_to, '0001-01-01'::date),
+	coalesce(pc.stay_from, '0001-01-01'::date), coalesce(pc.stay_to, '0001-01-01'::date),
+	coalesce(pc.room_id, 0), pc.max_uses, pc.once_per_guest, pc.active,
+	(select count(*) from reservations r where r.promo_code_id = pc.id),
+	pc.created_at, pc.updated_at, coalesce(rm.room_name, '')
+	from promo_codes pc
+	left join rooms rm on (pc.room_id = rm.id)
+`
+
+// scanPromoCode считывает промокод из строки результата запроса promoCodesSelect
+func scanPromoCode(row interface{ Scan(dest ...any) error }) (models.PromoCode, error) {
+	var p models.PromoCode
+
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.Calculation,
+		&p.Amount,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.StayFrom,
+		&p.StayTo,
+		&p.RoomID,
+		&p.MaxUses,
+		&p.OncePerGuest,
+		&p.Active,
+		&p.Uses,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Room.RoomName,
+	)
+
+	// '0001-01-01' из coalesce превращаем обратно в нулевое время
+	for _, t := range []*time.Time{&p.ValidFrom, &p.ValidTo, &p.StayFrom, &p.StayTo} {
+		if t.Year() == 1 {
+			*t = time.Time{}
+		}
+	}
+
+	return p, err
+}
+
+func (m *postgresDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var codes []models.PromoCode
+
+	rows, err := m.DB.QueryContext(ctx, promoCodesSelect+` order by pc.active desc, pc.code`)
+	if err != nil {
+		return codes, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromoCode(rows)
+		if err != nil {
+			return codes, err
+		}
+
+		codes = append(codes, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return codes, err
+	}
+
+	return codes, nil
+}
+
+func (m *postgresDBRepo) GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanPromoCode(m.DB.QueryRowContext(ctx, promoCodesSelect+` where pc.id = $1`, id))
+}
+
+// GetPromoCodeByCode ищет промокод без учета регистра, если кода нет - возвращает sql.ErrNoRows
+func (m *postgresDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanPromoCode(m.DB.QueryRowContext(ctx, promoCodesSelect+` where upper(pc.code) = upper($1)`, code))
+}
+
+// InsertPromoCode сохраняет промокод и возвращает его ID
+func (m *postgresDBRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into promo_codes (code, description, calculation, amount, valid_from, valid_to, stay_from, stay_to,
+				room_id, max_uses, once_per_guest, active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.Calculation,
+		p.Amount,
+		nullTime(p.ValidFrom),
+		nullTime(p.ValidTo),
+		nullTime(p.StayFrom),
+		nullTime(p.StayTo),
+		nullInt(p.RoomID),
+		p.MaxUses,
+		p.OncePerGuest,
+		p.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdatePromoCode(ctx context.Context, p models.PromoCode) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update promo_codes set code = $1, description = $2, calculation = $3, amount = $4,
+				valid_from = $5, valid_to = $6, stay_from = $7, stay_to = $8, room_id = $9, max_uses = $10,
+				once_per_guest = $11, active = $12, updated_at = $13
+			where id = $14`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.Calculation,
+		p.Amount,
+		nullTime(p.ValidFrom),
+		nullTime(p.ValidTo),
+		nullTime(p.StayFrom),
+		nullTime(p.StayTo),
+		nullInt(p.RoomID),
+		p.MaxUses,
+		p.OncePerGuest,
+		p.Active,
+		time.Now(),
+		p.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) DeletePromoCode(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from promo_codes where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CountPromoCodeUses возвращает, сколько раз промокод использован всего и гостем с указанным email
+func (m *postgresDBRepo) CountPromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var total, guest int
+
+	query := `select count(*), count(*) filter (where lower(email) = lower($2))
+		from reservations where promo_code_id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, promoCodeID, email).Scan(&total, &guest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return total, guest, nil
+}
+
+// GetPromoCodeUses возвращает бронирования с промокодом и сумму скидки по каждому из них
+func (m *postgresDBRepo) GetPromoCodeUses(ctx context.Context, promoCodeID int) ([]models.PromoCodeUse, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var uses []models.PromoCodeUse
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, rm.room_name,
+		coalesce((select -sum(c.amount) from reservation_charges c
+			where c.reservation_id = r.id and c.kind = 'discount'), 0),
+		r.created_at
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.promo_code_id = $1
+		order by r.created_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, promoCodeID)
+	if err != nil {
+		return uses, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.PromoCodeUse
+		err := rows.Scan(
+			&u.ReservationID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&u.StartDate,
+			&u.EndDate,
+			&u.RoomName,
+			&u.Discount,
+			&u.CreatedAt,
+		)
+
+		if err != nil {
+			return uses, err
+		}
+
+		uses = append(uses, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return uses, err
+	}
+
+	return uses, nil
+}
+
+func (m *postgresDBRepo) InsertWaitlistEntry(ctx context.Context, e models.WaitlistEntry) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into waitlist_entries (name, email, start_date, end_date, room_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		e.Name,
+		e.Email,
+		e.StartDate,
+		e.EndDate,
+		nullInt(e.RoomID),
+		time.Now(),
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetPendingWaitlistEntries возвращает неоповещенные заявки на комнату roomID (или на любую комнату),
+// даты которых пересекаются с освободившимся периодом и заезд по которым еще не наступил
+func (m *postgresDBRepo) GetPendingWaitlistEntries(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := `select w.id, w.name, w.email, w.start_date, w.end_date, coalesce(w.room_id, 0),
+		w.created_at, w.updated_at, coalesce(rm.room_name, '')
+		from waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+		where w.notified_at is null
+		and (w.room_id is null or w.room_id = $1)
+		and w.start_date < $3 and w.end_date > $2
+		and w.start_date >= current_date
+		order by w.created_at`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, start, end)
+	if err != nil {
+		return entries, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.Name,
+			&e.Email,
+			&e.StartDate,
+			&e.EndDate,
+			&e.RoomID,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+			&e.Room.RoomName,
+		)
+
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+func (m *postgresDBRepo) MarkWaitlistNotified(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update waitlist_entries set notified_at = $1, updated_at = $1 where id = $2`,
+		time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetReservationsOnDate возвращает бронирования, которые захватывают день day: заезды, выезды и проживающих
+func (m *postgresDBRepo) GetReservationsOnDate(ctx context.Context, day time.Time) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, r.guests,
+		coalesce(r.checked_in_at, '0001-01-01'::timestamp), coalesce(r.checked_out_at, '0001-01-01'::timestamp),
+		coalesce(r.no_show_at, '0001-01-01'::timestamp),
+		rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.start_date <= $1 and r.end_date >= $1 and r.cancelled_at is null
+		order by rm.room_name, r.start_date
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, day)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Guests,
+			&i.CheckedInAt,
+			&i.CheckedOutAt,
+			&i.NoShowAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+
+		clearStayTimes(&i)
+
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// CountNewReservations возвращает количество необработанных бронирований (тех же, что показывает AllNewReservations)
+func (m *postgresDBRepo) CountNewReservations(ctx context.Context) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, `select count(*) from reservations where processed = 0 and cancelled_at is null`).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountBookedNights возвращает количество бронирований, пересекающихся с периодом start-end, и число
+// забронированных ночей внутри периода. Если bookedBefore не нулевое, учитываются только бронирования,
+// созданные до этого момента (для сравнения темпа бронирований с прошлым годом)
+func (m *postgresDBRepo) CountBookedNights(ctx context.Context, start, end, bookedBefore time.Time) (int, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations, nights int
+
+	query := `
+		select count(*), coalesce(sum(least(end_date, $2::date) - greatest(start_date, $1::date)), 0)
+		from reservations
+		where start_date < $2 and end_date > $1
+		and cancelled_at is null
+		and ($3::timestamp is null or created_at < $3)
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, start, end, nullTime(bookedBefore)).Scan(&reservations, &nights)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return reservations, nights, nil
+}
+
+// CancelReservation помечает бронирование отмененным и освобождает даты комнаты. Бронирование остается в базе для отчетов
+func (m *postgresDBRepo) CancelReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `update reservations set cancelled_at = $1, updated_at = $1
+		where id = $2 and cancelled_at is null`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetReportReservations возвращает бронирования для отчетов за период start-end: те, проживание по которым
+// пересекается с периодом, а также созданные или отмененные в этот период. Выручка берется из сохраненного
+// расчета (ночи и скидки), для старых бронирований без расчета - по цене комнаты
+func (m *postgresDBRepo) GetReportReservations(ctx context.Context, start, end time.Time) ([]models.ReportReservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.ReportReservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, r.room_id,
+		r.created_at, r.guests, r.source, r.nationality, coalesce(r.cancelled_at, '0001-01-01'::timestamp),
+		rm.id, rm.room_name, rm.price,
+		coalesce((select sum(c.amount) from reservation_charges c
+			where c.reservation_id = r.id and c.kind in ('room', 'discount')),
+			rm.price * (r.end_date - r.start_date))
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where (r.start_date < $2 and r.end_date > $1)
+		or (r.created_at >= $1 and r.created_at < $2)
+		or (r.cancelled_at >= $1 and r.cancelled_at < $2)
+		order by r.start_date, r.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.ReportReservation
+		res := &i.Reservation
+
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.CreatedAt,
+			&res.Guests,
+			&res.Source,
+			&res.Nationality,
+			&res.CancelledAt,
+			&res.Room.ID,
+			&res.Room.RoomName,
+			&res.Room.Price,
+			&i.Revenue,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+
+		if res.CancelledAt.Year() == 1 {
+			res.CancelledAt = time.Time{}
+		}
+
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// CreateReservation сохраняет бронирование, строки расчета и ограничение комнаты в одной транзакции.
+// Комната блокируется на время транзакции, поэтому два одновременных бронирования одних дат невозможны:
+// второе получит repository.ErrRoomNotAvailable
+func (m *postgresDBRepo) CreateReservation(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) (int, error) {
+	// Автоматическая отмена запроса, если он выполняется дольше таймаута из конфигурации или клиент закрыл соединение
+	// Защита от "зависания" при проблемах с БД
+	// Освобождение ресурсов (соединений с БД) при таймауте
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var roomID int
+
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID).Scan(&roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var busy int
+
+	err = tx.QueryRowContext(ctx, `select count(*) from room_restrictions
+		where room_id = $1 and end_date > $2 and start_date < $3`, res.RoomID, res.StartDate, res.EndDate).Scan(&busy)
+	if err != nil {
+		return 0, err
+	}
+
+	if busy > 0 {
+		return 0, repository.ErrRoomNotAvailable
+	}
+
+	// лимиты промокода проверяются еще раз под блокировкой кода: иначе два гостя одновременно
+	// проходят проверку в форме и оба получают последнее использование
+	if res.PromoCodeID > 0 {
+		var code models.PromoCode
+
+		err = tx.QueryRowContext(ctx, `select max_uses, once_per_guest from promo_codes where id = $1 for update`,
+			res.PromoCodeID).Scan(&code.MaxUses, &code.OncePerGuest)
+		if err != nil {
+			return 0, err
+		}
+
+		var usage promo.Usage
+
+		err = tx.QueryRowContext(ctx, `select count(*), count(*) filter (where lower(email) = lower($2))
+			from reservations where promo_code_id = $1`, res.PromoCodeID, res.Email).Scan(&usage.Total, &usage.Guest)
+		if err != nil {
+			return 0, err
+		}
+
+		if err = promo.CheckUsage(code, usage); err != nil {
+			return 0, err
+		}
+	}
+
+	guests := res.Guests
+	if guests < 1 {
+		guests = 1
+	}
+
+	source := res.Source
+	if source == "" {
+		source = "website"
+	}
+
+	var newID int
+
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id,
+				created_at, updated_at, guests, promo_code_id, source, nationality)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		time.Now(),
+		time.Now(),
+		guests,
+		nullInt(res.PromoCodeID),
+		source,
+		res.Nationality,
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `insert into reservation_charges (reservation_id, kind, description, quantity, unit_amount, amount,
+				created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	for _, c := range charges {
+		_, err = tx.ExecContext(ctx, stmt, newID, c.Kind, c.Description, c.Quantity, c.UnitAmount, c.Amount,
+			time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// restriction_id = 1 - бронирование (2 - блокировка владельцем)
+	_, err = tx.ExecContext(ctx, `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+				created_at, updated_at, restriction_id) values ($1, $2, $3, $4, $5, $6, $7)`,
+		res.StartDate, res.EndDate, res.RoomID, newID, time.Now(), time.Now(), 1)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateReservationStay переносит бронирование на другие даты или в другую комнату.
+// Занятость проверяется без учета самого бронирования; даты, ограничение комнаты и строки расчета
+// меняются в одной транзакции. Если новые даты заняты - repository.ErrRoomNotAvailable,
+// если бронирование изменилось после res.UpdatedAt или его уже нельзя переносить - repository.ErrReservationChanged
+func (m *postgresDBRepo) UpdateReservationStay(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var roomID int
+
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID).Scan(&roomID)
+	if err != nil {
+		return err
+	}
+
+	var busy int
+
+	err = tx.QueryRowContext(ctx, `select count(*) from room_restrictions
+		where room_id = $1 and end_date > $2 and start_date < $3
+		and (reservation_id is null or reservation_id <> $4)`,
+		res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&busy)
+	if err != nil {
+		return err
+	}
+
+	if busy > 0 {
+		return repository.ErrRoomNotAvailable
+	}
+
+	// если передан UpdatedAt, бронирование меняется, только пока его никто не изменил (оптимистичная блокировка).
+	// Отмененное, не приехавшее, выехавшее или уже со счетом бронирование не переносится, даже если обработчик
+	// успел проверить его раньше
+	result, err := tx.ExecContext(ctx, `update reservations set start_date = $1, end_date = $2, room_id = $3, updated_at = $4
+		where id = $5 and ($6::timestamp is null or updated_at = $6)
+		and cancelled_at is null and no_show_at is null and checked_out_at is null
+		and not exists (select 1 from invoices i where i.reservation_id = reservations.id)`,
+		res.StartDate, res.EndDate, res.RoomID, time.Now(), res.ID, nullTime(res.UpdatedAt))
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrReservationChanged
+	}
+
+	result, err = tx.ExecContext(ctx, `update room_restrictions set start_date = $1, end_date = $2, room_id = $3, updated_at = $4
+		where reservation_id = $5`, res.StartDate, res.EndDate, res.RoomID, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	// без ограничения комнату на новых датах ничто не занимает, и ее можно забронировать второй раз
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("reservation %d has no room restriction", res.ID)
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from reservation_charges where reservation_id = $1`, res.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into reservation_charges (reservation_id, kind, description, quantity, unit_amount, amount,
+				created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	for _, c := range charges {
+		_, err = tx.ExecContext(ctx, stmt, res.ID, c.Kind, c.Description, c.Quantity, c.UnitAmount, c.Amount,
+			time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertAuditEntry добавляет запись в журнал изменений. Журнал только пополняется, записи не меняются и не удаляются
+func (m *postgresDBRepo) InsertAuditEntry(ctx context.Context, e models.AuditEntry) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into audit_log (user_id, actor, action, entity, entity_id, before, after, ip, created_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		nullInt(e.UserID),
+		e.Actor,
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		nullJSON(e.Before),
+		nullJSON(e.After),
+		e.IP,
+		time.Now(),
+	)
+
+	return err
+}
+
+// GetAuditEntries возвращает страницу журнала изменений (новые сверху) и общее количество записей по фильтру
+func (m *postgresDBRepo) GetAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Entity != "" {
+		where = append(where, "a.entity = "+arg(f.Entity))
+	}
+
+	if f.EntityID > 0 {
+		where = append(where, "a.entity_id = "+arg(f.EntityID))
+	}
+
+	if f.UserID > 0 {
+		where = append(where, "a.user_id = "+arg(f.UserID))
+	}
+
+	if f.Action != "" {
+		where = append(where, "a.action = "+arg(f.Action))
+	}
+
+	cond := ""
+	if len(where) > 0 {
+		cond = " where " + strings.Join(where, " and ")
+	}
+
+	var total int
+
+	err := m.DB.QueryRowContext(ctx, "select count(*) from audit_log a"+cond, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	perPage := f.PerPage
+	if perPage <= 0 {
+		perPage = 50
+	}
+
+	page := f.Page
+	if page < 1 {
+		page = 1
+	}
+
+	query := `select a.id, coalesce(a.user_id, 0), a.actor, a.action, a.entity, a.entity_id,
+			coalesce(a.before::text, ''), coalesce(a.after::text, ''), a.ip, a.created_at,
+			coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, '')
+			from audit_log a
+			left join users u on (u.id = a.user_id)` + cond +
+		fmt.Sprintf(" order by a.created_at desc, a.id desc limit %s offset %s", arg(perPage), arg((page-1)*perPage))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.Actor,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&e.Before,
+			&e.After,
+			&e.IP,
+			&e.CreatedAt,
+			&e.User.FirstName,
+			&e.User.LastName,
+			&e.User.Email,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e.User.ID = e.UserID
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// CheckInReservation отмечает заезд гостя: фактическое время и предъявленный документ. Если бронирование
+// уже нельзя заселить - repository.ErrReservationChanged
+func (m *postgresDBRepo) CheckInReservation(ctx context.Context, id int, at time.Time, docType, docNumber string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update reservations set checked_in_at = $1, id_document_type = $2,
+		id_document_number = $3, processed = 1, updated_at = $4
+		where id = $5 and checked_in_at is null and cancelled_at is null and no_show_at is null`,
+		at, docType, docNumber, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	// гостя уже заселили, бронирование отменили или отметили неявку, пока открывали форму
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrReservationChanged
+	}
+
+	return nil
+}
+
+// CheckOutReservation отмечает выезд гостя. При раннем или позднем выезде дата выезда бронирования и ограничения комнаты
+// меняется на end в той же транзакции; если продление пересекается с другим бронированием - repository.ErrRoomNotAvailable
+func (m *postgresDBRepo) CheckOutReservation(ctx context.Context, id int, at, end time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var roomID, lockedRoomID int
+	var start time.Time
+
+	err = tx.QueryRowContext(ctx, `select room_id from reservations where id = $1`, id).Scan(&roomID)
+	if err != nil {
+		return err
+	}
+
+	// как и остальные операции с занятостью, сначала блокируется комната, потом бронирование
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, roomID).Scan(&lockedRoomID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `select room_id, start_date from reservations where id = $1 for update`, id).Scan(&roomID, &start)
+	if err != nil {
+		return err
+	}
+
+	// бронирование успели перенести в другую комнату, пока ждали блокировку
+	if roomID != lockedRoomID {
+		return repository.ErrReservationChanged
+	}
+
+	var busy int
+
+	err = tx.QueryRowContext(ctx, `select count(*) from room_restrictions
+		where room_id = $1 and end_date > $2 and start_date < $3
+		and (reservation_id is null or reservation_id <> $4)`, roomID, start, end, id).Scan(&busy)
+	if err != nil {
+		return err
+	}
+
+	if busy > 0 {
+		return repository.ErrRoomNotAvailable
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set checked_out_at = $1, end_date = $2, updated_at = $3
+		where id = $4`, at, end, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update room_restrictions set end_date = $1, updated_at = $2 where reservation_id = $3`,
+		end, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkNoShow отмечает, что гость не приехал. Комната, как и при отмене, освобождается. Если гость тем временем
+// заселился или бронирование закрыто - repository.ErrReservationChanged, и ничего не меняется
+func (m *postgresDBRepo) MarkNoShow(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `update reservations set no_show_at = $1, updated_at = $2
+		where id = $3 and checked_in_at is null and no_show_at is null and cancelled_at is null`, at, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	// гость успел заселиться или бронирование уже закрыто - комнату не освобождаем
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrReservationChanged
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUsersByRole возвращает пользователей с ролью role, отсортированных по имени
+func (m *postgresDBRepo) GetUsersByRole(ctx context.Context, role string) ([]models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	rows, err := m.DB.QueryContext(ctx, `select id, first_name, last_name, email, access_level, role, created_at, updated_at
+		from users where role = $1 order by first_name, last_name`, role)
+	if err != nil {
+		return users, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// InsertHousekeepingTasks сохраняет задачи уборки и возвращает количество новых или измененных.
+// На комнату и день бывает одна задача: уже созданная не меняется, кроме одного случая - уборка после выезда
+// заменяет уборку у проживающего гостя (ранний выезд), и комната снова становится грязной
+func (m *postgresDBRepo) InsertHousekeepingTasks(ctx context.Context, tasks []models.HousekeepingTask) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var count int
+
+	for _, t := range tasks {
+		result, err := tx.ExecContext(ctx, `insert into housekeeping_tasks
+			(room_id, reservation_id, task_date, kind, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)
+			on conflict (room_id, task_date) do update set kind = excluded.kind, status = excluded.status,
+			reservation_id = excluded.reservation_id, updated_at = excluded.updated_at
+			where housekeeping_tasks.kind = 'stay_over' and excluded.kind = 'departure'`,
+			t.RoomID, nullInt(t.ReservationID), t.TaskDate, t.Kind, t.Status, time.Now())
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		count += int(n)
+	}
+
+	return count, tx.Commit()
+}
+
+const housekeepingTaskColumns = `t.id, t.room_id, coalesce(t.reservation_id, 0), t.task_date, t.kind, t.status,
+	coalesce(t.assigned_to, 0), t.created_at, t.updated_at, rm.id, rm.room_name,
+	coalesce(u.first_name, ''), coalesce(u.last_name, '')
+	from housekeeping_tasks t
+	left join rooms rm on (rm.id = t.room_id)
+	left join users u on (u.id = t.assigned_to)`
+
+func scanHousekeepingTask(row interface{ Scan(...interface{}) error }) (models.HousekeepingTask, error) {
+	var t models.HousekeepingTask
+
+	err := row.Scan(
+		&t.ID,
+		&t.RoomID,
+		&t.ReservationID,
+		&t.TaskDate,
+		&t.Kind,
+		&t.Status,
+		&t.AssignedTo,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.Room.ID,
+		&t.Room.RoomName,
+		&t.User.FirstName,
+		&t.User.LastName,
+	)
+	t.User.ID = t.AssignedTo
+
+	return t, err
+}
+
+func (m *postgresDBRepo) queryHousekeepingTasks(ctx context.Context, query string, args ...interface{}) ([]models.HousekeepingTask, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var tasks []models.HousekeepingTask
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return tasks, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanHousekeepingTask(rows)
+		if err != nil {
+			return tasks, err
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetHousekeepingTasks возвращает задачи уборки на день
+func (m *postgresDBRepo) GetHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error) {
+	return m.queryHousekeepingTasks(ctx, `select `+housekeepingTaskColumns+`
+		where t.task_date = $1 order by rm.room_name`, day)
+}
+
+// GetLatestHousekeepingTasks возвращает последнюю задачу уборки каждой комнаты не позже дня day, по ней видно, убрана ли комната
+func (m *postgresDBRepo) GetLatestHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error) {
+	return m.queryHousekeepingTasks(ctx, `select distinct on (t.room_id) `+housekeepingTaskColumns+`
+		where t.task_date <= $1 order by t.room_id, t.task_date desc, t.id desc`, day)
+}
+
+func (m *postgresDBRepo) GetHousekeepingTaskByID(ctx context.Context, id int) (models.HousekeepingTask, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+housekeepingTaskColumns+` where t.id = $1`, id)
+
+	return scanHousekeepingTask(row)
+}
+
+// UpdateHousekeepingTask сохраняет состояние задачи и назначенную горничную
+func (m *postgresDBRepo) UpdateHousekeepingTask(ctx context.Context, t models.HousekeepingTask) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update housekeeping_tasks set status = $1, assigned_to = $2, updated_at = $3 where id = $4`,
+		t.Status, nullInt(t.AssignedTo), time.Now(), t.ID)
+
+	return err
+}
+
+// GetMaintenanceTickets возвращает заявки на ремонт, сначала срочные и новые. open - только незакрытые
+func (m *postgresDBRepo) GetMaintenanceTickets(ctx context.Context, open bool) ([]models.MaintenanceTicket, error) {
+	query := `select ` + maintenanceTicketColumns
+
+	if open {
+		query += ` where t.status <> 'closed'`
+	}
+
+	query += ` order by t.status = 'closed', case t.priority when 'urgent' then 0 when 'high' then 1 when 'normal' then 2 else 3 end,
+		t.start_date desc, t.id desc`
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var tickets []models.MaintenanceTicket
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return tickets, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanMaintenanceTicket(rows)
+		if err != nil {
+			return tickets, err
+		}
+
+		tickets = append(tickets, t)
+	}
+
+	return tickets, rows.Err()
+}
+
+func (m *postgresDBRepo) GetMaintenanceTicketByID(ctx context.Context, id int) (models.MaintenanceTicket, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+maintenanceTicketColumns+` where t.id = $1`, id)
+
+	return scanMaintenanceTicket(row)
+}
+
+const maintenanceTicketColumns = `t.id, t.room_id, t.description, t.priority, t.status, t.out_of_order, t.start_date,
+	coalesce(t.expected_resolution, '0001-01-01'::date), coalesce(t.closed_at, '0001-01-01'::timestamp),
+	t.created_at, t.updated_at, rm.id, rm.room_name
+	from maintenance_tickets t
+	left join rooms rm on (rm.id = t.room_id)`
+
+func scanMaintenanceTicket(row interface{ Scan(...interface{}) error }) (models.MaintenanceTicket, error) {
+	var t models.MaintenanceTicket
+
+	err := row.Scan(
+		&t.ID,
+		&t.RoomID,
+		&t.Description,
+		&t.Priority,
+		&t.Status,
+		&t.OutOfOrder,
+		&t.StartDate,
+		&t.ExpectedResolution,
+		&t.ClosedAt,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.Room.ID,
+		&t.Room.RoomName,
+	)
+
+	if t.ExpectedResolution.Year() == 1 {
+		t.ExpectedResolution = time.Time{}
+	}
+
+	if t.ClosedAt.Year() == 1 {
+		t.ClosedAt = time.Time{}
+	}
+
+	return t, err
+}
+
+// SaveMaintenanceTicket создает (t.ID == 0) или обновляет заявку и в той же транзакции заменяет ее блокировку комнаты:
+// прежняя снимается, block (если он есть) ставится. Если на эти дни комната занята, возвращается
+// repository.ErrRoomNotAvailable и ничего не сохраняется
+func (m *postgresDBRepo) SaveMaintenanceTicket(ctx context.Context, t models.MaintenanceTicket, block *models.RoomRestriction) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	if t.ID == 0 {
+		err = tx.QueryRowContext(ctx, `insert into maintenance_tickets (room_id, description, priority, status, out_of_order,
+			start_date, expected_resolution, closed_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) returning id`,
+			t.RoomID, t.Description, t.Priority, t.Status, t.OutOfOrder, t.StartDate, nullTime(t.ExpectedResolution),
+			nullTime(t.ClosedAt), time.Now()).Scan(&t.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, `update maintenance_tickets set room_id = $1, description = $2, priority = $3, status = $4,
+			out_of_order = $5, start_date = $6, expected_resolution = $7, closed_at = $8, updated_at = $9 where id = $10`,
+			t.RoomID, t.Description, t.Priority, t.Status, t.OutOfOrder, t.StartDate, nullTime(t.ExpectedResolution),
+			nullTime(t.ClosedAt), time.Now(), t.ID)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where maintenance_ticket_id = $1`, t.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if block != nil {
+		var roomID, busy int
+
+		err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 for update`, block.RoomID).Scan(&roomID)
+		if err != nil {
+			return 0, err
+		}
+
+		err = tx.QueryRowContext(ctx, `select count(*) from room_restrictions
+			where room_id = $1 and end_date > $2 and start_date < $3`, block.RoomID, block.StartDate, block.EndDate).Scan(&busy)
+		if err != nil {
+			return 0, err
+		}
+
+		if busy > 0 {
+			return 0, repository.ErrRoomNotAvailable
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+			maintenance_ticket_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $6)`,
+			block.StartDate, block.EndDate, block.RoomID, block.RestrictionID, t.ID, time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return t.ID, tx.Commit()
+}
@@ -1,112 +1,872 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/krasnov23/guest-house-golang/internal/access"
+	"github.com/krasnov23/guest-house-golang/internal/blocks"
+	"github.com/krasnov23/guest-house-golang/internal/housekeeping"
+	"github.com/krasnov23/guest-house-golang/internal/invoice"
 	"github.com/krasnov23/guest-house-golang/internal/models"
+	"github.com/krasnov23/guest-house-golang/internal/promo"
+	"github.com/krasnov23/guest-house-golang/internal/repository"
+	"strings"
 	"time"
 )
 
-func (m *testDBRepo) AllUsers() bool {
+// Фикстуры тестового репозитория: даты, от которых зависят его ответы. Тесты обработчиков строят даты
+// от этих значений, чтобы было видно, на какое правило тестового репозитория опирается проверка
+var (
+	// TestFreeDate - начало года, в котором свободны все комнаты; в любые другие даты свободных комнат нет
+	TestFreeDate = time.Date(2080, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// TestBookedDate - начало месяца с бронированиями и блокировками из testRestrictions:
+	// комната 1 занята две ночи с этой даты, комната 2 - пять ночей с третьего числа
+	TestBookedDate = time.Date(2070, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// TestBlockTakenDate - блокировку на этот день успевают занять между проверкой и сохранением
+	TestBlockTakenDate = TestBookedDate.AddDate(0, 0, 24)
+
+	// TestBlocksChangedDate - пока ставится блокировка на этот день, другой администратор меняет блокировки комнаты
+	TestBlocksChangedDate = TestBlockTakenDate.AddDate(0, 0, 1)
+
+	// TestMinStayDate - начало сезона длиной в год, в котором комната 1 сдается минимум на TestMinNights ночей
+	TestMinStayDate = time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// TestMinNights - минимум ночей для комнаты 1 в сезоне с TestMinStayDate
+const TestMinNights = 3
+
+// testAllFree сообщает, что период начинается в году TestFreeDate, когда все комнаты свободны
+func testAllFree(start time.Time) bool {
+	return !start.Before(TestFreeDate) && start.Before(TestFreeDate.AddDate(1, 0, 0))
+}
+
+// testRoomTaken сообщает, что период пересекается с бронированием комнаты 1 с TestBookedDate
+func testRoomTaken(roomID int, start, end time.Time) bool {
+	return roomID == 1 && start.Before(TestBookedDate.AddDate(0, 0, 2)) && end.After(TestBookedDate)
+}
+
+func (m *testDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) CreateReservation(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) (int, error) {
 	if res.RoomID == 2 {
 		return 0, errors.New("cannot insert a reservation")
 	}
 
-	return 1, nil
-}
+	if testRoomTaken(res.RoomID, res.StartDate, res.EndDate) {
+		return 0, repository.ErrRoomNotAvailable
+	}
 
-func (m *testDBRepo) InsertRoomRestriction(rr models.RoomRestriction) error {
-	if rr.RoomID == 3 {
-		return errors.New("cannot insert a reservation")
+	if res.PromoCodeID == 4 {
+		return 0, promo.ErrUsageLimit
 	}
 
-	return nil
+	return 1, nil
 }
 
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(roomID int, start, end time.Time) (bool, error) {
-	return false, nil
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, roomID int, start, end time.Time) (bool, error) {
+	return testAllFree(start), nil
 }
 
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 	var rooms []models.Room
+
+	if testAllFree(start) {
+		return m.AllRooms(ctx)
+	}
+
 	return rooms, nil
 }
 
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
 
 	if id > 2 {
 		return room, errors.New("id out of range")
 	}
 
+	rooms, _ := m.AllRooms(ctx)
+	for _, r := range rooms {
+		if r.ID == id {
+			room = r
+		}
+	}
+
 	return room, nil
 }
 
-func (m *testDBRepo) GetUserById(userId int) (models.User, error) {
+func (m *testDBRepo) GetUserById(ctx context.Context, userId int) (models.User, error) {
 	var user models.User
 
 	return user, nil
 }
 
-func (m *testDBRepo) UpdateUser(user models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, user models.User) error {
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, password string) (int, string, error) {
+// Authenticate: me@here.ca - администратор, maid@here.ca - горничная с ID 2
+func (m *testDBRepo) Authenticate(ctx context.Context, email, password string) (int, string, error) {
 
 	if email == "me@here.ca" {
-		return 1, "", nil
+		return 1, access.RoleAdmin, nil
+	}
+
+	if email == "maid@here.ca" {
+		return 2, housekeeping.Role, nil
 	}
 
 	return 0, "", errors.New("invalid email")
 }
 
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations, nil
+// AllReservations: 30 бронирований, у четных id бронирование обработано. Фильтруется только по статусу и фамилии,
+// сортировка - только по id
+func (m *testDBRepo) AllReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error) {
+	var found []models.Reservation
+
+	for id := 1; id <= 30; id++ {
+		res := models.Reservation{
+			ID:        id,
+			FirstName: "Guest",
+			LastName:  fmt.Sprintf("Guest%02d", id),
+			StartDate: time.Date(2050, 1, id, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, id+1, 0, 0, 0, 0, time.UTC),
+			RoomID:    1,
+			Processed: 1 - id%2,
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+		}
+
+		if f.Status == "new" && res.Processed == 1 || f.Status == "processed" && res.Processed == 0 {
+			continue
+		}
+
+		if f.Search != "" && !strings.Contains(strings.ToLower(res.LastName), strings.ToLower(f.Search)) {
+			continue
+		}
+
+		found = append(found, res)
+	}
+
+	if f.Desc {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+
+	perPage := f.PerPage
+	if perPage < 1 {
+		perPage = 25
+	}
+
+	page := f.Page
+	if page < 1 {
+		page = 1
+	}
+
+	start := (page - 1) * perPage
+	if start > len(found) {
+		start = len(found)
+	}
+
+	end := start + perPage
+	if end > len(found) {
+		end = len(found)
+	}
+
+	return found[start:end], len(found), nil
 }
 
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations, nil
+func (m *testDBRepo) AllNewReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error) {
+	f.Status = "new"
+	return m.AllReservations(ctx, f)
 }
 
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
 	var res models.Reservation
+
+	if id > 1000 {
+		return res, errors.New("reservation not found")
+	}
+
+	if id == 1 {
+		res = models.Reservation{
+			ID:        1,
+			FirstName: "John",
+			LastName:  "Smith",
+			Email:     "john@smith.com",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			RoomID:    1,
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters", Price: 12000},
+		}
+	}
+
+	// 4, 5 и 6 - бронирования для стойки регистрации: заезд сегодня, проживающий гость и гость, который не приехал вчера
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch id {
+	case 4:
+		res = models.Reservation{ID: 4, FirstName: "Ann", LastName: "Lee", Email: "ann@lee.com",
+			StartDate: today, EndDate: today.AddDate(0, 0, 2), RoomID: 1,
+			Room: models.Room{ID: 1, RoomName: "General's Quarters", Price: 12000}}
+	case 5:
+		res = models.Reservation{ID: 5, FirstName: "Bob", LastName: "Ray", Email: "bob@ray.com",
+			StartDate: today.AddDate(0, 0, -1), EndDate: today.AddDate(0, 0, 2), RoomID: 2,
+			CheckedInAt: today.AddDate(0, 0, -1).Add(15 * time.Hour), IDDocumentType: "passport", IDDocumentNumber: "AB123",
+			Room: models.Room{ID: 2, RoomName: "Majors Suite", Price: 10000}}
+	case 6:
+		res = models.Reservation{ID: 6, FirstName: "Tom", LastName: "Fox", Email: "tom@fox.com",
+			StartDate: today.AddDate(0, 0, -1), EndDate: today.AddDate(0, 0, 1), RoomID: 2,
+			Room: models.Room{ID: 2, RoomName: "Majors Suite", Price: 10000}}
+	// 10 - как 6, но пока администратор открывал форму, гостя заселил другой сотрудник
+	case 10:
+		res = models.Reservation{ID: 10, FirstName: "Max", LastName: "Orr", Email: "max@orr.com",
+			StartDate: today.AddDate(0, 0, -1), EndDate: today.AddDate(0, 0, 1), RoomID: 2,
+			Room: models.Room{ID: 2, RoomName: "Majors Suite", Price: 10000}}
+	// 7 - бронирование без платежей и счета, его можно переносить; 8 - гость уже выехал, 9 - не приехал
+	case 7, 8, 9:
+		res = models.Reservation{ID: id, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			RoomID: 1, Room: models.Room{ID: 1, RoomName: "General's Quarters", Price: 12000}}
+
+		if id == 8 {
+			res.CheckedOutAt = res.EndDate.Add(11 * time.Hour)
+		}
+
+		if id == 9 {
+			res.NoShowAt = res.EndDate
+		}
+	}
+
+	if res.ID != 0 {
+		res.UpdatedAt = testUpdatedAt
+	}
+
 	return res, nil
 }
 
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	return nil
+}
+
+// testUpdatedAt - время последнего изменения всех тестовых бронирований
+var testUpdatedAt = time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func (m *testDBRepo) UpdateReservationStay(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) error {
+	if !res.UpdatedAt.IsZero() && !res.UpdatedAt.Equal(testUpdatedAt) {
+		return repository.ErrReservationChanged
+	}
+
+	if testRoomTaken(res.RoomID, res.StartDate, res.EndDate) {
+		return repository.ErrRoomNotAvailable
+	}
+
 	return nil
 }
 
-func (m *testDBRepo) DeleteReservation(id int) error {
+// DeleteReservation: у бронирования 1 есть платеж и счет, удалить его нельзя
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if id == 1 {
+		return repository.ErrReservationReferenced
+	}
+
 	return nil
 }
 
-func (m *testDBRepo) UpdateProcessedForReservation(id int, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id int, processed int) error {
 	return nil
 }
 
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
-	var rooms []models.Room
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", Price: 12000},
+		{ID: 2, RoomName: "Majors Suite"},
+	}
 
 	return rooms, nil
 }
 
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+// testBookedDay - день месяца TestBookedDate
+func testBookedDay(day int) time.Time {
+	return TestBookedDate.AddDate(0, 0, day-1)
+}
+
+// testRestrictions - бронирования в месяце TestBookedDate: комната 1 занята 1-2 числа, комната 2 - с 3 по 7
+var testRestrictions = []models.RoomRestriction{
+	{ID: 1, RoomID: 1, ReservationID: 1, RestrictionID: 1, StartDate: testBookedDay(1), EndDate: testBookedDay(3)},
+	{ID: 2, RoomID: 2, ReservationID: 2, RestrictionID: 1, StartDate: testBookedDay(3), EndDate: testBookedDay(8)},
+	// блокировка владельцем
+	{ID: 3, RoomID: 1, RestrictionID: 2, StartDate: testBookedDay(20), EndDate: testBookedDay(21)},
+	// комната закрыта на ремонт по заявке 1
+	{ID: 4, RoomID: 2, RestrictionID: 2, MaintenanceTicketID: 1, StartDate: testBookedDay(10), EndDate: testBookedDay(13)},
+}
+
+func (m *testDBRepo) GetCalendarRestrictions(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	for _, rr := range testRestrictions {
+		if rr.EndDate.After(start) && rr.StartDate.Before(end) {
+			rr.Reservation = models.Reservation{ID: rr.ReservationID, FirstName: "Guest", LastName: fmt.Sprintf("%02d", rr.ReservationID),
+				UpdatedAt: testUpdatedAt}
+			restrictions = append(restrictions, rr)
+		}
+	}
+
+	return restrictions, nil
+}
+
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
 
+	for _, rr := range testRestrictions {
+		if rr.RoomID == roomId && rr.EndDate.After(start) && !rr.StartDate.After(end) {
+			restrictions = append(restrictions, rr)
+		}
+	}
+
 	return restrictions, nil
 }
 
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) UpdateRoomBlocks(ctx context.Context, versions map[int]string, start, end time.Time,
+	add []models.RoomRestriction, remove []int) error {
+	for roomID, version := range versions {
+		current, _ := m.GetRestrictionsForRoomByDate(ctx, roomID, start, end)
+		if blocks.Version(current) != version {
+			return repository.ErrBlocksChanged
+		}
+	}
+
+	for _, b := range add {
+		if b.StartDate.Equal(TestBlockTakenDate) {
+			return repository.ErrRoomNotAvailable
+		}
+
+		if b.StartDate.Equal(TestBlocksChangedDate) {
+			return repository.ErrBlocksChanged
+		}
+	}
+
+	return nil
+}
+
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteBlockById(ctx context.Context, id int) error {
+	return nil
+}
+
+// testStayRules: в сезоне с TestMinStayDate комната 1 сдается минимум на TestMinNights ночей
+var testStayRules = []models.StayRule{
+	{ID: 1, RoomID: 1, SeasonStart: TestMinStayDate, SeasonEnd: TestMinStayDate.AddDate(1, 0, 0), MinNights: TestMinNights},
+}
+
+func (m *testDBRepo) AllStayRules(ctx context.Context) ([]models.StayRule, error) {
+	return testStayRules, nil
+}
+
+func (m *testDBRepo) GetStayRulesForRoom(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	for _, rule := range testStayRules {
+		if rule.RoomID == 0 || rule.RoomID == roomID {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (m *testDBRepo) GetStayRuleByID(ctx context.Context, id int) (models.StayRule, error) {
+	for _, rule := range testStayRules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+
+	return models.StayRule{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertStayRule(ctx context.Context, rule models.StayRule) (int, error) {
+	return len(testStayRules) + 1, nil
+}
+
+func (m *testDBRepo) DeleteStayRule(ctx context.Context, id int) error {
 	return nil
 }
 
-func (m *testDBRepo) DeleteBlockById(id int) error {
+func (m *testDBRepo) GetAvailabilityCalendar(ctx context.Context, roomID int, start, end time.Time) ([]models.DayAvailability, error) {
+	var days []models.DayAvailability
+
+	if roomID > 2 {
+		return days, sql.ErrNoRows
+	}
+
+	price := 0
+	if roomID == 1 {
+		price = 12000
+	}
+
+	restrictions, _ := m.GetRestrictionsForRoomByDate(ctx, roomID, start, end)
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		available := true
+		for _, rr := range restrictions {
+			if !rr.StartDate.After(d) && rr.EndDate.After(d) {
+				available = false
+			}
+		}
+
+		days = append(days, models.DayAvailability{Date: d, Available: available, Price: price})
+	}
+
+	return days, nil
+}
+
+func (m *testDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdatePayment(ctx context.Context, p models.Payment) error {
 	return nil
 }
+
+// GetPaymentByID: 1 - списанный депозит, 2 - депозит, уже возвращенный полностью, 3 - только авторизованный
+func (m *testDBRepo) GetPaymentByID(ctx context.Context, id int) (models.Payment, error) {
+	if id < 1 || id > 3 {
+		return models.Payment{}, errors.New("payment not found")
+	}
+
+	payment := models.Payment{ID: id, ReservationID: 1, Provider: "fake", ProviderRef: fmt.Sprintf("fake_%d", id),
+		Kind: "deposit", Amount: 3600, Currency: "USD", Status: "captured"}
+
+	switch id {
+	case 2:
+		payment.RefundedAmount = payment.Amount
+	case 3:
+		payment.Status = "authorized"
+	}
+
+	return payment, nil
+}
+
+func (m *testDBRepo) GetPaymentByProviderRef(ctx context.Context, provider, ref string) (models.Payment, error) {
+	if ref != "fake_1" {
+		return models.Payment{}, errors.New("payment not found")
+	}
+
+	return m.GetPaymentByID(ctx, 1)
+}
+
+func (m *testDBRepo) GetPaymentsByReservationID(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	if reservationID == 1 {
+		p, _ := m.GetPaymentByID(ctx, 1)
+		payments = append(payments, p)
+	}
+
+	return payments, nil
+}
+
+// GetInvoice: счет выставлен только по оплаченному бронированию 1
+// TestInvoiceDocument - PDF, сохраненный при выставлении счета по бронированию 5
+var TestInvoiceDocument = []byte("%PDF-1.4 issued")
+
+// GetInvoice: счет по бронированию 1 еще без сохраненного документа, по бронированию 5 - с документом
+func (m *testDBRepo) GetInvoice(ctx context.Context, reservationID int) (models.Invoice, error) {
+	switch reservationID {
+	case 1:
+		return m.IssueInvoice(ctx, reservationID)
+	case 5:
+		return models.Invoice{ID: 2, ReservationID: 5, Year: 2050, Number: 2,
+			InvoiceNumber: invoice.FormatNumber(2050, 2), Document: TestInvoiceDocument}, nil
+	}
+
+	return models.Invoice{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) IssueInvoice(ctx context.Context, reservationID int) (models.Invoice, error) {
+	return models.Invoice{ID: 1, ReservationID: reservationID, Year: 2050, Number: 1,
+		InvoiceNumber: invoice.FormatNumber(2050, 1)}, nil
+}
+
+func (m *testDBRepo) SaveInvoiceDocument(ctx context.Context, invoiceID int, document []byte) ([]byte, error) {
+	return document, nil
+}
+
+var testTaxRules = []models.TaxRule{
+	{ID: 1, Name: "VAT", Kind: "tax", Calculation: "percent", Amount: 1000},
+	{ID: 2, Name: "Cleaning fee", Kind: "fee", Calculation: "fixed", Amount: 2000, Per: "stay"},
+}
+
+func (m *testDBRepo) AllTaxRules(ctx context.Context) ([]models.TaxRule, error) {
+	return testTaxRules, nil
+}
+
+func (m *testDBRepo) GetTaxRuleByID(ctx context.Context, id int) (models.TaxRule, error) {
+	for _, rule := range testTaxRules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+
+	return models.TaxRule{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertTaxRule(ctx context.Context, rule models.TaxRule) (int, error) {
+	return len(testTaxRules) + 1, nil
+}
+
+func (m *testDBRepo) DeleteTaxRule(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) GetReservationCharges(ctx context.Context, reservationID int) ([]models.ReservationCharge, error) {
+	var charges []models.ReservationCharge
+
+	if reservationID == 1 {
+		charges = append(charges,
+			models.ReservationCharge{ReservationID: 1, Kind: "room", Description: "Accommodation - General's Quarters",
+				Quantity: 1, UnitAmount: 12000, Amount: 12000},
+			models.ReservationCharge{ReservationID: 1, Kind: "tax", Description: "VAT", Quantity: 1,
+				UnitAmount: 1200, Amount: 1200},
+		)
+	}
+
+	return charges, nil
+}
+
+// testPromoCodes: SAVE10 - скидка 10%, USED - лимит уже исчерпан, ROOM2 - только для комнаты 2,
+// LAST - последнее использование забирает другое бронирование, пока гость заполняет форму
+var testPromoCodes = []models.PromoCode{
+	{ID: 1, Code: "SAVE10", Calculation: "percent", Amount: 1000, Active: true, OncePerGuest: true},
+	{ID: 2, Code: "USED", Calculation: "fixed", Amount: 1000, Active: true, MaxUses: 1, Uses: 1},
+	{ID: 3, Code: "ROOM2", Calculation: "fixed", Amount: 1000, Active: true, RoomID: 2},
+	{ID: 4, Code: "LAST", Calculation: "fixed", Amount: 1000, Active: true, MaxUses: 1},
+}
+
+func (m *testDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	return testPromoCodes, nil
+}
+
+func (m *testDBRepo) GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error) {
+	for _, p := range testPromoCodes {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	for _, p := range testPromoCodes {
+		if p.Code == code {
+			return p, nil
+		}
+	}
+
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	return len(testPromoCodes) + 1, nil
+}
+
+func (m *testDBRepo) UpdatePromoCode(ctx context.Context, p models.PromoCode) error {
+	return nil
+}
+
+func (m *testDBRepo) DeletePromoCode(ctx context.Context, id int) error {
+	return nil
+}
+
+// CountPromoCodeUses: гость used@guest.com уже пользовался кодом SAVE10
+func (m *testDBRepo) CountPromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	p, err := m.GetPromoCodeByID(ctx, promoCodeID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	guest := 0
+	if promoCodeID == 1 && email == "used@guest.com" {
+		guest = 1
+	}
+
+	return p.Uses + guest, guest, nil
+}
+
+func (m *testDBRepo) GetPromoCodeUses(ctx context.Context, promoCodeID int) ([]models.PromoCodeUse, error) {
+	var uses []models.PromoCodeUse
+
+	if promoCodeID == 2 {
+		uses = append(uses, models.PromoCodeUse{ReservationID: 1, FirstName: "John", LastName: "Smith",
+			Email: "john@smith.com", RoomName: "General's Quarters", Discount: 1000})
+	}
+
+	return uses, nil
+}
+
+func (m *testDBRepo) InsertWaitlistEntry(ctx context.Context, e models.WaitlistEntry) error {
+	if e.Email == "fail@guest.com" {
+		return errors.New("cannot insert a waitlist entry")
+	}
+
+	return nil
+}
+
+// testWaitlist - заявки в листе ожидания на год TestFreeDate, когда все комнаты свободны
+var testWaitlist = []models.WaitlistEntry{
+	{ID: 1, Name: "Jane", Email: "jane@guest.com", RoomID: 1,
+		StartDate: TestFreeDate, EndDate: TestFreeDate.AddDate(0, 0, 2)},
+	{ID: 2, Name: "Jack", Email: "jack@guest.com",
+		StartDate: TestFreeDate.AddDate(0, 0, 1), EndDate: TestFreeDate.AddDate(0, 0, 3)},
+	{ID: 3, Name: "Jill", Email: "jill@guest.com", RoomID: 2,
+		StartDate: TestFreeDate.AddDate(0, 2, 0), EndDate: TestFreeDate.AddDate(0, 2, 4)},
+}
+
+func (m *testDBRepo) GetPendingWaitlistEntries(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	for _, e := range testWaitlist {
+		if e.RoomID != 0 && e.RoomID != roomID {
+			continue
+		}
+
+		if e.StartDate.Before(end) && e.EndDate.After(start) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+func (m *testDBRepo) MarkWaitlistNotified(ctx context.Context, id int) error {
+	return nil
+}
+
+// GetReservationsOnDate: на день day есть один заезд, один выезд и один проживающий гость
+func (m *testDBRepo) GetReservationsOnDate(ctx context.Context, day time.Time) ([]models.Reservation, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	reservations := []models.Reservation{
+		{ID: 1, FirstName: "John", LastName: "Smith", StartDate: day, EndDate: day.AddDate(0, 0, 2), RoomID: 1,
+			Room: models.Room{ID: 1, RoomName: "General's Quarters"}},
+		{ID: 2, FirstName: "Jane", LastName: "Doe", StartDate: day.AddDate(0, 0, -3), EndDate: day, RoomID: 2,
+			Room: models.Room{ID: 2, RoomName: "Majors Suite"}},
+		{ID: 3, FirstName: "Jack", LastName: "Black", StartDate: day.AddDate(0, 0, -1), EndDate: day.AddDate(0, 0, 1), RoomID: 2,
+			Room: models.Room{ID: 2, RoomName: "Majors Suite"}},
+	}
+
+	return reservations, nil
+}
+
+func (m *testDBRepo) CountNewReservations(ctx context.Context) (int, error) {
+	return 3, nil
+}
+
+// CountBookedNights: к этому дню забронировано 10 ночей, к той же дате прошлого года - 8
+func (m *testDBRepo) CountBookedNights(ctx context.Context, start, end, bookedBefore time.Time) (int, int, error) {
+	if !bookedBefore.IsZero() && bookedBefore.Before(time.Now().AddDate(0, -6, 0)) {
+		return 2, 8, nil
+	}
+
+	return 4, 10, nil
+}
+
+func (m *testDBRepo) CancelReservation(ctx context.Context, id int) error {
+	if id == 2 {
+		return errors.New("cannot cancel a reservation")
+	}
+
+	return nil
+}
+
+// GetReportReservations: три бронирования января 2050 года, одно из них отменено
+func (m *testDBRepo) GetReportReservations(ctx context.Context, start, end time.Time) ([]models.ReportReservation, error) {
+	date := func(m time.Month, d int) time.Time {
+		return time.Date(2050, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	generals := models.Room{ID: 1, RoomName: "General's Quarters", Price: 12000}
+	majors := models.Room{ID: 2, RoomName: "Majors Suite", Price: 10000}
+
+	reservations := []models.ReportReservation{
+		{Reservation: models.Reservation{ID: 1, FirstName: "John", LastName: "Smith", RoomID: 1, Room: generals,
+			StartDate: date(1, 1), EndDate: date(1, 4), Guests: 2, Source: "website", Nationality: "Germany",
+			CreatedAt: date(1, 1).AddDate(0, -1, 0)}, Revenue: 36000},
+		{Reservation: models.Reservation{ID: 2, FirstName: "Jane", LastName: "Doe", RoomID: 2, Room: majors,
+			StartDate: date(1, 30), EndDate: date(2, 2), Guests: 1, Source: "phone",
+			CreatedAt: date(1, 5)}, Revenue: 30000},
+		{Reservation: models.Reservation{ID: 3, FirstName: "Jack", LastName: "Black", RoomID: 1, Room: generals,
+			StartDate: date(1, 20), EndDate: date(1, 22), Guests: 1, Source: "website",
+			CreatedAt: date(1, 2), CancelledAt: date(1, 10)}, Revenue: 24000},
+	}
+
+	return reservations, nil
+}
+
+// CheckInReservation: бронирование 10 изменили параллельно
+func (m *testDBRepo) CheckInReservation(ctx context.Context, id int, at time.Time, docType, docNumber string) error {
+	if id == 10 {
+		return repository.ErrReservationChanged
+	}
+
+	return nil
+}
+
+// CheckOutReservation: продлить проживание до месяца TestBookedDate нельзя, комната занята
+func (m *testDBRepo) CheckOutReservation(ctx context.Context, id int, at, end time.Time) error {
+	if !end.Before(TestBookedDate) && end.Before(TestBookedDate.AddDate(0, 1, 0)) {
+		return repository.ErrRoomNotAvailable
+	}
+
+	return nil
+}
+
+// MarkNoShow: гость бронирования 10 уже заселен другим сотрудником
+func (m *testDBRepo) MarkNoShow(ctx context.Context, id int, at time.Time) error {
+	if id == 10 {
+		return repository.ErrReservationChanged
+	}
+
+	return nil
+}
+
+// GetUsersByRole: одна горничная с ID 2
+func (m *testDBRepo) GetUsersByRole(ctx context.Context, role string) ([]models.User, error) {
+	var users []models.User
+
+	if role == "housekeeping" {
+		users = append(users, models.User{ID: 2, FirstName: "Mary", LastName: "Maid", Email: "mary@here.ca", Role: role})
+	}
+
+	return users, nil
+}
+
+func (m *testDBRepo) InsertHousekeepingTasks(ctx context.Context, tasks []models.HousekeepingTask) (int, error) {
+	return len(tasks), nil
+}
+
+// testHousekeepingTasks: комната 1 ждет уборки после выезда, комната 2 убрана
+func testHousekeepingTasks(day time.Time) []models.HousekeepingTask {
+	return []models.HousekeepingTask{
+		{ID: 1, RoomID: 1, ReservationID: 1, TaskDate: day, Kind: "departure", Status: "dirty",
+			Room: models.Room{ID: 1, RoomName: "General's Quarters"}},
+		{ID: 2, RoomID: 2, ReservationID: 2, TaskDate: day, Kind: "stay_over", Status: "clean", AssignedTo: 2,
+			Room: models.Room{ID: 2, RoomName: "Majors Suite"}, User: models.User{ID: 2, FirstName: "Mary", LastName: "Maid"}},
+	}
+}
+
+func (m *testDBRepo) GetHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error) {
+	return testHousekeepingTasks(day), nil
+}
+
+func (m *testDBRepo) GetLatestHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error) {
+	return testHousekeepingTasks(day), nil
+}
+
+func (m *testDBRepo) GetHousekeepingTaskByID(ctx context.Context, id int) (models.HousekeepingTask, error) {
+	for _, t := range testHousekeepingTasks(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)) {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+
+	return models.HousekeepingTask{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) UpdateHousekeepingTask(ctx context.Context, t models.HousekeepingTask) error {
+	return nil
+}
+
+// testMaintenanceTickets: открытая заявка 1 закрывает комнату 2, заявка 2 закрыта
+var testMaintenanceTickets = []models.MaintenanceTicket{
+	{ID: 1, RoomID: 2, Description: "Boiler is broken", Priority: "urgent", Status: "open", OutOfOrder: true,
+		StartDate: testBookedDay(10), ExpectedResolution: testBookedDay(13),
+		Room: models.Room{ID: 2, RoomName: "Majors Suite"}},
+	{ID: 2, RoomID: 1, Description: "Squeaky door", Priority: "low", Status: "closed",
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC), ClosedAt: time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC),
+		Room: models.Room{ID: 1, RoomName: "General's Quarters"}},
+}
+
+func (m *testDBRepo) GetMaintenanceTickets(ctx context.Context, open bool) ([]models.MaintenanceTicket, error) {
+	var tickets []models.MaintenanceTicket
+
+	for _, t := range testMaintenanceTickets {
+		if !open || t.Status != "closed" {
+			tickets = append(tickets, t)
+		}
+	}
+
+	return tickets, nil
+}
+
+func (m *testDBRepo) GetMaintenanceTicketByID(ctx context.Context, id int) (models.MaintenanceTicket, error) {
+	for _, t := range testMaintenanceTickets {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+
+	return models.MaintenanceTicket{}, sql.ErrNoRows
+}
+
+// SaveMaintenanceTicket: блокировка не ставится на дни, занятые другими ограничениями из testRestrictions
+func (m *testDBRepo) SaveMaintenanceTicket(ctx context.Context, t models.MaintenanceTicket, block *models.RoomRestriction) (int, error) {
+	if t.ID == 0 {
+		t.ID = len(testMaintenanceTickets) + 1
+	}
+
+	if block != nil {
+		for _, rr := range testRestrictions {
+			if rr.RoomID == block.RoomID && rr.MaintenanceTicketID != t.ID &&
+				rr.EndDate.After(block.StartDate) && rr.StartDate.Before(block.EndDate) {
+				return 0, repository.ErrRoomNotAvailable
+			}
+		}
+	}
+
+	return t.ID, nil
+}
+
+// testAuditLog - журнал изменений тестового репозитория, в него пишут обработчики во время тестов
+var testAuditLog []models.AuditEntry
+
+func (m *testDBRepo) InsertAuditEntry(ctx context.Context, e models.AuditEntry) error {
+	e.ID = len(testAuditLog) + 1
+	e.CreatedAt = time.Now()
+	if e.UserID > 0 {
+		e.User = models.User{ID: e.UserID, FirstName: "Admin", LastName: "User", Email: "admin@admin.com"}
+	}
+
+	testAuditLog = append(testAuditLog, e)
+
+	return nil
+}
+
+func (m *testDBRepo) GetAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, int, error) {
+	var entries []models.AuditEntry
+
+	// новые записи сверху
+	for i := len(testAuditLog) - 1; i >= 0; i-- {
+		e := testAuditLog[i]
+
+		if (f.Entity != "" && e.Entity != f.Entity) || (f.EntityID > 0 && e.EntityID != f.EntityID) ||
+			(f.UserID > 0 && e.UserID != f.UserID) || (f.Action != "" && e.Action != f.Action) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, len(entries), nil
+}
@@ -1,28 +1,93 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"github.com/krasnov23/guest-house-golang/internal/models"
 	"time"
 )
 
+// ErrRoomNotAvailable - комнату на эти даты уже заняли (бронирование или блокировка)
+var ErrRoomNotAvailable = errors.New("room is not available for the selected dates")
+
+// ErrReservationChanged - бронирование изменил кто-то другой после того, как его загрузили
+var ErrReservationChanged = errors.New("reservation has been changed by someone else")
+
+// ErrBlocksChanged - блокировки комнаты в календаре изменил кто-то другой после того, как их загрузили
+var ErrBlocksChanged = errors.New("room blocks have been changed by someone else")
+
+// ErrReservationReferenced - у бронирования есть платежи или счет, удалять его нельзя, только отменять
+var ErrReservationReferenced = errors.New("reservation has payments or an invoice and cannot be deleted")
+
 type DatabaseRepo interface {
-	AllUsers() bool
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(roomId int, start, end time.Time) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(roomId int) (models.Room, error)
-	GetUserById(userId int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, password string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id int, processed int) error
-	AllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlockById(id int) error
+	AllUsers(ctx context.Context) bool
+	CreateReservation(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) (int, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, roomId int, start, end time.Time) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, roomId int) (models.Room, error)
+	GetUserById(ctx context.Context, userId int) (models.User, error)
+	UpdateUser(ctx context.Context, user models.User) error
+	Authenticate(ctx context.Context, email, password string) (int, string, error)
+	AllReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error)
+	AllNewReservations(ctx context.Context, f models.ReservationFilter) ([]models.Reservation, int, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	UpdateReservationStay(ctx context.Context, res models.Reservation, charges []models.ReservationCharge) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id int, processed int) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	UpdateRoomBlocks(ctx context.Context, versions map[int]string, start, end time.Time, add []models.RoomRestriction, remove []int) error
+	GetCalendarRestrictions(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error)
+	GetRestrictionsForRoomByDate(ctx context.Context, roomId int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlockById(ctx context.Context, id int) error
+	AllStayRules(ctx context.Context) ([]models.StayRule, error)
+	GetStayRulesForRoom(ctx context.Context, roomID int) ([]models.StayRule, error)
+	GetStayRuleByID(ctx context.Context, id int) (models.StayRule, error)
+	InsertStayRule(ctx context.Context, rule models.StayRule) (int, error)
+	DeleteStayRule(ctx context.Context, id int) error
+	GetAvailabilityCalendar(ctx context.Context, roomID int, start, end time.Time) ([]models.DayAvailability, error)
+	InsertPayment(ctx context.Context, p models.Payment) (int, error)
+	UpdatePayment(ctx context.Context, p models.Payment) error
+	GetPaymentByID(ctx context.Context, id int) (models.Payment, error)
+	GetPaymentByProviderRef(ctx context.Context, provider, ref string) (models.Payment, error)
+	GetPaymentsByReservationID(ctx context.Context, reservationID int) ([]models.Payment, error)
+	GetInvoice(ctx context.Context, reservationID int) (models.Invoice, error)
+	IssueInvoice(ctx context.Context, reservationID int) (models.Invoice, error)
+	SaveInvoiceDocument(ctx context.Context, invoiceID int, document []byte) ([]byte, error)
+	AllTaxRules(ctx context.Context) ([]models.TaxRule, error)
+	GetTaxRuleByID(ctx context.Context, id int) (models.TaxRule, error)
+	InsertTaxRule(ctx context.Context, rule models.TaxRule) (int, error)
+	DeleteTaxRule(ctx context.Context, id int) error
+	GetReservationCharges(ctx context.Context, reservationID int) ([]models.ReservationCharge, error)
+	AllPromoCodes(ctx context.Context) ([]models.PromoCode, error)
+	GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error)
+	GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error)
+	InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error)
+	UpdatePromoCode(ctx context.Context, p models.PromoCode) error
+	DeletePromoCode(ctx context.Context, id int) error
+	CountPromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error)
+	GetPromoCodeUses(ctx context.Context, promoCodeID int) ([]models.PromoCodeUse, error)
+	InsertWaitlistEntry(ctx context.Context, e models.WaitlistEntry) error
+	GetPendingWaitlistEntries(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error)
+	MarkWaitlistNotified(ctx context.Context, id int) error
+	GetReservationsOnDate(ctx context.Context, day time.Time) ([]models.Reservation, error)
+	CountNewReservations(ctx context.Context) (int, error)
+	CountBookedNights(ctx context.Context, start, end, bookedBefore time.Time) (int, int, error)
+	CancelReservation(ctx context.Context, id int) error
+	GetReportReservations(ctx context.Context, start, end time.Time) ([]models.ReportReservation, error)
+	CheckInReservation(ctx context.Context, id int, at time.Time, docType, docNumber string) error
+	CheckOutReservation(ctx context.Context, id int, at, end time.Time) error
+	MarkNoShow(ctx context.Context, id int, at time.Time) error
+	GetUsersByRole(ctx context.Context, role string) ([]models.User, error)
+	InsertHousekeepingTasks(ctx context.Context, tasks []models.HousekeepingTask) (int, error)
+	GetHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error)
+	GetLatestHousekeepingTasks(ctx context.Context, day time.Time) ([]models.HousekeepingTask, error)
+	GetHousekeepingTaskByID(ctx context.Context, id int) (models.HousekeepingTask, error)
+	UpdateHousekeepingTask(ctx context.Context, t models.HousekeepingTask) error
+	GetMaintenanceTickets(ctx context.Context, open bool) ([]models.MaintenanceTicket, error)
+	GetMaintenanceTicketByID(ctx context.Context, id int) (models.MaintenanceTicket, error)
+	SaveMaintenanceTicket(ctx context.Context, t models.MaintenanceTicket, block *models.RoomRestriction) (int, error)
+	InsertAuditEntry(ctx context.Context, e models.AuditEntry) error
+	GetAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, int, error)
 }
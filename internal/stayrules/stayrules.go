@@ -0,0 +1,135 @@
+package stayrules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Violation - нарушение правила проживания. Field - имя поля формы, к которому относится ошибка
+type Violation struct {
+	Field   string
+	Message string
+}
+
+// Error позволяет использовать нарушение как обычную ошибку
+func (v Violation) Error() string {
+	return v.Message
+}
+
+// Applicable возвращает правила, которые действуют для комнаты при заезде в указанную дату
+func Applicable(rules []models.StayRule, roomID int, arrival time.Time) []models.StayRule {
+	var result []models.StayRule
+
+	for _, rule := range rules {
+		if rule.RoomID != 0 && rule.RoomID != roomID {
+			continue
+		}
+
+		// Сезон определяется по дате заезда, конец сезона не включается
+		if !rule.SeasonStart.IsZero() && arrival.Before(rule.SeasonStart) {
+			continue
+		}
+
+		if !rule.SeasonEnd.IsZero() && !arrival.Before(rule.SeasonEnd) {
+			continue
+		}
+
+		result = append(result, rule)
+	}
+
+	return result
+}
+
+// Check проверяет даты проживания по базовым правилам (выезд после заезда, заезд не в прошлом)
+// и по всем переданным правилам. Если нарушений нет - возвращается пустой срез.
+func Check(rules []models.StayRule, start, end, now time.Time) []Violation {
+	var violations []Violation
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if start.Before(today) {
+		violations = append(violations, Violation{"start_date", "Arrival date cannot be in the past."})
+	}
+
+	if !end.After(start) {
+		violations = append(violations, Violation{"end_date", "Departure date must be after arrival date."})
+		// Остальные правила без корректного периода проверять бессмысленно
+		return violations
+	}
+
+	nights := Nights(start, end)
+	lead := Nights(today, start)
+
+	for _, rule := range rules {
+		if rule.MinNights > 0 && nights < rule.MinNights {
+			violations = append(violations, Violation{"end_date", fmt.Sprintf("Minimum stay is %d nights.", rule.MinNights)})
+		}
+
+		if rule.MaxNights > 0 && nights > rule.MaxNights {
+			violations = append(violations, Violation{"end_date", fmt.Sprintf("Maximum stay is %d nights.", rule.MaxNights)})
+		}
+
+		if !DayAllowed(rule.ArrivalDays, start.Weekday()) {
+			violations = append(violations, Violation{"start_date", fmt.Sprintf("Arrival is only possible on %s.", DaysString(rule.ArrivalDays))})
+		}
+
+		if !DayAllowed(rule.DepartureDays, end.Weekday()) {
+			violations = append(violations, Violation{"end_date", fmt.Sprintf("Departure is only possible on %s.", DaysString(rule.DepartureDays))})
+		}
+
+		if rule.MinLeadDays > 0 && lead < rule.MinLeadDays {
+			violations = append(violations, Violation{"start_date", fmt.Sprintf("Reservations must be made at least %d days in advance.", rule.MinLeadDays)})
+		}
+
+		if rule.MaxAdvanceDays > 0 && lead > rule.MaxAdvanceDays {
+			violations = append(violations, Violation{"start_date", fmt.Sprintf("Reservations can be made at most %d days in advance.", rule.MaxAdvanceDays)})
+		}
+	}
+
+	return violations
+}
+
+// Nights возвращает количество ночей между двумя датами
+func Nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// DayAllowed проверяет, разрешен ли день недели битовой маской. Пустая маска разрешает любой день
+func DayAllowed(mask int, day time.Weekday) bool {
+	if mask == 0 {
+		return true
+	}
+
+	return mask&(1<<uint(day)) != 0
+}
+
+// DaysMask собирает битовую маску из списка дней недели
+func DaysMask(days ...time.Weekday) int {
+	mask := 0
+	for _, d := range days {
+		mask |= 1 << uint(d)
+	}
+
+	return mask
+}
+
+// DaysString возвращает дни недели из маски в читаемом виде, например "Saturday, Sunday"
+func DaysString(mask int) string {
+	if mask == 0 {
+		return "any day"
+	}
+
+	var names []string
+	// Начинаем с понедельника, воскресенье в конце
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		if DayAllowed(mask, day) {
+			names = append(names, day.String())
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,79 @@
+package stayrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestApplicable(t *testing.T) {
+	rules := []models.StayRule{
+		{ID: 1},
+		{ID: 2, RoomID: 2},
+		{ID: 3, SeasonStart: date(2050, 6, 1), SeasonEnd: date(2050, 9, 1)},
+	}
+
+	got := Applicable(rules, 1, date(2050, 7, 1))
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 {
+		t.Errorf("unexpected rules for summer: %v", got)
+	}
+
+	// конец сезона не включается
+	got = Applicable(rules, 2, date(2050, 9, 1))
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("unexpected rules after season: %v", got)
+	}
+}
+
+var checkTests = []struct {
+	name     string
+	rule     models.StayRule
+	start    time.Time
+	end      time.Time
+	expected []string
+}{
+	{"valid", models.StayRule{MinNights: 1}, date(2050, 1, 1), date(2050, 1, 3), nil},
+	{"zero nights", models.StayRule{}, date(2050, 1, 1), date(2050, 1, 1), []string{"Departure date must be after arrival date."}},
+	{"past", models.StayRule{}, date(2000, 1, 1), date(2000, 1, 2), []string{"Arrival date cannot be in the past."}},
+	{"min nights", models.StayRule{MinNights: 3}, date(2050, 1, 1), date(2050, 1, 3), []string{"Minimum stay is 3 nights."}},
+	{"max nights", models.StayRule{MaxNights: 7}, date(2050, 1, 1), date(2050, 1, 9), []string{"Maximum stay is 7 nights."}},
+	// 2050-01-01 - суббота, 2050-01-03 - понедельник
+	{"arrival day", models.StayRule{ArrivalDays: DaysMask(time.Sunday)}, date(2050, 1, 1), date(2050, 1, 3), []string{"Arrival is only possible on Sunday."}},
+	{"departure day", models.StayRule{DepartureDays: DaysMask(time.Saturday, time.Sunday)}, date(2050, 1, 1), date(2050, 1, 3), []string{"Departure is only possible on Saturday, Sunday."}},
+	{"lead time", models.StayRule{MinLeadDays: 2}, date(2049, 12, 31), date(2050, 1, 3), []string{"Reservations must be made at least 2 days in advance."}},
+	{"advance window", models.StayRule{MaxAdvanceDays: 10}, date(2050, 2, 1), date(2050, 2, 3), []string{"Reservations can be made at most 10 days in advance."}},
+}
+
+func TestCheck(t *testing.T) {
+	now := date(2049, 12, 30).Add(15 * time.Hour)
+
+	for _, e := range checkTests {
+		got := Check([]models.StayRule{e.rule}, e.start, e.end, now)
+
+		if len(got) != len(e.expected) {
+			t.Errorf("%s: got %d violations %v, want %d", e.name, len(got), got, len(e.expected))
+			continue
+		}
+
+		for i, v := range got {
+			if v.Message != e.expected[i] {
+				t.Errorf("%s: got %q, want %q", e.name, v.Message, e.expected[i])
+			}
+		}
+	}
+}
+
+func TestDaysString(t *testing.T) {
+	if s := DaysString(0); s != "any day" {
+		t.Errorf("got %q for empty mask", s)
+	}
+
+	if s := DaysString(DaysMask(time.Sunday, time.Monday)); s != "Monday, Sunday" {
+		t.Errorf("got %q", s)
+	}
+}
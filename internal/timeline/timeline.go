@@ -0,0 +1,160 @@
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+// Виды отображения календаря
+const (
+	ViewWeek   = "week"
+	ViewMonth  = "month"
+	ViewCustom = "custom"
+)
+
+// MaxDays - самый длинный произвольный период, который можно показать за один раз
+const MaxDays = 92
+
+// ErrRange - неверно задан произвольный период
+var ErrRange = errors.New("timeline: invalid date range")
+
+// Bar - полоса на календаре: бронирование или блокировка комнаты.
+// Offset и Length считаются в днях от начала показываемого периода и обрезаются по его границам
+type Bar struct {
+	ID            int       `json:"id"`
+	ReservationID int       `json:"reservation_id"`
+	Kind          string    `json:"kind"`
+	Label         string    `json:"label"`
+	StartDate     string    `json:"start_date"`
+	EndDate       string    `json:"end_date"`
+	Offset        int       `json:"offset"`
+	Length        int       `json:"length"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Row - строка календаря, одна на комнату
+type Row struct {
+	RoomID   int    `json:"room_id"`
+	RoomName string `json:"room_name"`
+	Bars     []Bar  `json:"bars"`
+}
+
+// Calendar - данные для отрисовки календаря: дни периода (конец не включается) и строки комнат
+type Calendar struct {
+	View  string   `json:"view"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Days  []string `json:"days"`
+	Rows  []Row    `json:"rows"`
+}
+
+// Виды полос
+const (
+	KindReservation = "reservation"
+	KindBlock       = "block"
+)
+
+// Range возвращает начало и конец (не включается) периода для вида view.
+// Неделя начинается с понедельника, месяц - с первого числа; без даты начала берется сегодняшний день.
+// Для произвольного периода end - последний показываемый день
+func Range(view, start, end string, today time.Time) (time.Time, time.Time, error) {
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	if start != "" {
+		t, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrRange
+		}
+		from = t
+	}
+
+	switch view {
+	case ViewWeek:
+		// Weekday у воскресенья 0, поэтому сдвиг считается так, чтобы неделя начиналась с понедельника
+		from = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+		return from, from.AddDate(0, 0, 7), nil
+	case ViewCustom:
+		to, err := time.Parse("2006-01-02", end)
+		if err != nil || to.Before(from) {
+			return time.Time{}, time.Time{}, ErrRange
+		}
+
+		to = to.AddDate(0, 0, 1)
+		if Days(from, to) > MaxDays {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: at most %d days", ErrRange, MaxDays)
+		}
+
+		return from, to, nil
+	default:
+		from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0), nil
+	}
+}
+
+// Days возвращает количество дней между датами
+func Days(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// Build раскладывает ограничения комнат по строкам календаря за период start-end.
+// У бронирований в ограничении должны быть заполнены данные гостя (Reservation)
+func Build(view string, rooms []models.Room, restrictions []models.RoomRestriction, start, end time.Time) Calendar {
+	c := Calendar{
+		View:  view,
+		Start: start.Format("2006-01-02"),
+		End:   end.Format("2006-01-02"),
+		Days:  []string{},
+		Rows:  []Row{},
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		c.Days = append(c.Days, d.Format("2006-01-02"))
+	}
+
+	rows := make(map[int]int)
+
+	for _, room := range rooms {
+		rows[room.ID] = len(c.Rows)
+		c.Rows = append(c.Rows, Row{RoomID: room.ID, RoomName: room.RoomName, Bars: []Bar{}})
+	}
+
+	for _, rr := range restrictions {
+		i, ok := rows[rr.RoomID]
+		if !ok || !rr.EndDate.After(start) || !rr.StartDate.Before(end) {
+			continue
+		}
+
+		from, to := rr.StartDate, rr.EndDate
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+
+		bar := Bar{
+			ID:        rr.ID,
+			Kind:      KindBlock,
+			Label:     "Blocked",
+			StartDate: rr.StartDate.Format("2006-01-02"),
+			EndDate:   rr.EndDate.Format("2006-01-02"),
+			Offset:    Days(start, from),
+			Length:    Days(from, to),
+		}
+
+		if rr.ReservationID > 0 {
+			res := rr.Reservation
+			bar.Kind = KindReservation
+			bar.ReservationID = rr.ReservationID
+			bar.Label = fmt.Sprintf("%s %s", res.FirstName, res.LastName)
+			bar.UpdatedAt = res.UpdatedAt
+		}
+
+		c.Rows[i].Bars = append(c.Rows[i].Bars, bar)
+	}
+
+	return c
+}
@@ -0,0 +1,92 @@
+package timeline
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/krasnov23/guest-house-golang/internal/models"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestRange(t *testing.T) {
+	today := date(2050, 1, 13) // четверг
+
+	var tests = []struct {
+		name      string
+		view      string
+		start     string
+		end       string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{"week-today", ViewWeek, "", "", date(2050, 1, 10), date(2050, 1, 17), false},
+		{"week-sunday", ViewWeek, "2050-01-16", "", date(2050, 1, 10), date(2050, 1, 17), false},
+		{"month", ViewMonth, "2050-02-14", "", date(2050, 2, 1), date(2050, 3, 1), false},
+		{"default-month", "", "", "", date(2050, 1, 1), date(2050, 2, 1), false},
+		{"custom", ViewCustom, "2050-01-05", "2050-01-20", date(2050, 1, 5), date(2050, 1, 21), false},
+		{"custom-reversed", ViewCustom, "2050-01-20", "2050-01-05", time.Time{}, time.Time{}, true},
+		{"custom-too-long", ViewCustom, "2050-01-01", "2050-06-01", time.Time{}, time.Time{}, true},
+		{"bad-date", ViewMonth, "2050-13-01", "", time.Time{}, time.Time{}, true},
+	}
+
+	for _, e := range tests {
+		start, end, err := Range(e.view, e.start, e.end, today)
+
+		if e.wantErr {
+			if !errors.Is(err, ErrRange) {
+				t.Errorf("failed %s: got %v, want ErrRange", e.name, err)
+			}
+			continue
+		}
+
+		if err != nil || !start.Equal(e.wantStart) || !end.Equal(e.wantEnd) {
+			t.Errorf("failed %s: got %s - %s, %v", e.name, start, end, err)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	rooms := []models.Room{{ID: 1, RoomName: "General's Quarters"}, {ID: 2, RoomName: "Majors Suite"}}
+
+	restrictions := []models.RoomRestriction{
+		// начинается до периода - обрезается слева
+		{ID: 1, RoomID: 1, ReservationID: 5, StartDate: date(2050, 1, 5), EndDate: date(2050, 1, 12),
+			Reservation: models.Reservation{FirstName: "John", LastName: "Smith"}},
+		{ID: 2, RoomID: 2, StartDate: date(2050, 1, 15), EndDate: date(2050, 1, 16)},
+		// заканчивается после периода - обрезается справа
+		{ID: 3, RoomID: 2, ReservationID: 6, StartDate: date(2050, 1, 16), EndDate: date(2050, 1, 20)},
+		// вне периода
+		{ID: 4, RoomID: 1, ReservationID: 7, StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 10)},
+		// неизвестная комната
+		{ID: 5, RoomID: 9, ReservationID: 8, StartDate: date(2050, 1, 11), EndDate: date(2050, 1, 12)},
+	}
+
+	c := Build(ViewWeek, rooms, restrictions, date(2050, 1, 10), date(2050, 1, 17))
+
+	if len(c.Days) != 7 || c.Days[0] != "2050-01-10" {
+		t.Fatalf("unexpected days %v", c.Days)
+	}
+
+	if len(c.Rows) != 2 || len(c.Rows[0].Bars) != 1 || len(c.Rows[1].Bars) != 2 {
+		t.Fatalf("unexpected rows %+v", c.Rows)
+	}
+
+	bar := c.Rows[0].Bars[0]
+	if bar.Kind != KindReservation || bar.Label != "John Smith" || bar.Offset != 0 || bar.Length != 2 || bar.StartDate != "2050-01-05" {
+		t.Errorf("unexpected bar %+v", bar)
+	}
+
+	block := c.Rows[1].Bars[0]
+	if block.Kind != KindBlock || block.Offset != 5 || block.Length != 1 {
+		t.Errorf("unexpected block %+v", block)
+	}
+
+	if tail := c.Rows[1].Bars[1]; tail.Offset != 6 || tail.Length != 1 {
+		t.Errorf("unexpected bar %+v", tail)
+	}
+}
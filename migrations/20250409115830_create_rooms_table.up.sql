@@ -0,0 +1,6 @@
+create table rooms (
+  id serial primary key,
+  room_name varchar(255) not null default '',
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
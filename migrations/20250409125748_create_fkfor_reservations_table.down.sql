@@ -0,0 +1 @@
+alter table reservations drop constraint reservations_rooms_id_fk;
@@ -0,0 +1,3 @@
+drop index room_restrictions_reservation_id_idx;
+drop index room_restrictions_room_id_idx;
+drop index room_restrictions_start_date_end_date_idx;
@@ -0,0 +1,2 @@
+drop index reservations_email_idx;
+drop index reservations_last_name_idx;
@@ -0,0 +1 @@
+-- откат не возвращает not null: в таблице уже могут быть блокировки без бронирования
@@ -0,0 +1,2 @@
+-- блокировки владельца не привязаны к бронированию
+alter table room_restrictions alter column reservation_id drop not null;
@@ -1,4 +1,4 @@
 INSERT INTO public.restrictions (restriction_name,created_at,updated_at)
 VALUES
-    ('Reservation','2020-11-18 00:00:00.000','''2020-11-18 00:00:00.000'''),
+    ('Reservation','2020-11-18 00:00:00.000','2020-11-18 00:00:00.000'),
     ('Owner Block','2020-11-19 00:00:00.000','2020-11-19 00:00:00.000');
\ No newline at end of file
@@ -0,0 +1,17 @@
+create table stay_rules (
+  id serial primary key,
+  rule_name varchar(255) not null default '',
+  room_id integer,
+  season_start date,
+  season_end date,
+  min_nights integer not null default 1,
+  max_nights integer not null default 0,
+  arrival_days integer not null default 0,
+  departure_days integer not null default 0,
+  min_lead_days integer not null default 0,
+  max_advance_days integer not null default 0,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table stay_rules add constraint stay_rules_rooms_id_fk foreign key (room_id) references rooms (id) on delete cascade on update cascade;
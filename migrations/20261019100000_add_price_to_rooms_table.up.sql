@@ -0,0 +1 @@
+alter table rooms add column price integer not null default 0;
@@ -0,0 +1,18 @@
+create table payments (
+  id serial primary key,
+  reservation_id integer not null,
+  provider varchar(255) not null default '',
+  provider_ref varchar(255) not null default '',
+  kind varchar(255) not null default 'deposit',
+  amount integer not null default 0,
+  refunded_amount integer not null default 0,
+  currency varchar(3) not null default 'USD',
+  status varchar(255) not null default 'authorized',
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table payments add constraint payments_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete cascade on update cascade;
+
+create index payments_reservation_id_idx on payments (reservation_id);
+create index payments_provider_ref_idx on payments (provider_ref);
@@ -0,0 +1,14 @@
+create table invoices (
+  id serial primary key,
+  reservation_id integer not null,
+  year integer not null,
+  number integer not null,
+  invoice_number varchar(255) not null,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table invoices add constraint invoices_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete cascade on update cascade;
+
+create unique index invoices_reservation_id_idx on invoices (reservation_id);
+create unique index invoices_year_number_idx on invoices (year, number);
@@ -0,0 +1 @@
+drop table tax_rules;
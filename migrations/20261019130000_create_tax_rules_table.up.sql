@@ -0,0 +1,12 @@
+create table tax_rules (
+  id serial primary key,
+  name varchar(255) not null default '',
+  kind varchar(255) not null default 'tax',
+  calculation varchar(255) not null default 'fixed',
+  amount integer not null default 0,
+  per varchar(255) not null default 'stay',
+  valid_from date,
+  valid_to date,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
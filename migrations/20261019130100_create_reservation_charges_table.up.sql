@@ -0,0 +1,15 @@
+create table reservation_charges (
+  id serial primary key,
+  reservation_id integer not null,
+  kind varchar(255) not null default 'room',
+  description varchar(255) not null default '',
+  quantity integer not null default 1,
+  unit_amount integer not null default 0,
+  amount integer not null default 0,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table reservation_charges add constraint reservation_charges_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete cascade on update cascade;
+
+create index reservation_charges_reservation_id_idx on reservation_charges (reservation_id);
@@ -0,0 +1 @@
+alter table reservations drop column guests;
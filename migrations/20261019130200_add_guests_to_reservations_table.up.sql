@@ -0,0 +1 @@
+alter table reservations add column guests integer not null default 1;
@@ -0,0 +1 @@
+drop table promo_codes;
@@ -0,0 +1,21 @@
+create table promo_codes (
+  id serial primary key,
+  code varchar(255) not null,
+  description varchar(255) not null default '',
+  calculation varchar(255) not null default 'percent',
+  amount integer not null default 0,
+  valid_from date,
+  valid_to date,
+  stay_from date,
+  stay_to date,
+  room_id integer,
+  max_uses integer not null default 0,
+  once_per_guest boolean not null default false,
+  active boolean not null default true,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+create unique index promo_codes_code_idx on promo_codes (code);
+
+alter table promo_codes add constraint promo_codes_rooms_id_fk foreign key (room_id) references rooms (id) on delete cascade on update cascade;
@@ -0,0 +1,2 @@
+alter table reservations drop constraint reservations_promo_codes_id_fk;
+alter table reservations drop column promo_code_id;
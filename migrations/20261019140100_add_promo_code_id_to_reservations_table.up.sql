@@ -0,0 +1,5 @@
+alter table reservations add column promo_code_id integer;
+
+alter table reservations add constraint reservations_promo_codes_id_fk foreign key (promo_code_id) references promo_codes (id) on delete set null on update cascade;
+
+create index reservations_promo_code_id_idx on reservations (promo_code_id);
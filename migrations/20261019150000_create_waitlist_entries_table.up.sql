@@ -0,0 +1,15 @@
+create table waitlist_entries (
+  id serial primary key,
+  name varchar(255) not null default '',
+  email varchar(255) not null,
+  start_date date not null,
+  end_date date not null,
+  room_id integer,
+  notified_at timestamp,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table waitlist_entries add constraint waitlist_entries_rooms_id_fk foreign key (room_id) references rooms (id) on delete cascade on update cascade;
+
+create index waitlist_entries_start_date_end_date_idx on waitlist_entries (start_date, end_date);
@@ -0,0 +1,3 @@
+alter table reservations drop column cancelled_at;
+alter table reservations drop column nationality;
+alter table reservations drop column source;
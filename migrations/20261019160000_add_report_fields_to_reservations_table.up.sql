@@ -0,0 +1,5 @@
+alter table reservations add column source varchar(255) not null default 'website';
+alter table reservations add column nationality varchar(255) not null default '';
+alter table reservations add column cancelled_at timestamp;
+
+create index reservations_cancelled_at_idx on reservations (cancelled_at);
@@ -0,0 +1,19 @@
+create table audit_log (
+  id serial primary key,
+  user_id integer,
+  actor varchar(255) not null default '',
+  action varchar(255) not null,
+  entity varchar(255) not null,
+  entity_id integer not null default 0,
+  before jsonb,
+  after jsonb,
+  ip varchar(255) not null default '',
+  created_at timestamp not null default now()
+);
+
+create index audit_log_entity_entity_id_idx on audit_log (entity, entity_id);
+create index audit_log_user_id_idx on audit_log (user_id);
+create index audit_log_created_at_idx on audit_log (created_at);
+
+create rule audit_log_no_update as on update to audit_log do instead nothing;
+create rule audit_log_no_delete as on delete to audit_log do instead nothing;
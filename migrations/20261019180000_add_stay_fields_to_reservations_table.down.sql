@@ -0,0 +1,5 @@
+alter table reservations drop column id_document_number;
+alter table reservations drop column id_document_type;
+alter table reservations drop column no_show_at;
+alter table reservations drop column checked_out_at;
+alter table reservations drop column checked_in_at;
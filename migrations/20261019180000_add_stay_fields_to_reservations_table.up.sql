@@ -0,0 +1,5 @@
+alter table reservations add column checked_in_at timestamp;
+alter table reservations add column checked_out_at timestamp;
+alter table reservations add column no_show_at timestamp;
+alter table reservations add column id_document_type varchar(255) not null default '';
+alter table reservations add column id_document_number varchar(255) not null default '';
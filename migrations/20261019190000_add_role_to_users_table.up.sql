@@ -0,0 +1 @@
+alter table users add column role varchar(255) not null default 'admin';
@@ -0,0 +1 @@
+drop table housekeeping_tasks;
@@ -0,0 +1,18 @@
+create table housekeeping_tasks (
+  id serial primary key,
+  room_id integer not null,
+  reservation_id integer,
+  task_date date not null,
+  kind varchar(255) not null default 'departure',
+  status varchar(255) not null default 'dirty',
+  assigned_to integer,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table housekeeping_tasks add constraint housekeeping_tasks_rooms_id_fk foreign key (room_id) references rooms (id) on delete cascade on update cascade;
+alter table housekeeping_tasks add constraint housekeeping_tasks_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete set null on update cascade;
+alter table housekeeping_tasks add constraint housekeeping_tasks_users_id_fk foreign key (assigned_to) references users (id) on delete set null on update cascade;
+
+create unique index housekeeping_tasks_room_id_task_date_idx on housekeeping_tasks (room_id, task_date);
+create index housekeeping_tasks_task_date_idx on housekeeping_tasks (task_date);
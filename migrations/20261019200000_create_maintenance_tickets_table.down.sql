@@ -0,0 +1 @@
+drop table maintenance_tickets;
@@ -0,0 +1,17 @@
+create table maintenance_tickets (
+  id serial primary key,
+  room_id integer not null,
+  description text not null default '',
+  priority varchar(255) not null default 'normal',
+  status varchar(255) not null default 'open',
+  out_of_order boolean not null default false,
+  start_date date not null,
+  expected_resolution date,
+  closed_at timestamp,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+alter table maintenance_tickets add constraint maintenance_tickets_rooms_id_fk foreign key (room_id) references rooms (id) on delete cascade on update cascade;
+
+create index maintenance_tickets_room_id_status_idx on maintenance_tickets (room_id, status);
@@ -0,0 +1,2 @@
+alter table room_restrictions drop constraint room_restrictions_maintenance_tickets_id_fk;
+alter table room_restrictions drop column maintenance_ticket_id;
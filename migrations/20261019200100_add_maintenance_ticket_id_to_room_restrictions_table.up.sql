@@ -0,0 +1,5 @@
+alter table room_restrictions add column maintenance_ticket_id integer;
+
+alter table room_restrictions add constraint room_restrictions_maintenance_tickets_id_fk foreign key (maintenance_ticket_id) references maintenance_tickets (id) on delete cascade on update cascade;
+
+create index room_restrictions_maintenance_ticket_id_idx on room_restrictions (maintenance_ticket_id);
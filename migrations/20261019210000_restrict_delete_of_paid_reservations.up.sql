@@ -0,0 +1,3 @@
+alter table payments drop constraint payments_reservations_id_fk;
+
+alter table payments add constraint payments_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete restrict on update cascade;
@@ -0,0 +1,3 @@
+alter table invoices drop constraint invoices_reservations_id_fk;
+
+alter table invoices add constraint invoices_reservations_id_fk foreign key (reservation_id) references reservations (id) on delete restrict on update cascade;
@@ -0,0 +1 @@
+alter table invoices drop column document;
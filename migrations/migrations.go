@@ -0,0 +1,8 @@
+// Package migrations встраивает SQL-миграции в бинарник приложения.
+// Файл миграции: <версия>_<название>.up.sql и парный .down.sql
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
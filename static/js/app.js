@@ -121,4 +121,37 @@ function Prompt(){
         error: error,
         custom: custom,
     }
-}
\ No newline at end of file
+}
+// Загружает календарь доступности комнаты на год вперед и запрещает выбор занятых дат.
+// В календаре заезда запрещены занятые ночи, в календаре выезда - дни, ночь перед которыми занята
+function disableUnavailableDates(roomID, startPicker, endPicker) {
+    const format = (d) => d.toISOString().slice(0, 10);
+
+    const from = new Date();
+    const to = new Date();
+    to.setDate(to.getDate() + 365);
+
+    fetch('/availability-calendar?room_id=' + roomID + '&start=' + format(from) + '&end=' + format(to))
+        .then(response => response.json())
+        .then(data => {
+            if (!data.ok) {
+                return;
+            }
+
+            let busyNights = [];
+            let busyDepartures = [];
+
+            data.days.forEach(day => {
+                if (!day.available) {
+                    busyNights.push(day.date);
+
+                    let next = new Date(day.date);
+                    next.setDate(next.getDate() + 1);
+                    busyDepartures.push(format(next));
+                }
+            });
+
+            startPicker.setOptions({datesDisabled: busyNights});
+            endPicker.setOptions({datesDisabled: busyDepartures});
+        });
+}